@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/pem"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 
@@ -25,6 +26,7 @@ var (
 	lineNormalization bool
 	followSymlinkDirs bool
 	useDSSE           bool
+	logLevel          string
 )
 
 var rootCmd = &cobra.Command{
@@ -36,6 +38,29 @@ var rootCmd = &cobra.Command{
 	DisableAutoGenTag: true,
 }
 
+func init() {
+	rootCmd.PersistentFlags().StringVar(
+		&logLevel,
+		"log-level",
+		"info",
+		`Minimum level of log messages written to stderr, one of 'debug',
+'info', 'warn' or 'error'.`,
+	)
+	cobra.OnInitialize(initLogging)
+}
+
+// initLogging configures the default logger, which is used by the in_toto
+// library, according to the --log-level flag
+func initLogging() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid log level '%s', using 'info'\n", logLevel)
+		level = slog.LevelInfo
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr,
+		&slog.HandlerOptions{Level: level})))
+}
+
 func loadKeyFromSpireSocket() error {
 	ctx := context.Background()
 	var err error
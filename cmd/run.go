@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
+	"time"
 
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/spf13/cobra"
@@ -14,6 +16,7 @@ var (
 	materialsPaths []string
 	productsPaths  []string
 	noCommand      bool
+	timeout        time.Duration
 )
 
 var runCmd = &cobra.Command{
@@ -140,6 +143,15 @@ with a new line character.`,
 		`Indicate that there is no command to be executed for the step.`,
 	)
 
+	runCmd.Flags().DurationVar(
+		&timeout,
+		"timeout",
+		0,
+		`Maximum duration of the step, e.g. '10m'. If the command does not
+exit in time, it is killed and no link metadata is created. By
+default there is no timeout.`,
+	)
+
 	runCmd.PersistentFlags().BoolVar(
 		&followSymlinkDirs,
 		"follow-symlink-dirs",
@@ -174,7 +186,14 @@ func run(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("no command arguments passed, please specify or use --no-command option")
 	}
 
-	metadata, err := intoto.InTotoRun(stepName, runDir, materialsPaths, productsPaths, args, key, []string{"sha256"}, exclude, lStripPaths, lineNormalization, followSymlinkDirs, useDSSE)
+	ctx := cmd.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	metadata, err := intoto.InTotoRunContext(ctx, stepName, runDir, materialsPaths, productsPaths, args, key, []string{"sha256"}, exclude, lStripPaths, lineNormalization, followSymlinkDirs, useDSSE)
 	if err != nil {
 		return fmt.Errorf("failed to create link metadata: %w", err)
 	}
@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"path"
+	"strings"
+	"time"
 
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/spf13/cobra"
@@ -11,7 +15,25 @@ import (
 var (
 	pubKeyPaths       []string
 	linkDir           string
+	linkArchive       string
 	intermediatePaths []string
+	reportFormat      string
+	inspectionTimeout time.Duration
+	verificationTime  string
+	parallelism       int
+	tolerateDissent   bool
+	dryRun            bool
+	sandboxInspect    bool
+	scratchInspect    bool
+	inspectionLinkDir string
+	explainItem       string
+	enforceCommands   bool
+	evidencePath      string
+	sublayoutLinkDirs map[string]string
+	maxSublayoutDepth int
+	paramValues       []string
+	paramFile         string
+	manifestDir       string
 )
 
 var verifyCmd = &cobra.Command{
@@ -57,6 +79,16 @@ the root layout should be loaded from. If not passed links are
 loaded from the current working directory.`,
 	)
 
+	verifyCmd.Flags().StringVar(
+		&linkArchive,
+		"link-archive",
+		"",
+		`Path to a tar (.tar, .tar.gz, .tgz) or zip (.zip) archive, from
+where link metadata files should be loaded instead of from the
+link directory. The archive must have the same structure as the
+link directory.`,
+	)
+
 	verifyCmd.Flags().StringSliceVarP(
 		&intermediatePaths,
 		"intermediate-certs",
@@ -69,6 +101,15 @@ addition to any intermediates in the layout.`,
 
 	verifyCmd.MarkFlagRequired("layout")
 	verifyCmd.MarkFlagRequired("layout-keys")
+	verifyCmd.MarkFlagsMutuallyExclusive("link-dir", "link-archive")
+
+	verifyCmd.Flags().StringVar(
+		&manifestDir,
+		"manifest-dir",
+		"",
+		`Directory to load the manifests of MATCH-DIGEST rules from.
+Defaults to the current working directory.`,
+	)
 
 	verifyCmd.Flags().BoolVar(
 		&lineNormalization,
@@ -78,6 +119,156 @@ addition to any intermediates in the layout.`,
 operating systems. It is done by replacing all line separators
 with a new line character.`,
 	)
+
+	verifyCmd.Flags().DurationVar(
+		&inspectionTimeout,
+		"inspection-timeout",
+		0,
+		`Maximum duration of each inspection, e.g. '10m'. An inspection,
+whose command does not exit in time, is killed and verification
+fails. By default there is no timeout.`,
+	)
+
+	verifyCmd.Flags().IntVar(
+		&parallelism,
+		"parallelism",
+		1,
+		`Maximum number of links that are loaded and whose signatures are
+verified concurrently. Use 0 for the number of available CPUs.`,
+	)
+
+	verifyCmd.Flags().BoolVar(
+		&tolerateDissent,
+		"tolerate-dissenting-links",
+		false,
+		`Pass steps, for which at least threshold links report the same
+artifacts, and ignore links that report different artifacts. By
+default all links for a step must report the same artifacts.`,
+	)
+
+	verifyCmd.Flags().StringToStringVar(
+		&sublayoutLinkDirs,
+		"sublayout-link-dir",
+		nil,
+		`Directory to load the links of a sublayout from, passed as
+'<path>=<dir>', where the path consists of the names of the steps
+that resolve to sublayouts joined by '/', e.g. 'build/compile'.
+By default, the links of a sublayout are loaded from the
+subdirectory '<step name>.<keyid prefix>' of the superlayout's
+link directory.`,
+	)
+
+	verifyCmd.Flags().StringArrayVar(
+		&paramValues,
+		"param",
+		[]string{},
+		`Parameter to substitute in the layout, passed as '<key>=<value>'.
+The flag can be repeated. Values passed with '--param' take
+precedence over values from '--param-file'.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&paramFile,
+		"param-file",
+		"",
+		`Path to a file with parameters to substitute in the layout, either
+a JSON object with string values, if the path ends with '.json', or one
+'<key>=<value>' pair per line otherwise. Empty lines and lines starting
+with '#' are ignored.`,
+	)
+
+	verifyCmd.Flags().IntVar(
+		&maxSublayoutDepth,
+		"max-sublayout-depth",
+		intoto.DefaultMaxSublayoutDepth,
+		`Maximum number of nested sublayouts.`,
+	)
+
+	verifyCmd.Flags().BoolVar(
+		&enforceCommands,
+		"enforce-command-alignment",
+		false,
+		`Fail steps, whose links report a command that does not align with
+the expected command of the step, unless the layout or the step
+configure a different command alignment mode. By default only a
+warning is issued.`,
+	)
+
+	verifyCmd.Flags().BoolVar(
+		&sandboxInspect,
+		"sandbox-inspections",
+		false,
+		`Run inspection commands in a sandbox without network access,
+with a read-only file system, a private /tmp, a filtered environment and
+resource limits. Only supported on Linux with unprivileged user namespaces.`,
+	)
+
+	verifyCmd.Flags().BoolVar(
+		&scratchInspect,
+		"scratch-inspections",
+		false,
+		`Run each inspection in a temporary copy of the current working
+directory, which is left untouched.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&inspectionLinkDir,
+		"inspection-link-dir",
+		"",
+		`Directory to write the unsigned links of inspections to. Defaults
+to the current working directory. An inspection fails if its link cannot be
+written to the directory.`,
+	)
+
+	verifyCmd.Flags().BoolVar(
+		&dryRun,
+		"dry-run",
+		false,
+		`Perform all signature, threshold and step artifact rule checks,
+but do not run inspections. Instead, print the inspections that
+would have been run together with their artifact rules.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&explainItem,
+		"explain",
+		"",
+		`Name of a step or inspection, for which to print how each artifact
+rule was applied, i.e. the queued, filtered and consumed artifacts.
+Items of sublayouts are prefixed with the path of the sublayout,
+e.g. 'sublayout/step'.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&evidencePath,
+		"evidence-graph",
+		"",
+		`Write the evidence graph of the verification, i.e. the accepted
+links of each step, their signers, sublayouts and MATCH rule
+sources, to the passed path. The graph is written in DOT format,
+if the path ends with '.dot', and as JSON otherwise. The graph is
+written regardless of the verification result.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&verificationTime,
+		"at",
+		"",
+		`Verify the supply chain as of the passed point in time in RFC3339
+format, e.g. '2024-01-02T15:04:05Z', instead of the current time.
+Used for the layout expiration check and the validity checks of
+functionary certificates.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&reportFormat,
+		"report",
+		"",
+		`Write a verification report to standard output, listing the
+outcome of each verification phase, step and inspection. The
+report is written regardless of the verification result.
+Supported formats: json`,
+	)
 }
 
 func verify(cmd *cobra.Command, args []string) error {
@@ -108,10 +299,202 @@ func verify(cmd *cobra.Command, args []string) error {
 		intermediatePems = append(intermediatePems, pemBytes)
 	}
 
-	_, err = intoto.InTotoVerify(layoutMb, layoutKeys, linkDir, "", make(map[string]string), intermediatePems, lineNormalization)
+	if reportFormat != "" && reportFormat != "json" {
+		return fmt.Errorf("unsupported report format '%s'", reportFormat)
+	}
+
+	linkSource := intoto.LinkSource(intoto.NewDirectoryLinkSource(linkDir))
+	if linkArchive != "" {
+		linkSource, err = intoto.NewArchiveLinkSource(linkArchive)
+		if err != nil {
+			return fmt.Errorf("failed to load link archive %s: %w", linkArchive, err)
+		}
+	}
+
+	parameters, err := loadParameters(paramFile, paramValues)
+	if err != nil {
+		return err
+	}
+
+	opts := []intoto.VerifyOption{
+		intoto.WithLinkSource(linkSource),
+		intoto.WithIntermediates(intermediatePems),
+		intoto.WithLineNormalization(lineNormalization),
+		intoto.WithInspectionTimeout(inspectionTimeout),
+		intoto.WithParallelism(parallelism),
+		intoto.WithInspectionLinkDir(inspectionLinkDir),
+		intoto.WithMaxSublayoutDepth(maxSublayoutDepth),
+		intoto.WithParameters(parameters),
+		intoto.WithManifestDir(manifestDir),
+	}
+	for sublayoutPath, dir := range sublayoutLinkDirs {
+		opts = append(opts, intoto.WithSublayoutLinkSource(sublayoutPath,
+			intoto.NewDirectoryLinkSource(dir)))
+	}
+	var traces []intoto.RuleTrace
+	if explainItem != "" {
+		opts = append(opts, intoto.WithRuleTracer(func(trace intoto.RuleTrace) {
+			if path.Join(trace.Sublayout, trace.Item) == explainItem {
+				traces = append(traces, trace)
+			}
+		}))
+	}
+	if scratchInspect {
+		opts = append(opts, intoto.WithScratchRunDir())
+	}
+	if sandboxInspect {
+		opts = append(opts, intoto.WithInspectionRunner(intoto.NewSandboxInspectionRunner()))
+	}
+	if dryRun {
+		opts = append(opts, intoto.WithDryRun())
+	}
+	if enforceCommands {
+		opts = append(opts, intoto.WithCommandAlignmentPolicy(
+			intoto.CommandAlignmentPolicy{Mode: intoto.CommandAlignmentEnforce}))
+	}
+	if tolerateDissent {
+		opts = append(opts, intoto.WithLinkAgreementPolicy(intoto.ThresholdLinksAgree))
+	}
+	if verificationTime != "" {
+		at, err := time.Parse(time.RFC3339, verificationTime)
+		if err != nil {
+			return fmt.Errorf("invalid verification time %s: %w", verificationTime, err)
+		}
+		opts = append(opts, intoto.WithVerificationTime(at))
+	}
+
+	verifier := intoto.NewVerifier(opts...)
+	report, err := verifier.Verify(cmd.Context(), layoutMb, layoutKeys)
+	if explainItem != "" {
+		printRuleTraces(explainItem, traces)
+	}
+	if evidencePath != "" {
+		if evidenceErr := writeEvidenceGraph(report.Evidence, evidencePath); evidenceErr != nil {
+			return evidenceErr
+		}
+	}
+	if reportFormat == "json" {
+		if reportErr := writeJSONReport(report); reportErr != nil {
+			return reportErr
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("inspection failed: %w", err)
 	}
+	if dryRun && reportFormat == "" {
+		printPlannedInspections(report.PlannedInspections)
+	}
 
 	return nil
 }
+
+// loadParameters merges the parameters from the passed file, if any, and the
+// passed '<key>=<value>' pairs, which take precedence.
+func loadParameters(path string, values []string) (map[string]string, error) {
+	parameters := map[string]string{}
+	if path != "" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read parameter file %s: %w", path, err)
+		}
+		if strings.HasSuffix(path, ".json") {
+			if err := json.Unmarshal(contents, &parameters); err != nil {
+				return nil, fmt.Errorf("invalid parameter file %s: %w", path, err)
+			}
+		} else {
+			for i, line := range strings.Split(string(contents), "\n") {
+				line = strings.TrimSpace(line)
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+				key, value, ok := strings.Cut(line, "=")
+				if !ok {
+					return nil, fmt.Errorf("invalid parameter in %s, line %d: expected"+
+						" '<key>=<value>'", path, i+1)
+				}
+				parameters[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+
+	for _, param := range values {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid parameter '%s': expected '<key>=<value>'", param)
+		}
+		parameters[key] = value
+	}
+	return parameters, nil
+}
+
+func printRuleTraces(itemName string, traces []intoto.RuleTrace) {
+	if len(traces) == 0 {
+		fmt.Printf("No artifact rules were applied for '%s'\n", itemName)
+		return
+	}
+	fmt.Printf("Artifact rules of %s '%s':\n", strings.ToLower(traces[0].ItemType), itemName)
+	artifactType := ""
+	for _, trace := range traces {
+		if trace.ArtifactType != artifactType {
+			artifactType = trace.ArtifactType
+			fmt.Printf("  %s:\n", artifactType)
+		}
+		fmt.Printf("    %s\n", strings.Join(trace.Rule, " "))
+		fmt.Printf("      queue:     %s\n", joinArtifacts(trace.Queue))
+		fmt.Printf("      filtered:  %s\n", joinArtifacts(trace.Filtered))
+		fmt.Printf("      consumed:  %s\n", joinArtifacts(trace.Consumed))
+		fmt.Printf("      remaining: %s\n", joinArtifacts(trace.Remaining))
+		if trace.Err != nil {
+			fmt.Printf("      FAILED: %s\n", trace.Err)
+		}
+	}
+}
+
+func joinArtifacts(artifacts []string) string {
+	if len(artifacts) == 0 {
+		return "(none)"
+	}
+	return strings.Join(artifacts, ", ")
+}
+
+func printPlannedInspections(inspections []intoto.PlannedInspection) {
+	fmt.Println("Dry run, skipped the following inspections:")
+	for _, inspection := range inspections {
+		fmt.Printf("  %s: %s\n", inspection.Name, strings.Join(inspection.Run, " "))
+		for _, rule := range inspection.ExpectedMaterials {
+			fmt.Printf("    material rule: %s\n", strings.Join(rule, " "))
+		}
+		for _, rule := range inspection.ExpectedProducts {
+			fmt.Printf("    product rule: %s\n", strings.Join(rule, " "))
+		}
+	}
+}
+
+func writeJSONReport(report *intoto.VerificationReport) error {
+	jsonBytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize verification report: %w", err)
+	}
+	fmt.Println(string(jsonBytes))
+	return nil
+}
+
+func writeEvidenceGraph(graph *intoto.EvidenceGraph, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create evidence graph %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(path, ".dot") {
+		err = graph.WriteDOT(f)
+	} else {
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(graph)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write evidence graph %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -4,6 +4,9 @@ import (
 	"crypto/x509"
 	"fmt"
 	"net/url"
+	"sort"
+	"strings"
+	"time"
 )
 
 const (
@@ -58,12 +61,18 @@ func (cr *checkResult) error() error {
 // Check tests the provided certificate against the constraint. An error is returned if the certificate
 // fails any of the constraints. nil is returned if the certificate passes all of the constraints.
 func (cc CertificateConstraint) Check(cert *x509.Certificate, rootCAIDs []string, rootCertPool, intermediateCertPool *x509.CertPool) error {
+	return cc.CheckAt(cert, rootCAIDs, rootCertPool, intermediateCertPool, time.Time{})
+}
+
+// CheckAt provides the same functionality as Check, but verifies the certificate's chain of trust
+// at the provided point in time. A zero time means the current time.
+func (cc CertificateConstraint) CheckAt(cert *x509.Certificate, rootCAIDs []string, rootCertPool, intermediateCertPool *x509.CertPool, at time.Time) error {
 	return newCheckResult().
 		evaluate(cert, cc.checkCommonName).
 		evaluate(cert, cc.checkDNSNames).
 		evaluate(cert, cc.checkEmails).
 		evaluate(cert, cc.checkOrganizations).
-		evaluate(cert, cc.checkRoots(rootCAIDs, rootCertPool, intermediateCertPool)).
+		evaluate(cert, cc.checkRoots(rootCAIDs, rootCertPool, intermediateCertPool, at)).
 		evaluate(cert, cc.checkURIs).
 		error()
 }
@@ -90,9 +99,9 @@ func (cc CertificateConstraint) checkOrganizations(cert *x509.Certificate) error
 
 // checkRoots verifies that the certificate's roots matches the constraint.
 // The certificates trust chain must also be verified.
-func (cc CertificateConstraint) checkRoots(rootCAIDs []string, rootCertPool, intermediateCertPool *x509.CertPool) func(*x509.Certificate) error {
+func (cc CertificateConstraint) checkRoots(rootCAIDs []string, rootCertPool, intermediateCertPool *x509.CertPool, at time.Time) func(*x509.Certificate) error {
 	return func(cert *x509.Certificate) error {
-		_, err := VerifyCertificateTrust(cert, rootCertPool, intermediateCertPool)
+		_, err := VerifyCertificateTrustAt(cert, rootCertPool, intermediateCertPool, at)
 		if err != nil {
 			return fmt.Errorf("failed to verify roots: %w", err)
 		}
@@ -154,3 +163,29 @@ func checkCertConstraint(attributeName string, constraints, values []string) err
 
 	return nil
 }
+
+// certificateIdentity returns the passed identity of the certificate, i.e. its sorted
+// URIs or emails joined by commas, or its common name, prefixed with the identity type.
+// An error is returned if the certificate has no such identity.
+func certificateIdentity(cert *x509.Certificate, identity FunctionaryIdentity) (string, error) {
+	var values []string
+	switch identity {
+	case IdentityURI:
+		for _, uri := range cert.URIs {
+			values = append(values, uri.String())
+		}
+	case IdentityEmail:
+		values = append(values, cert.EmailAddresses...)
+	case IdentityCommonName:
+		if cert.Subject.CommonName != "" {
+			values = append(values, cert.Subject.CommonName)
+		}
+	default:
+		return "", fmt.Errorf("unsupported certificate identity '%s'", identity)
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("certificate has no %s identity", identity)
+	}
+	sort.Strings(values)
+	return string(identity) + ":" + strings.Join(values, ","), nil
+}
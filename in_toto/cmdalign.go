@@ -0,0 +1,178 @@
+package in_toto
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+/*
+CommandAlignmentMode configures how a step is treated, whose links report a
+command that does not align with the expected command of the step.
+*/
+type CommandAlignmentMode string
+
+const (
+	// CommandAlignmentWarn issues a warning for misaligned commands (default)
+	CommandAlignmentWarn CommandAlignmentMode = "warn"
+	// CommandAlignmentIgnore does not check command alignment
+	CommandAlignmentIgnore CommandAlignmentMode = "ignore"
+	// CommandAlignmentEnforce fails the step, if a command is misaligned
+	CommandAlignmentEnforce CommandAlignmentMode = "enforce"
+)
+
+/*
+CommandMatchMode configures how the expected command of a step is compared
+to the command reported by a link.
+*/
+type CommandMatchMode string
+
+const (
+	// CommandMatchExact requires the commands to be equal (default)
+	CommandMatchExact CommandMatchMode = "exact"
+	// CommandMatchGlob requires both commands to have the same number of
+	// arguments, where each expected argument is a pattern that must match the
+	// reported argument, e.g. "go build -o *".  Patterns use the syntax of
+	// artifact rules, i.e. "*" also matches "/".
+	CommandMatchGlob CommandMatchMode = "glob"
+	// CommandMatchPrefix requires the expected arguments to be equal to the
+	// leading arguments of the reported command, e.g. "go build" aligns with
+	// "go build -o foo ./...".
+	CommandMatchPrefix CommandMatchMode = "prefix"
+)
+
+/*
+CommandAlignmentPolicy configures the command alignment check of steps.  It
+can be set for a whole layout and for individual steps, where the step's
+policy takes precedence.  Empty fields fall back to the layout's policy, then
+to the default policy of the Verifier, see WithCommandAlignmentPolicy, and
+finally to CommandAlignmentWarn and CommandMatchExact.
+*/
+type CommandAlignmentPolicy struct {
+	Mode  CommandAlignmentMode `json:"mode,omitempty"`
+	Match CommandMatchMode     `json:"match,omitempty"`
+}
+
+/*
+CommandAlignmentError is returned, if the command reported by a link does not
+align with the expected command of a step, whose command alignment is
+enforced.
+*/
+type CommandAlignmentError struct {
+	Step     string
+	Link     string
+	Match    CommandMatchMode
+	Expected []string
+	Executed []string
+}
+
+func (e *CommandAlignmentError) Error() string {
+	return fmt.Sprintf("expected command for step '%s' (%s) and command"+
+		" reported by '%s' (%s) don't align (%s match)", e.Step,
+		strings.Join(e.Expected, " "), e.Link, strings.Join(e.Executed, " "),
+		e.Match)
+}
+
+/*
+resolveCommandAlignmentPolicy returns the effective policy for the passed
+step, where the fields of the step's policy take precedence over those of the
+layout's policy, which take precedence over the passed default policy.
+*/
+func resolveCommandAlignmentPolicy(layout Layout, step Step,
+	defaultPolicy CommandAlignmentPolicy) CommandAlignmentPolicy {
+	policy := CommandAlignmentPolicy{
+		Mode:  CommandAlignmentWarn,
+		Match: CommandMatchExact,
+	}
+	for _, p := range []*CommandAlignmentPolicy{&defaultPolicy,
+		layout.CommandAlignment, step.CommandAlignment} {
+		if p == nil {
+			continue
+		}
+		if p.Mode != "" {
+			policy.Mode = p.Mode
+		}
+		if p.Match != "" {
+			policy.Match = p.Match
+		}
+	}
+	return policy
+}
+
+/*
+commandAligns returns true if the executed command aligns with the expected
+command according to the passed match mode.  An error is returned for an
+unknown match mode or a malformed pattern.
+*/
+func commandAligns(mode CommandMatchMode, expected []string,
+	executed []string) (bool, error) {
+	switch mode {
+	case CommandMatchExact:
+		return slices.Equal(expected, executed), nil
+	case CommandMatchPrefix:
+		if len(executed) < len(expected) {
+			return false, nil
+		}
+		for i, arg := range expected {
+			if executed[i] != arg {
+				return false, nil
+			}
+		}
+		return true, nil
+	case CommandMatchGlob:
+		if len(executed) != len(expected) {
+			return false, nil
+		}
+		for i, pattern := range expected {
+			matched, err := match(pattern, executed[i])
+			if err != nil {
+				return false, fmt.Errorf("%w: %s", err, pattern)
+			}
+			if !matched {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid command match mode '%s'", mode)
+}
+
+/*
+validateCommandAlignmentPolicy ensures that the passed policy, which may be
+nil, only uses known modes.
+*/
+func validateCommandAlignmentPolicy(policy *CommandAlignmentPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	switch policy.Mode {
+	case "", CommandAlignmentWarn, CommandAlignmentIgnore, CommandAlignmentEnforce:
+	default:
+		return fmt.Errorf("invalid command alignment mode '%s'", policy.Mode)
+	}
+	switch policy.Match {
+	case "", CommandMatchExact, CommandMatchPrefix, CommandMatchGlob:
+	default:
+		return fmt.Errorf("invalid command match mode '%s'", policy.Match)
+	}
+	return nil
+}
+
+/*
+validateExpectedCommandPatterns ensures that the expected command of the
+passed step consists of valid patterns, if the step's or the layout's policy
+matches commands as glob.
+*/
+func validateExpectedCommandPatterns(layout Layout, step Step) error {
+	policy := resolveCommandAlignmentPolicy(layout, step, CommandAlignmentPolicy{})
+	if policy.Match != CommandMatchGlob {
+		return nil
+	}
+	for _, pattern := range step.ExpectedCommand {
+		if _, err := match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid expected command pattern '%s' for"+
+				" step '%s': %w", pattern, step.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package in_toto
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+ThresholdError is returned, if fewer than the required number of links were
+found for a step, or if fewer than the required number of links carry a valid
+signature from an authorized functionary.  In the latter case Err holds the
+reason for rejecting a link.
+*/
+type ThresholdError struct {
+	Step      string
+	Threshold int
+	// Number of links that count towards the threshold
+	Found int
+	// Number of links that were loaded for the step
+	Available int
+	Err       error
+}
+
+func (e *ThresholdError) Error() string {
+	if e.Err == nil {
+		if e.Available > e.Found {
+			return fmt.Sprintf("step '%s' requires '%d' link metadata file(s),"+
+				" found '%d' out of '%d' loaded link(s) with a signature"+
+				" matching their filename", e.Step, e.Threshold, e.Found, e.Available)
+		}
+		return fmt.Sprintf("step '%s' requires '%d' link metadata file(s),"+
+			" found '%d'", e.Step, e.Threshold, e.Found)
+	}
+	return fmt.Sprintf("step '%s' requires '%d' link metadata file(s)."+
+		" '%d' out of '%d' available link(s) have a valid signature from an"+
+		" authorized signer: %v", e.Step, e.Threshold, e.Found, e.Available,
+		e.Err)
+}
+
+func (e *ThresholdError) Unwrap() error {
+	return e.Err
+}
+
+/*
+ArtifactRuleFailure names the reason why an artifact rule failed, see
+ArtifactRuleError.
+*/
+type ArtifactRuleFailure string
+
+const (
+	// Artifacts match a DISALLOW rule
+	FailureDisallowed ArtifactRuleFailure = "disallowed"
+	// Artifacts required by a REQUIRE, REQUIRE-ANY or REQUIRE-ALL-OF rule are
+	// missing
+	FailureMissing ArtifactRuleFailure = "missing"
+	// The artifact required by a REQUIRE rule lacks the pinned digest
+	FailureDigestMismatch ArtifactRuleFailure = "digest-mismatch"
+	// The number of artifacts does not satisfy an EXPECT-COUNT rule
+	FailureCountMismatch ArtifactRuleFailure = "count-mismatch"
+)
+
+/*
+ArtifactRuleError is returned, if the materials or products of a step or
+inspection don't satisfy an artifact rule.  ItemType is either "Step" or
+"Inspection", ArtifactType is either "materials" or "products".  Rule holds
+the tokens of the rule as found in the layout and ParsedRule the rule as
+parsed by ParseRule.  Reason tells why the rule failed.  Paths holds the
+offending artifact paths, i.e. the paths disallowed by a DISALLOW rule, the
+path missing, or lacking the pinned digest, for a REQUIRE rule, the patterns
+without matching artifacts for a REQUIRE-ALL-OF rule, or the counted paths for
+an EXPECT-COUNT rule.  Queue holds the artifacts that were not yet consumed
+when the rule was applied, sorted by path.
+*/
+type ArtifactRuleError struct {
+	ItemType     string
+	Item         string
+	Rule         []string
+	ParsedRule   ArtifactRule
+	Reason       ArtifactRuleFailure
+	ArtifactType string
+	Paths        []string
+	Queue        []string
+}
+
+func (e *ArtifactRuleError) Error() string {
+	switch r := e.ParsedRule.(type) {
+	case RequireAnyRule:
+		return fmt.Sprintf("artifact verification failed for %s '%s', no %s"+
+			" match rule %s", e.ItemType, e.Item, e.ArtifactType, e.Rule)
+	case RequireAllOfRule:
+		return fmt.Sprintf("artifact verification failed for %s '%s', no %s"+
+			" match %s required by rule %s", e.ItemType, e.Item, e.ArtifactType,
+			e.Paths, e.Rule)
+	case ExpectCountRule:
+		return fmt.Sprintf("artifact verification failed for %s '%s', %d %s"+
+			" %s match rule %s", e.ItemType, e.Item, len(e.Paths), e.ArtifactType,
+			e.Paths, e.Rule)
+	case RequireRule:
+		if e.Reason == FailureDigestMismatch {
+			return fmt.Sprintf("artifact verification failed for %s in REQUIRE"+
+				" '%s', because its %s digest is not %s", e.ArtifactType,
+				r.Filename, r.Algorithm, r.Digest)
+		}
+		return fmt.Sprintf("artifact verification failed for %s in REQUIRE '%s',"+
+			" because it is not in %s", e.ArtifactType,
+			strings.Join(e.Paths, ", "), e.Queue)
+	}
+	return fmt.Sprintf("artifact verification failed for %s '%s',"+
+		" %s %s disallowed by rule %s", e.ItemType, e.Item, e.ArtifactType,
+		e.Paths, e.Rule)
+}
+
+// LayoutExpiredError is returned, if a layout has expired.
+type LayoutExpiredError struct {
+	Expires time.Time
+}
+
+func (e *LayoutExpiredError) Error() string {
+	return fmt.Sprintf("layout has expired on '%s'", e.Expires)
+}
+
+/*
+SignatureError is returned, if the signature of a layout, or of a link of the
+passed step, could not be verified with the key or certificate identified by
+KeyID.  Step is empty for layout signatures.  Err holds the underlying reason.
+*/
+type SignatureError struct {
+	Step  string
+	KeyID string
+	Err   error
+}
+
+func (e *SignatureError) Error() string {
+	if e.Step == "" {
+		return fmt.Sprintf("invalid layout signature for key '%s': %s",
+			e.KeyID, e.Err)
+	}
+	return fmt.Sprintf("invalid signature for link of step '%s' by key '%s': %s",
+		e.Step, e.KeyID, e.Err)
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+/*
+InspectionFailedError is returned, if the command of an inspection could not be
+executed, in which case Err holds the reason, or if it returned a non-zero
+value.
+*/
+type InspectionFailedError struct {
+	Inspection  string
+	Command     []string
+	ReturnValue int
+	Err         error
+}
+
+func (e *InspectionFailedError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("inspection command '%s' of inspection '%s'"+
+			" failed: %s", e.Command, e.Inspection, e.Err)
+	}
+	return fmt.Sprintf("inspection command '%s' of inspection '%s'"+
+		" returned a non-zero value: %d", e.Command, e.Inspection,
+		e.ReturnValue)
+}
+
+func (e *InspectionFailedError) Unwrap() error {
+	return e.Err
+}
+
+/*
+VerificationFailure wraps an error that caused a step or inspection to fail
+during the passed verification phase.  Verification failures are collected in
+VerificationErrors, if verification is configured to collect all failures,
+see WithCollectAllFailures.
+*/
+type VerificationFailure struct {
+	Phase VerificationPhase
+	Item  string
+	Err   error
+}
+
+func (f *VerificationFailure) Error() string {
+	return fmt.Sprintf("%s: '%s': %s", f.Phase, f.Item, f.Err)
+}
+
+func (f *VerificationFailure) Unwrap() error {
+	return f.Err
+}
+
+/*
+VerificationErrors is returned by the verification workflow, if it is
+configured to collect all failures, see WithCollectAllFailures, and at least
+one step or inspection failed.  Each failure can be inspected using errors.As,
+either on the entries of Errors or on the VerificationErrors itself, which
+unwraps to all of its failures.
+*/
+type VerificationErrors struct {
+	Errors []error
+}
+
+func (e *VerificationErrors) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, "\t"+err.Error())
+	}
+	return fmt.Sprintf("verification failed with %d error(s):\n%s",
+		len(e.Errors), strings.Join(msgs, "\n"))
+}
+
+func (e *VerificationErrors) Unwrap() []error {
+	return e.Errors
+}
@@ -0,0 +1,123 @@
+package in_toto
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerificationErrorTypes(t *testing.T) {
+	mb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := mb.GetPayload().(Layout)
+
+	t.Run("layout expired", func(t *testing.T) {
+		layout := layout
+		layout.Expires = "1970-01-01T00:00:00Z"
+		err := VerifyLayoutExpiration(layout)
+		var expiredErr *LayoutExpiredError
+		if assert.True(t, errors.As(err, &expiredErr)) {
+			assert.Equal(t, 1970, expiredErr.Expires.Year())
+		}
+	})
+
+	t.Run("layout signature", func(t *testing.T) {
+		keyID := "b7d643dec0a051096ee5d87221b5d91a33daa658699d30903e1cefb90c418401"
+		err := VerifyLayoutSignatures(mb, map[string]Key{keyID: {KeyID: keyID}})
+		var sigErr *SignatureError
+		if assert.True(t, errors.As(err, &sigErr)) {
+			assert.Equal(t, keyID, sigErr.KeyID)
+			assert.Empty(t, sigErr.Step)
+		}
+	})
+
+	t.Run("threshold", func(t *testing.T) {
+		_, err := LoadLinksForLayout(layout, "does-not-exist")
+		var thresholdErr *ThresholdError
+		if assert.True(t, errors.As(err, &thresholdErr)) {
+			assert.Equal(t, "write-code", thresholdErr.Step)
+			assert.Equal(t, 1, thresholdErr.Threshold)
+			assert.Equal(t, 0, thresholdErr.Found)
+		}
+
+		// A loaded link without a signature matching its name is not counted
+		step := Step{SupplyChainItem: SupplyChainItem{Name: "foo"}, Threshold: 1}
+		source := NewMemoryLinkSource()
+		source.AddLink("foo", "deadbeef", &Metablock{Signed: Link{Name: "foo"},
+			Signatures: []Signature{{KeyID: "abcdef"}}})
+		_, _, err = loadLinksForStep(step, source)
+		if assert.True(t, errors.As(err, &thresholdErr)) {
+			assert.Equal(t, 0, thresholdErr.Found)
+			assert.Equal(t, 1, thresholdErr.Available)
+			assert.Contains(t, thresholdErr.Error(), "found '0' out of '1'")
+		}
+	})
+
+	t.Run("artifact rule", func(t *testing.T) {
+		rule := []string{"DISALLOW", "*.py"}
+		step := Step{SupplyChainItem: SupplyChainItem{Name: "foo",
+			ExpectedProducts: [][]string{rule}}}
+		metadata := map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo",
+			Products: map[string]HashObj{
+				"foo.py":  {"sha256": "abc"},
+				"bar.txt": {"sha256": "abc"},
+			}}}}
+
+		err := VerifyArtifacts([]interface{}{step}, metadata)
+		var ruleErr *ArtifactRuleError
+		if assert.True(t, errors.As(err, &ruleErr)) {
+			assert.Equal(t, &ArtifactRuleError{
+				ItemType:     "Step",
+				Item:         "foo",
+				Rule:         rule,
+				ParsedRule:   DisallowRule{Pattern: "*.py"},
+				Reason:       FailureDisallowed,
+				ArtifactType: "products",
+				Paths:        []string{"foo.py"},
+				Queue:        []string{"bar.txt", "foo.py"},
+			}, ruleErr)
+		}
+
+		// REQUIRE tells missing artifacts from digest mismatches
+		digest := strings.Repeat("a", 64)
+		for _, table := range []struct {
+			filename string
+			reason   ArtifactRuleFailure
+			err      string
+		}{
+			{"foo.txt", FailureMissing, "because it is not in [bar.txt foo.py]"},
+			{"foo.py", FailureDigestMismatch, "because its sha256 digest is not " +
+				digest},
+		} {
+			step.ExpectedProducts = [][]string{
+				{"REQUIRE", table.filename, "WITH", "sha256", digest}}
+			err := VerifyArtifacts([]interface{}{step}, metadata)
+			if assert.True(t, errors.As(err, &ruleErr)) {
+				assert.Equal(t, table.reason, ruleErr.Reason)
+				assert.ErrorContains(t, err, table.err)
+			}
+		}
+	})
+
+	t.Run("inspection failed", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("requires sh")
+		}
+		layout := Layout{Inspect: []Inspection{{
+			SupplyChainItem: SupplyChainItem{Name: "foo"},
+			Run:             []string{"sh", "-c", "exit 3"},
+		}}}
+		_, err := RunInspections(layout, "", testOSisWindows(), false)
+		var inspectionErr *InspectionFailedError
+		if assert.True(t, errors.As(err, &inspectionErr)) {
+			assert.Equal(t, "foo", inspectionErr.Inspection)
+			assert.Equal(t, 3, inspectionErr.ReturnValue)
+			assert.Nil(t, inspectionErr.Err)
+		}
+	})
+}
@@ -0,0 +1,309 @@
+package in_toto
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+)
+
+/*
+EvidenceGraph records the evidence that backed a successful or failed
+verification, i.e. for each step the accepted links, their signers and
+sublayouts, and for each step and inspection the artifacts that were matched
+against other steps and inspections by MATCH rules, or against manifests by
+MATCH-DIGEST rules.  It is returned in the
+Evidence of the VerificationReport and can be serialized to JSON, or to DOT
+using WriteDOT, e.g. for audit archives.
+*/
+type EvidenceGraph struct {
+	Items []*ItemEvidence `json:"items"`
+}
+
+/*
+ItemEvidence records the evidence for a step or inspection.  Links are only
+recorded for steps, and only those links that count towards the threshold of
+the step.
+*/
+type ItemEvidence struct {
+	Name    string          `json:"name"`
+	Type    string          `json:"type"`
+	Links   []*LinkEvidence `json:"links,omitempty"`
+	Matches []MatchEvidence `json:"matches,omitempty"`
+}
+
+/*
+LinkEvidence records an accepted link.  Path is the path of the link file, or
+the name of the link file in Archive, if it was loaded from a link archive.
+Digest is computed over the bytes of the link file.  Path and Digest are only
+recorded, if the link source reports the origin of its links, see
+LinkOriginSource.  If the link was signed
+with a certificate, CertificateChain holds the PEM encoded chain of trust,
+starting with the signer's certificate.  If the link is a sublayout, Sublayout
+holds the evidence of the sublayout, whose summary link replaced the
+sublayout.
+*/
+type LinkEvidence struct {
+	Path             string         `json:"path,omitempty"`
+	Archive          string         `json:"archive,omitempty"`
+	Digest           HashObj        `json:"digest,omitempty"`
+	KeyID            string         `json:"keyid"`
+	CertificateChain []string       `json:"certificate_chain,omitempty"`
+	Sublayout        *EvidenceGraph `json:"sublayout,omitempty"`
+}
+
+/*
+MatchEvidence records a MATCH or MATCH-DIGEST rule, which was applied to the
+materials or products of a step or inspection, see ArtifactType, and the
+artifacts it matched in the materials or products of the Source step or
+inspection, or in the Manifest of a MATCH-DIGEST rule.  ManifestDigest holds
+the digest pinned by the rule, which the manifest was verified to have.
+*/
+type MatchEvidence struct {
+	ArtifactType   string   `json:"artifact_type"`
+	Rule           []string `json:"rule"`
+	Source         string   `json:"source,omitempty"`
+	Manifest       string   `json:"manifest,omitempty"`
+	ManifestDigest HashObj  `json:"manifest_digest,omitempty"`
+	Artifacts      []string `json:"artifacts"`
+}
+
+/*
+item returns the evidence for the passed step or inspection, creating it if it
+does not exist yet.
+*/
+func (g *EvidenceGraph) item(name string, itemType string) *ItemEvidence {
+	for _, item := range g.Items {
+		if item.Name == name {
+			return item
+		}
+	}
+	item := &ItemEvidence{Name: name, Type: itemType}
+	g.Items = append(g.Items, item)
+	return item
+}
+
+/*
+link returns the evidence for the link of the passed step signed by the passed
+key id, or nil if there is no such link.
+*/
+func (g *EvidenceGraph) link(stepName string, keyID string) *LinkEvidence {
+	for _, item := range g.Items {
+		if item.Name != stepName {
+			continue
+		}
+		for _, link := range item.Links {
+			if link.KeyID == keyID {
+				return link
+			}
+		}
+	}
+	return nil
+}
+
+/*
+WriteDOT writes the graph in the DOT language of Graphviz to w.  Steps and
+inspections are drawn as boxes, links as notes, manifests as folders and
+sublayouts as clusters.  Edges point from steps to their links and from steps
+and inspections to the sources of their MATCH rules and to the manifests of
+their MATCH-DIGEST rules.
+*/
+func (g *EvidenceGraph) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph evidence {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	clusters := 0
+	g.writeDOT(&sb, "", "  ", &clusters)
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+/*
+writeDOT writes the nodes and edges of the graph, whose node ids are prefixed
+with the passed prefix to keep the ids of sublayouts unique.
+*/
+func (g *EvidenceGraph) writeDOT(sb *strings.Builder, prefix string,
+	indent string, clusters *int) {
+	itemID := func(name string) string {
+		return strconv.Quote(prefix + "item:" + name)
+	}
+	for _, item := range g.Items {
+		fmt.Fprintf(sb, "%s%s [shape=box, label=%s];\n", indent,
+			itemID(item.Name), strconv.Quote(item.Type+" "+item.Name))
+		for _, link := range item.Links {
+			linkName := item.Name + "/" + link.KeyID
+			linkID := strconv.Quote(prefix + "link:" + linkName)
+			label := "keyid: " + link.KeyID
+			if link.Path != "" {
+				label = link.Path + "\n" + label
+				if link.Archive != "" {
+					label = link.Archive + ": " + label
+				}
+			}
+			if digest, ok := link.Digest["sha256"]; ok {
+				label += "\nsha256: " + digest
+			}
+			if len(link.CertificateChain) > 0 {
+				label += fmt.Sprintf("\ncertificate chain: %d certificate(s)",
+					len(link.CertificateChain))
+			}
+			fmt.Fprintf(sb, "%s%s [shape=note, label=%s];\n", indent, linkID,
+				strconv.Quote(label))
+			fmt.Fprintf(sb, "%s%s -> %s;\n", indent, itemID(item.Name), linkID)
+
+			if link.Sublayout != nil {
+				*clusters++
+				fmt.Fprintf(sb, "%ssubgraph cluster_%d {\n", indent, *clusters)
+				fmt.Fprintf(sb, "%s  label=%s;\n", indent,
+					strconv.Quote("sublayout "+linkName))
+				link.Sublayout.writeDOT(sb, prefix+linkName+"/", indent+"  ",
+					clusters)
+				fmt.Fprintf(sb, "%s}\n", indent)
+			}
+		}
+		for _, match := range item.Matches {
+			sourceID := itemID(match.Source)
+			if match.Manifest != "" {
+				sourceID = strconv.Quote(prefix + "manifest:" + match.Manifest)
+				label := match.Manifest
+				// The rule pins a single digest
+				for algorithm, digest := range match.ManifestDigest {
+					label += "\n" + algorithm + ": " + digest
+				}
+				fmt.Fprintf(sb, "%s%s [shape=folder, label=%s];\n", indent,
+					sourceID, strconv.Quote(label))
+			}
+			fmt.Fprintf(sb, "%s%s -> %s [style=dashed, label=%s];\n", indent,
+				itemID(item.Name), sourceID, strconv.Quote(
+					fmt.Sprintf("%s: %s", match.ArtifactType,
+						strings.Join(match.Artifacts, ", "))))
+		}
+	}
+}
+
+/*
+linkDigest returns the sha256 digest of the canonical JSON representation of
+the payload of the passed link.
+*/
+func linkDigest(linkEnv Metadata) (HashObj, error) {
+	linkBytes, err := cjson.EncodeCanonical(linkEnv.GetPayload())
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(linkBytes)
+	return HashObj{"sha256": hex.EncodeToString(digest[:])}, nil
+}
+
+/*
+recordLinkEvidence records the passed verified links of the steps of the
+passed layout in the evidence graph of the report.  For links signed with a
+certificate, the chain of trust at the passed point in time is recorded.
+Links that don't count towards the threshold of their step are removed once
+the links are reduced, see pruneLinkEvidence.
+*/
+func (v *verification) recordLinkEvidence(layout Layout,
+	stepsMetadataVerified map[string]map[string]Metadata,
+	rootCertPool, intermediateCertPool *x509.CertPool, at time.Time) {
+	if v.report == nil {
+		return
+	}
+	for _, step := range layout.Steps {
+		linksPerStep, ok := stepsMetadataVerified[step.Name]
+		if !ok {
+			continue
+		}
+		item := v.report.Evidence.item(step.Name, "step")
+		for _, keyID := range sortedKeyIDs(linksPerStep) {
+			linkEnv := linksPerStep[keyID]
+			link := &LinkEvidence{KeyID: keyID}
+			if origin, ok := v.linkOrigins[step.Name][keyID]; ok {
+				link.Path = origin.Path
+				link.Archive = origin.Archive
+				link.Digest = origin.Digest
+			}
+			cert, err := signerCertificate(layout, step, keyID, linkEnv)
+			if err == nil && cert != nil {
+				chains, err := VerifyCertificateTrustAt(cert, rootCertPool,
+					intermediateCertPool, at)
+				if err == nil {
+					for _, chainCert := range chains[0] {
+						link.CertificateChain = append(link.CertificateChain,
+							string(generatePEMBlock(chainCert.Raw, "CERTIFICATE")))
+					}
+				}
+			}
+			item.Links = append(item.Links, link)
+		}
+	}
+}
+
+/*
+pruneLinkEvidence removes the links of the passed step from the evidence graph
+of the report, which don't count towards the threshold of the step, i.e. the
+passed dissenting links and all but the first link of each functionary.
+*/
+func (v *verification) pruneLinkEvidence(stepName string, dissenting []string) {
+	if v.report == nil {
+		return
+	}
+	ignored := NewSet(dissenting...)
+	counted := NewSet()
+	for _, item := range v.report.Evidence.Items {
+		if item.Name != stepName {
+			continue
+		}
+		var links []*LinkEvidence
+		for _, link := range item.Links {
+			functionary, ok := v.identities[stepName][link.KeyID]
+			if !ok {
+				functionary = link.KeyID
+			}
+			if ignored.Has(link.KeyID) || counted.Has(functionary) {
+				continue
+			}
+			counted.Add(functionary)
+			links = append(links, link)
+		}
+		item.Links = links
+	}
+}
+
+/*
+recordMatchEvidence records the artifacts matched by the MATCH or MATCH-DIGEST
+rule of the passed trace in the evidence graph of the report.  Other and
+failed rules are ignored.
+*/
+func (r *VerificationReport) recordMatchEvidence(trace RuleTrace) {
+	if r == nil || trace.Err != nil {
+		return
+	}
+	parsed, err := ParseRule(trace.Rule)
+	if err != nil {
+		return
+	}
+	match := MatchEvidence{
+		ArtifactType: trace.ArtifactType,
+		Rule:         trace.Rule,
+		Artifacts:    trace.Consumed,
+	}
+	switch rule := parsed.(type) {
+	case MatchRule:
+		match.Source = rule.DestinationName
+	case MatchDigestRule:
+		// The manifest was verified to have the pinned digest, or the rule
+		// would have failed
+		match.Manifest = rule.Manifest
+		match.ManifestDigest = HashObj{rule.Algorithm: rule.Digest}
+	default:
+		return
+	}
+	item := r.Evidence.item(trace.Item, strings.ToLower(trace.ItemType))
+	item.Matches = append(item.Matches, match)
+}
@@ -0,0 +1,206 @@
+package in_toto
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+/*
+PatternDialect selects the syntax of the patterns in the artifact rules of a
+layout, see Layout.PatternDialect.
+*/
+type PatternDialect string
+
+const (
+	// PatternDialectLegacy is the default dialect, where "*" matches any
+	// sequence of characters including "/", see match.
+	PatternDialectLegacy PatternDialect = "legacy"
+	// PatternDialectGlobstar matches patterns segment by segment, where
+	// "*" matches any sequence of characters within a segment, "**" as a
+	// segment matches any number of segments, "{a,b}" matches either of the
+	// comma separated alternatives, and a leading "!" negates the pattern,
+	// e.g. "!src/**/*_test.go".
+	PatternDialectGlobstar PatternDialect = "globstar"
+)
+
+// patternMatcher reports whether name matches pattern
+type patternMatcher func(pattern, name string) (bool, error)
+
+/*
+matcher returns the function that matches patterns of the dialect.  Unknown
+dialects are rejected during layout validation.
+*/
+func (d PatternDialect) matcher() patternMatcher {
+	if d == PatternDialectGlobstar {
+		return matchGlobstar
+	}
+	return match
+}
+
+/*
+matchGlobstar reports whether name matches the pattern of the globstar
+dialect, see PatternDialectGlobstar.  Within a segment, the pattern syntax of
+path.Match applies.  The only possible returned error is errBadPattern.
+*/
+func matchGlobstar(pattern, name string) (bool, error) {
+	negated := strings.HasPrefix(pattern, "!")
+	if negated {
+		pattern = pattern[1:]
+	}
+	alternatives, err := expandBraces(pattern)
+	if err != nil {
+		return false, err
+	}
+	nameSegments := strings.Split(name, "/")
+	for _, alternative := range alternatives {
+		matched, err := matchSegments(strings.Split(alternative, "/"), nameSegments)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return !negated, nil
+		}
+	}
+	return negated, nil
+}
+
+/*
+matchSegments reports whether the name segments match the pattern segments,
+where a "**" pattern segment matches zero or more name segments.
+*/
+func matchSegments(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			for i := 0; i <= len(name); i++ {
+				matched, err := matchSegments(pattern, name[i:])
+				if err != nil || matched {
+					return matched, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		matched, err := path.Match(pattern[0], name[0])
+		if err != nil {
+			return false, errBadPattern
+		}
+		if !matched {
+			return false, nil
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+/*
+expandBraces returns the patterns that result from expanding all brace
+alternations in the passed pattern, e.g. "{a,b}/{c,d}" expands to "a/c",
+"a/d", "b/c" and "b/d".  Alternations may be nested.  Braces can be escaped
+with "\\" and are literal within character classes, as is a closing brace
+without an opening brace.
+*/
+func expandBraces(pattern string) ([]string, error) {
+	open := -1
+	depth := 0
+	var commas []int
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+		case inClass:
+			if c == ']' {
+				inClass = false
+			}
+		case c == '[':
+			inClass = true
+		case c == '{':
+			if depth == 0 {
+				open = i
+			}
+			depth++
+		case c == ',' && depth == 1:
+			commas = append(commas, i)
+		case c == '}' && depth > 0:
+			depth--
+			if depth > 0 {
+				continue
+			}
+			prefix, suffix := pattern[:open], pattern[i+1:]
+			var expanded []string
+			start := open + 1
+			for _, end := range append(commas, i) {
+				alternatives, err := expandBraces(prefix + pattern[start:end] + suffix)
+				if err != nil {
+					return nil, err
+				}
+				expanded = append(expanded, alternatives...)
+				start = end + 1
+			}
+			return expanded, nil
+		}
+	}
+	if depth > 0 {
+		return nil, errBadPattern
+	}
+	return []string{pattern}, nil
+}
+
+/*
+validateGlobstarPattern ensures that the passed pattern is a well-formed
+pattern of the globstar dialect.
+*/
+func validateGlobstarPattern(pattern string) error {
+	alternatives, err := expandBraces(strings.TrimPrefix(pattern, "!"))
+	if err != nil {
+		return err
+	}
+	for _, alternative := range alternatives {
+		for _, segment := range strings.Split(alternative, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return errBadPattern
+			}
+		}
+	}
+	return nil
+}
+
+/*
+validatePatternDialect ensures that the passed layout uses a known pattern
+dialect, and that the patterns of its artifact rules are well-formed in the
+globstar dialect.  Patterns of the legacy dialect are not validated to keep
+accepting existing layouts.
+*/
+func validatePatternDialect(layout Layout) error {
+	switch layout.PatternDialect {
+	case "", PatternDialectLegacy:
+		return nil
+	case PatternDialectGlobstar:
+	default:
+		return fmt.Errorf("invalid pattern dialect '%s'", layout.PatternDialect)
+	}
+
+	for _, item := range layout.supplyChainItems() {
+		for _, rules := range [][][]string{item.ExpectedMaterials, item.ExpectedProducts} {
+			for _, rule := range rules {
+				parsed, err := parseLayoutRule(rule)
+				if err != nil {
+					return err
+				}
+				for _, pattern := range parsed.Patterns() {
+					if err := validateGlobstarPattern(pattern); err != nil {
+						return fmt.Errorf("invalid pattern '%s' in rule of '%s': %w",
+							pattern, item.Name, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -3,7 +3,10 @@ package in_toto
 import (
 	"crypto/sha256"
 	"crypto/sha512"
+	"fmt"
 	"hash"
+	"reflect"
+	"strings"
 )
 
 /*
@@ -28,3 +31,211 @@ func hashToHex(h hash.Hash, data []byte) []byte {
 	// we would get: "dataHASH"
 	return h.Sum(nil)
 }
+
+/*
+hashStrengths maps hash algorithms to their security strength in bits against
+collision attacks according to NIST SP 800-57.  Algorithms with known
+collision attacks have a strength of zero.
+*/
+var hashStrengths = map[string]int{
+	"md5":        0,
+	"sha1":       0,
+	"sha224":     112,
+	"sha256":     128,
+	"sha384":     192,
+	"sha512":     256,
+	"sha512_224": 112,
+	"sha512_256": 128,
+	"sha3_224":   112,
+	"sha3_256":   128,
+	"sha3_384":   192,
+	"sha3_512":   256,
+}
+
+/*
+hashSizes maps the hash algorithms of hashStrengths to the length of their
+digests in bytes.
+*/
+var hashSizes = map[string]int{
+	"md5":        16,
+	"sha1":       20,
+	"sha224":     28,
+	"sha256":     32,
+	"sha384":     48,
+	"sha512":     64,
+	"sha512_224": 28,
+	"sha512_256": 32,
+	"sha3_224":   28,
+	"sha3_256":   32,
+	"sha3_384":   48,
+	"sha3_512":   64,
+}
+
+// DefaultMinimumHashStrength is the minimum strength in bits of the hash
+// algorithms MATCH rules rely on, unless the layout's HashPolicy configures
+// a different one.
+const DefaultMinimumHashStrength = 128
+
+/*
+HashPolicy configures which hash algorithms MATCH rules rely on, see
+Layout.HashPolicy.  With a policy, a MATCH rule matches two artifacts, if the
+digests of all hash algorithms recorded for both artifacts agree, and at least
+one of these algorithms is acceptable, i.e. listed in Algorithms and at least
+as strong as MinimumStrength.  If Algorithms is empty, all algorithms with a
+known strength are acceptable.  If MinimumStrength is zero,
+DefaultMinimumHashStrength is used.  Without a policy, a MATCH rule only
+matches two artifacts with equal hash objects.
+*/
+type HashPolicy struct {
+	Algorithms      []string `json:"algorithms,omitempty"`
+	MinimumStrength int      `json:"minimum_strength,omitempty"`
+}
+
+/*
+acceptable returns true if the policy, which may be nil, accepts the passed
+hash algorithm.
+*/
+func (p *HashPolicy) acceptable(algorithm string) bool {
+	strength, ok := hashStrengths[algorithm]
+	if !ok {
+		return false
+	}
+	minimumStrength := DefaultMinimumHashStrength
+	if p != nil {
+		if p.MinimumStrength != 0 {
+			minimumStrength = p.MinimumStrength
+		}
+		if len(p.Algorithms) > 0 && !NewSet(p.Algorithms...).Has(algorithm) {
+			return false
+		}
+	}
+	return strength >= minimumStrength
+}
+
+/*
+hashesAgree returns true if the passed hash objects of two artifacts agree
+according to the policy.  If the policy is nil, the hash objects must be
+equal.  Otherwise, see digestsAgree.
+*/
+func (p *HashPolicy) hashesAgree(a HashObj, b HashObj) bool {
+	if p == nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return p.digestsAgree(a, b)
+}
+
+/*
+digestsAgree returns true if the digests of all hash algorithms recorded in
+both passed hash objects agree, and at least one of them is acceptable
+according to the policy, which may be nil.  Digests pinned by REQUIRE and
+MATCH-DIGEST rules are always compared this way, because they usually pin a
+single algorithm.
+*/
+func (p *HashPolicy) digestsAgree(a HashObj, b HashObj) bool {
+	agree := false
+	for algorithm, digest := range a {
+		other, ok := b[algorithm]
+		if !ok {
+			continue
+		}
+		if !strings.EqualFold(digest, other) {
+			return false
+		}
+		agree = agree || p.acceptable(algorithm)
+	}
+	return agree
+}
+
+/*
+validateHashPolicy ensures that the passed policy, which may be nil, only
+lists hash algorithms of known strength, and accepts at least one of them.
+*/
+func validateHashPolicy(policy *HashPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.MinimumStrength < 0 {
+		return fmt.Errorf("invalid minimum hash strength %d",
+			policy.MinimumStrength)
+	}
+	algorithms := policy.Algorithms
+	if len(algorithms) == 0 {
+		for algorithm := range hashStrengths {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	acceptable := false
+	for _, algorithm := range algorithms {
+		if _, ok := hashStrengths[algorithm]; !ok {
+			return fmt.Errorf("unknown hash algorithm '%s'", algorithm)
+		}
+		acceptable = acceptable || policy.acceptable(algorithm)
+	}
+	if !acceptable {
+		return fmt.Errorf("hash policy accepts no algorithm of the minimum" +
+			" strength")
+	}
+	return nil
+}
+
+/*
+validatePinnedDigest ensures that the passed hash algorithm of a digest pinned
+by an artifact rule is known, and that the passed hex digest has the length of
+its digests.  Parameter placeholders are accepted, so that the digests of a
+layout can be validated before and after parameter substitution.
+*/
+func validatePinnedDigest(algorithm string, digest string) error {
+	if containsPlaceholder(algorithm) {
+		return nil
+	}
+	size, ok := hashSizes[algorithm]
+	if !ok {
+		return fmt.Errorf("unknown hash algorithm '%s'", algorithm)
+	}
+	if !containsPlaceholder(digest) && len(digest) != 2*size {
+		return fmt.Errorf("invalid %s digest '%s': expected %d hex characters",
+			algorithm, digest, 2*size)
+	}
+	return nil
+}
+
+/*
+validatePinnedDigests ensures that the digests pinned by the REQUIRE and
+MATCH-DIGEST rules of the steps and inspections of the passed layout are valid,
+see validatePinnedDigest, and that their hash algorithms are acceptable
+according to the layout's hash policy, which may be nil.  Otherwise the rules
+could never pass, see digestsAgree.  Layouts are validated before and after
+parameter substitution, see SubstituteParameters.
+*/
+func validatePinnedDigests(layout Layout) error {
+	for _, item := range layout.supplyChainItems() {
+		for _, rules := range [][][]string{item.ExpectedMaterials, item.ExpectedProducts} {
+			for _, rule := range rules {
+				parsed, err := parseLayoutRule(rule)
+				if err != nil {
+					return err
+				}
+				var algorithm, digest string
+				switch r := parsed.(type) {
+				case RequireRule:
+					algorithm, digest = r.Algorithm, r.Digest
+				case MatchDigestRule:
+					algorithm, digest = r.Algorithm, r.Digest
+				}
+				if digest == "" || containsPlaceholder(algorithm) {
+					continue
+				}
+				if err := validatePinnedDigest(algorithm, digest); err != nil {
+					return fmt.Errorf("invalid digest in rule %s of '%s': %w",
+						rule, item.Name, err)
+				}
+				if !layout.HashPolicy.acceptable(algorithm) {
+					return fmt.Errorf("hash algorithm '%s' in rule %s of '%s' is"+
+						" not acceptable by the hash policy", algorithm, rule,
+						item.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
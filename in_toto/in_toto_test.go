@@ -13,6 +13,9 @@ const testData = "../test/data"
 // This can be used for test setup and teardown, e.g. copy test data to a tmp
 // test dir, change to that dir and remove the and contents in the end
 func TestMain(m *testing.M) {
+	// Handle the re-executed test binary of TestSandboxInspectionRunner
+	SandboxMain()
+
 	testDir, err := os.MkdirTemp("", "in_toto_test_dir")
 	if err != nil {
 		panic("Cannot create temp test dir")
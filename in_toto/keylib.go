@@ -13,6 +13,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/secure-systems-lab/go-securesystemslib/cjson"
 )
@@ -450,9 +451,19 @@ to a root in rootCertPool, possibly using any intermediates in
 intermediateCertPool
 */
 func VerifyCertificateTrust(cert *x509.Certificate, rootCertPool, intermediateCertPool *x509.CertPool) ([][]*x509.Certificate, error) {
+	return VerifyCertificateTrustAt(cert, rootCertPool, intermediateCertPool, time.Time{})
+}
+
+/*
+VerifyCertificateTrustAt provides the same functionality as
+VerifyCertificateTrust, but checks the validity of the certificates in the
+chain at the passed point in time.  A zero time means the current time.
+*/
+func VerifyCertificateTrustAt(cert *x509.Certificate, rootCertPool, intermediateCertPool *x509.CertPool, at time.Time) ([][]*x509.Certificate, error) {
 	verifyOptions := x509.VerifyOptions{
 		Roots:         rootCertPool,
 		Intermediates: intermediateCertPool,
+		CurrentTime:   at,
 	}
 	chains, err := cert.Verify(verifyOptions)
 	if len(chains) == 0 || err != nil {
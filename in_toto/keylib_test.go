@@ -5,6 +5,7 @@ import (
 	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -203,4 +204,15 @@ func TestVerifyCertificateTrust(t *testing.T) {
 	// Test with no root
 	_, err = VerifyCertificateTrust(leafCert, x509.NewCertPool(), intermediatePool)
 	assert.NotNil(t, err, "expected error with missing root")
+
+	// Test at points in time within and outside of the validity period
+	_, err = VerifyCertificateTrustAt(leafCert, rootPool, intermediatePool,
+		time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err, "unexpected error verifying trust within validity period")
+	_, err = VerifyCertificateTrustAt(leafCert, rootPool, intermediatePool,
+		time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NotNil(t, err, "expected error before validity period")
+	_, err = VerifyCertificateTrustAt(leafCert, rootPool, intermediatePool,
+		time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NotNil(t, err, "expected error after validity period")
 }
@@ -0,0 +1,333 @@
+package in_toto
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsupportedArchive gets thrown if a link archive has an unknown format
+var ErrUnsupportedArchive = errors.New("unsupported link archive format, must be one of .tar, .tar.gz, .tgz or .zip")
+
+// ErrArchiveLinkTooLarge gets thrown if a link file in a link archive exceeds
+// MaxArchiveLinkSize
+var ErrArchiveLinkTooLarge = errors.New("link file in archive is too large")
+
+// MaxArchiveLinkSize is the maximum size in bytes of a link file in a link
+// archive, see NewArchiveLinkSource
+const MaxArchiveLinkSize = 32 << 20
+
+/*
+LinkSource provides the link metadata that is used as evidence for the steps
+of a layout during verification.  Links returns the links available for the
+passed step, keyed by the (possibly abbreviated) key id of the functionary
+that created the link, i.e. the key id prefix used in LinkNameFormat.  Links
+that are not signed by a key with a matching key id are ignored.  Sublayout
+returns the source for the links of the sublayout that the passed step
+resolves to, if the sublayout was signed by the passed key id.
+
+NewDirectoryLinkSource, NewArchiveLinkSource and NewMemoryLinkSource provide
+LinkSource implementations for a local directory, a tar or zip archive, and
+for links held in memory.
+*/
+type LinkSource interface {
+	Links(stepName string) (map[string]Metadata, error)
+	Sublayout(stepName string, keyID string) (LinkSource, error)
+}
+
+/*
+LinkOrigin records where a link was loaded from.  Path is the path of the link
+file, or the name of the link file in Archive, if the link was loaded from a
+link archive.  Digest holds the sha256 digest of the bytes, from which the
+link was decoded.
+*/
+type LinkOrigin struct {
+	Path    string
+	Archive string
+	Digest  HashObj
+}
+
+/*
+LinkOriginSource is a LinkSource, which reports where its links were loaded
+from, e.g. to record them in the EvidenceGraph of a verification.
+LinksWithOrigins returns the same links as Links, and the origin of each link
+keyed by the same key id.  Links without known origin, e.g. links added to a
+MemoryLinkSource with AddLink, have no origin.
+*/
+type LinkOriginSource interface {
+	LinkSource
+	LinksWithOrigins(stepName string) (map[string]Metadata, map[string]LinkOrigin, error)
+}
+
+// newLinkOrigin returns the origin of a link decoded from the passed bytes
+func newLinkOrigin(linkPath string, archive string, linkBytes []byte) LinkOrigin {
+	digest := sha256.Sum256(linkBytes)
+	return LinkOrigin{
+		Path:    linkPath,
+		Archive: archive,
+		Digest:  HashObj{"sha256": hex.EncodeToString(digest[:])},
+	}
+}
+
+/*
+DirectoryLinkSource loads links from a local directory, using LinkGlobFormat to
+find the links of a step.  Links of a sublayout are loaded from a subdirectory
+named according to SublayoutLinkDirFormat.  Links that cannot be loaded are
+ignored.
+*/
+type DirectoryLinkSource struct {
+	Dir string
+}
+
+// NewDirectoryLinkSource returns a LinkSource that loads links from dir.
+func NewDirectoryLinkSource(dir string) *DirectoryLinkSource {
+	return &DirectoryLinkSource{Dir: dir}
+}
+
+func (s *DirectoryLinkSource) Links(stepName string) (map[string]Metadata, error) {
+	links, _, err := s.LinksWithOrigins(stepName)
+	return links, err
+}
+
+func (s *DirectoryLinkSource) LinksWithOrigins(stepName string) (map[string]Metadata, map[string]LinkOrigin, error) {
+	linkFiles, err := filepath.Glob(path.Join(s.Dir,
+		fmt.Sprintf(LinkGlobFormat, stepName)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	links := make(map[string]Metadata)
+	origins := make(map[string]LinkOrigin)
+	for _, linkPath := range linkFiles {
+		linkBytes, err := os.ReadFile(linkPath)
+		if err != nil {
+			continue
+		}
+		linkEnv, err := decodeMetadata(linkBytes)
+		if err != nil {
+			continue
+		}
+		keyID := linkKeyIDPrefix(stepName, filepath.Base(linkPath))
+		links[keyID] = linkEnv
+		origins[keyID] = newLinkOrigin(linkPath, "", linkBytes)
+	}
+	return links, origins, nil
+}
+
+func (s *DirectoryLinkSource) Sublayout(stepName string, keyID string) (LinkSource, error) {
+	return NewDirectoryLinkSource(filepath.Join(s.Dir,
+		fmt.Sprintf(SublayoutLinkDirFormat, stepName, keyID))), nil
+}
+
+/*
+MemoryLinkSource holds links in memory, e.g. to verify links that were
+received over the network or generated in tests.  Use AddLink and
+AddSublayout to populate it.
+*/
+type MemoryLinkSource struct {
+	// step name -> key id -> link
+	links map[string]map[string]Metadata
+	// step name -> key id -> origin of links read from an archive
+	origins map[string]map[string]LinkOrigin
+	// sublayout link directory name -> source
+	sublayouts map[string]*MemoryLinkSource
+}
+
+// NewMemoryLinkSource returns an empty MemoryLinkSource.
+func NewMemoryLinkSource() *MemoryLinkSource {
+	return &MemoryLinkSource{
+		links:      make(map[string]map[string]Metadata),
+		origins:    make(map[string]map[string]LinkOrigin),
+		sublayouts: make(map[string]*MemoryLinkSource),
+	}
+}
+
+/*
+AddLink adds the link created by the functionary with the passed key id for
+the passed step.  The key id may be abbreviated as in LinkNameFormat.  The
+link has no origin, see LinkOriginSource.
+*/
+func (s *MemoryLinkSource) AddLink(stepName string, keyID string, link Metadata) {
+	if s.links[stepName] == nil {
+		s.links[stepName] = make(map[string]Metadata)
+	}
+	s.links[stepName][keyID] = link
+	delete(s.origins[stepName], keyID)
+}
+
+/*
+AddSublayout adds the source for the links of the sublayout that the passed
+step resolves to, if the sublayout was signed by the passed key id.
+*/
+func (s *MemoryLinkSource) AddSublayout(stepName string, keyID string, sub *MemoryLinkSource) {
+	s.sublayouts[fmt.Sprintf(SublayoutLinkDirFormat, stepName, keyID)] = sub
+}
+
+func (s *MemoryLinkSource) Links(stepName string) (map[string]Metadata, error) {
+	links, _, err := s.LinksWithOrigins(stepName)
+	return links, err
+}
+
+func (s *MemoryLinkSource) LinksWithOrigins(stepName string) (map[string]Metadata, map[string]LinkOrigin, error) {
+	links := make(map[string]Metadata, len(s.links[stepName]))
+	for keyID, link := range s.links[stepName] {
+		links[keyID] = link
+	}
+	origins := make(map[string]LinkOrigin, len(s.origins[stepName]))
+	for keyID, origin := range s.origins[stepName] {
+		origins[keyID] = origin
+	}
+	return links, origins, nil
+}
+
+func (s *MemoryLinkSource) Sublayout(stepName string, keyID string) (LinkSource, error) {
+	sub, ok := s.sublayouts[fmt.Sprintf(SublayoutLinkDirFormat, stepName, keyID)]
+	if !ok {
+		// No links for the sublayout
+		return NewMemoryLinkSource(), nil
+	}
+	return sub, nil
+}
+
+/*
+NewArchiveLinkSource reads all link files from the tar or zip archive at the
+passed path and returns them as LinkSource.  The archive format is determined
+by the file extension, which must be one of .tar, .tar.gz, .tgz or .zip.  The
+archive is expected to have the same structure as a link directory, see
+DirectoryLinkSource.  Files that are not named according to LinkGlobFormat or
+that cannot be loaded are ignored.  Link files larger than MaxArchiveLinkSize
+are rejected.
+*/
+func NewArchiveLinkSource(archivePath string) (*MemoryLinkSource, error) {
+	source := NewMemoryLinkSource()
+
+	switch {
+	case strings.HasSuffix(archivePath, ".zip"):
+		zipReader, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		defer zipReader.Close()
+
+		for _, f := range zipReader.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			r, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			err = source.addArchiveFile(archivePath, f.Name, r)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+	case strings.HasSuffix(archivePath, ".tar"),
+		strings.HasSuffix(archivePath, ".tar.gz"),
+		strings.HasSuffix(archivePath, ".tgz"):
+		f, err := os.Open(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		var r io.Reader = f
+		if !strings.HasSuffix(archivePath, ".tar") {
+			gzipReader, err := gzip.NewReader(f)
+			if err != nil {
+				return nil, err
+			}
+			defer gzipReader.Close()
+			r = gzipReader
+		}
+
+		tarReader := tar.NewReader(r)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := source.addArchiveFile(archivePath, header.Name, tarReader); err != nil {
+				return nil, err
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedArchive, archivePath)
+	}
+
+	return source, nil
+}
+
+/*
+addArchiveFile adds the link file with the passed name in the passed archive,
+which is read from r, to the source, or to the source of the corresponding
+sublayout, if the file is located in a subdirectory.
+*/
+func (s *MemoryLinkSource) addArchiveFile(archivePath string, name string, r io.Reader) error {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	fileName := path.Base(name)
+	// Expect "<step name>.<key id prefix>.link" as in the directory source
+	if matched, _ := path.Match(fmt.Sprintf(LinkGlobFormat, "?*"),
+		fileName); !matched {
+		return nil
+	}
+	stepAndKeyID := strings.TrimSuffix(fileName, ".link")
+	stepName := stepAndKeyID[:len(stepAndKeyID)-9]
+	keyID := stepAndKeyID[len(stepAndKeyID)-8:]
+
+	jsonBytes, err := io.ReadAll(io.LimitReader(r, MaxArchiveLinkSize+1))
+	if err != nil {
+		return err
+	}
+	if len(jsonBytes) > MaxArchiveLinkSize {
+		return fmt.Errorf("%w: %s", ErrArchiveLinkTooLarge, name)
+	}
+	linkEnv, err := decodeMetadata(jsonBytes)
+	if err != nil {
+		return nil
+	}
+
+	target := s
+	if dir := path.Dir(name); dir != "." {
+		for _, sublayoutDir := range strings.Split(dir, "/") {
+			sub, ok := target.sublayouts[sublayoutDir]
+			if !ok {
+				sub = NewMemoryLinkSource()
+				target.sublayouts[sublayoutDir] = sub
+			}
+			target = sub
+		}
+	}
+	target.AddLink(stepName, keyID, linkEnv)
+	if target.origins[stepName] == nil {
+		target.origins[stepName] = make(map[string]LinkOrigin)
+	}
+	target.origins[stepName][keyID] = newLinkOrigin(name, archivePath, jsonBytes)
+	return nil
+}
+
+/*
+linkKeyIDPrefix returns the key id prefix from the passed link file name of
+the passed step.
+*/
+func linkKeyIDPrefix(stepName string, fileName string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(fileName, stepName+"."), ".link")
+}
@@ -0,0 +1,214 @@
+package in_toto
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestLinkArchive writes the passed files to a tar, tar.gz or zip archive
+// at archivePath. files maps archive entry names to files in the cwd.
+func writeTestLinkArchive(t *testing.T, archivePath string, files map[string]string) {
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	switch filepath.Ext(archivePath) {
+	case ".zip":
+		zipWriter := zip.NewWriter(f)
+		for name, src := range files {
+			w, err := zipWriter.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := os.ReadFile(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(content); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zipWriter.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+	default:
+		var w io.Writer = f
+		if filepath.Ext(archivePath) == ".gz" {
+			gzipWriter := gzip.NewWriter(f)
+			defer gzipWriter.Close()
+			w = gzipWriter
+		}
+		tarWriter := tar.NewWriter(w)
+		for name, src := range files {
+			content, err := os.ReadFile(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tarWriter.WriteHeader(&tar.Header{Name: name,
+				Mode: 0644, Size: int64(len(content)),
+				Typeflag: tar.TypeReg}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tarWriter.Write(content); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tarWriter.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLinkSources(t *testing.T) {
+	var aliceKey Key
+	if err := aliceKey.LoadKey("alice.pub", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	superLayoutMb, err := LoadMetadata("super.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	superLayout := superLayoutMb.GetPayload().(Layout)
+	sublayoutDir := fmt.Sprintf(SublayoutLinkDirFormat, "sub_layout", aliceKey.KeyID)
+	files := map[string]string{
+		"sub_layout.70ca5750.link":                  "sub_layout.70ca5750.link",
+		sublayoutDir + "/write-code.b7d643de.link":  "write-code.b7d643de.link",
+		sublayoutDir + "/package.d3ffd108.link":     "package.d3ffd108.link",
+		sublayoutDir + "/ignored.txt":               "alice.pub",
+		sublayoutDir + "/not-a-link.b7d643de.link":  "alice.pub",
+		sublayoutDir + "/write-code.b7d643.link":    "write-code.b7d643de.link",
+		"nested/other-dir/write-code.b7d643de.link": "write-code.b7d643de.link",
+	}
+
+	tmpDir := t.TempDir()
+	for _, archiveName := range []string{"links.tar", "links.tar.gz", "links.zip"} {
+		t.Run(archiveName, func(t *testing.T) {
+			archivePath := filepath.Join(tmpDir, archiveName)
+			writeTestLinkArchive(t, archivePath, files)
+
+			source, err := NewArchiveLinkSource(archivePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			links, err := source.Links("sub_layout")
+			assert.Nil(t, err)
+			assert.Len(t, links, 1)
+			assert.Contains(t, links, "70ca5750")
+
+			sub, err := source.Sublayout("sub_layout", aliceKey.KeyID)
+			assert.Nil(t, err)
+			links, err = sub.Links("write-code")
+			assert.Nil(t, err)
+			assert.Len(t, links, 1)
+			assert.Contains(t, links, "b7d643de")
+
+			// The origin of a link is the link file in the archive
+			_, origins, err := sub.(LinkOriginSource).LinksWithOrigins("write-code")
+			assert.Nil(t, err)
+			linkBytes, err := os.ReadFile("write-code.b7d643de.link")
+			if err != nil {
+				t.Fatal(err)
+			}
+			digest := sha256.Sum256(linkBytes)
+			assert.Equal(t, map[string]LinkOrigin{"b7d643de": {
+				Path:    sublayoutDir + "/write-code.b7d643de.link",
+				Archive: archivePath,
+				Digest:  HashObj{"sha256": hex.EncodeToString(digest[:])},
+			}}, origins)
+
+			// Verify the links of the super layout, including its sublayout,
+			// from the archive
+			stepsMetadata, err := LoadLinksFromSource(superLayout, source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stepsMetadataVerified, err := VerifyLinkSignatureThesholds(
+				superLayout, stepsMetadata, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := &verification{Verifier: *NewVerifier(WithLinkSource(source))}
+			_, err = v.verifySublayouts(context.Background(), superLayout,
+				stepsMetadataVerified)
+			assert.Nil(t, err)
+		})
+	}
+
+	t.Run("oversized link", func(t *testing.T) {
+		source := NewMemoryLinkSource()
+		err := source.addArchiveFile("links.tar", "foo.deadbeef.link",
+			strings.NewReader(strings.Repeat(" ", MaxArchiveLinkSize+1)))
+		assert.True(t, errors.Is(err, ErrArchiveLinkTooLarge))
+	})
+
+	t.Run("unsupported archive", func(t *testing.T) {
+		_, err := NewArchiveLinkSource("links.rar")
+		assert.True(t, errors.Is(err, ErrUnsupportedArchive))
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		links, err := NewDirectoryLinkSource(".").Links("foo")
+		assert.Nil(t, err)
+		assert.Len(t, links, 2)
+		assert.Contains(t, links, "b7d643de")
+		assert.Contains(t, links, "d3ffd108")
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		writeCode, err := LoadMetadata("write-code.b7d643de.link")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg, err := LoadMetadata("package.d3ffd108.link")
+		if err != nil {
+			t.Fatal(err)
+		}
+		source := NewMemoryLinkSource()
+		source.AddLink("write-code", "b7d643de", writeCode)
+		source.AddLink("package", "d3ffd108", pkg)
+
+		// Added links have no origin
+		_, origins, err := source.LinksWithOrigins("write-code")
+		assert.Nil(t, err)
+		assert.Empty(t, origins)
+
+		layoutMb, err := LoadMetadata("demo.layout")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stepsMetadata, err := LoadLinksFromSource(layoutMb.GetPayload().(Layout), source)
+		assert.Nil(t, err)
+		assert.Len(t, stepsMetadata["write-code"], 1)
+		assert.Contains(t, stepsMetadata["write-code"],
+			"b7d643dec0a051096ee5d87221b5d91a33daa658699d30903e1cefb90c418401")
+
+		_, err = InTotoVerify(layoutMb, map[string]Key{aliceKey.KeyID: aliceKey},
+			"does-not-exist", "", map[string]string{}, [][]byte{},
+			testOSisWindows(), WithLinkSource(source))
+		defer os.Remove("untar.link")
+		assert.Nil(t, err)
+
+		// Sublayouts that were not added have no links
+		sub, err := source.Sublayout("write-code", aliceKey.KeyID)
+		assert.Nil(t, err)
+		links, err := sub.Links("write-code")
+		assert.Nil(t, err)
+		assert.Empty(t, links)
+	})
+}
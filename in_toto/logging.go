@@ -0,0 +1,31 @@
+package in_toto
+
+import (
+	"context"
+	"log/slog"
+)
+
+// loggerKey is the context key of the logger, see ContextWithLogger.
+type loggerKey struct{}
+
+/*
+ContextWithLogger returns a copy of ctx, which carries the passed logger.  The
+context aware functions of this package, e.g. InTotoRunContext,
+RecordArtifactsContext and Verifier.Verify, log to the logger of their context.
+Without a logger in the context, they log to slog.Default.  The library itself
+never writes to standard output.
+*/
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+/*
+loggerFromContext returns the logger carried by ctx, see ContextWithLogger, or
+slog.Default.
+*/
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
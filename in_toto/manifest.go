@@ -0,0 +1,103 @@
+package in_toto
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrManifestDigestMismatch gets thrown if the manifest of a MATCH-DIGEST rule
+// does not have the digest pinned by the rule
+var ErrManifestDigestMismatch = errors.New("manifest does not have the pinned digest")
+
+/*
+manifestAlgorithms maps the length of hex digests in checksum files to the
+hash algorithm that produced them.
+*/
+var manifestAlgorithms = map[int]string{
+	56:  "sha224",
+	64:  "sha256",
+	96:  "sha384",
+	128: "sha512",
+}
+
+/*
+loadDigestManifest loads the manifest of a MATCH-DIGEST rule, which pins the
+digests of artifacts.  A manifest whose path ends with ".json" uses the format
+of the materials and products of links, i.e. it maps artifact paths to hash
+objects.  Any other manifest uses the format of the output of sha256sum and
+similar tools, i.e. one "<hex digest>  <path>" pair per line, where the hash
+algorithm is derived from the length of the digest.  The manifest path must be
+relative and is resolved against the passed directory.  Since the manifest is
+not signed, the digest of its contents must be the passed pinned digest of the
+passed hash algorithm.  Artifact paths are cleaned.
+*/
+func loadDigestManifest(dir string, manifestPath string, pinnedAlgorithm string,
+	pinnedDigest string) (map[string]HashObj, error) {
+	if !filepath.IsLocal(manifestPath) {
+		return nil, fmt.Errorf("manifest path %s is not relative", manifestPath)
+	}
+	manifestPath = filepath.Join(dir, manifestPath)
+	contents, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	hashFunc, ok := getHashMapping()[pinnedAlgorithm]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedHashAlgorithm, pinnedAlgorithm)
+	}
+	if hex.EncodeToString(hashToHex(hashFunc(), contents)) != pinnedDigest {
+		return nil, fmt.Errorf("%w: %s", ErrManifestDigestMismatch, manifestPath)
+	}
+
+	digests := make(map[string]HashObj)
+	if strings.HasSuffix(manifestPath, ".json") {
+		var artifacts map[string]HashObj
+		if err := json.Unmarshal(contents, &artifacts); err != nil {
+			return nil, fmt.Errorf("invalid manifest %s: %w", manifestPath, err)
+		}
+		for artifactPath, hashes := range artifacts {
+			digests[path.Clean(artifactPath)] = hashes
+		}
+		return digests, nil
+	}
+
+	for i, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		digest, artifactPath, ok := strings.Cut(line, " ")
+		algorithm, known := manifestAlgorithms[len(digest)]
+		if !ok || !known || validateHexString(digest) != nil {
+			return nil, fmt.Errorf("invalid manifest %s, line %d: expected"+
+				" '<hex digest>  <path>'", manifestPath, i+1)
+		}
+		// The path is separated by two spaces, or a space and a '*' for
+		// binary mode
+		artifactPath = strings.TrimPrefix(strings.TrimPrefix(artifactPath, " "), "*")
+		digests[path.Clean(artifactPath)] = HashObj{algorithm: strings.ToLower(digest)}
+	}
+	return digests, nil
+}
+
+/*
+artifactHashes returns the hashes of the artifact with the passed cleaned path
+from the passed artifacts, whose paths may not be cleaned.
+*/
+func artifactHashes(artifacts map[string]HashObj, artifactPath string) (HashObj, bool) {
+	if hashes, ok := artifacts[artifactPath]; ok {
+		return hashes, true
+	}
+	for p, hashes := range artifacts {
+		if path.Clean(p) == artifactPath {
+			return hashes, true
+		}
+	}
+	return nil, false
+}
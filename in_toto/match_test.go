@@ -83,3 +83,36 @@ func TestMatch(t *testing.T) {
 		}
 	}
 }
+
+var matchGlobstarTests = []MatchTest{
+	{"*", "foo", true, nil},
+	{"*", "foo/bar", false, nil},
+	{"**", "foo/bar", true, nil},
+	{"**/*.go", "main.go", true, nil},
+	{"**/*.go", "cmd/in-toto/main.go", true, nil},
+	{"src/**/test/*.py", "src/test/a.py", true, nil},
+	{"src/**/test/*.py", "src/a/b/test/a.py", true, nil},
+	{"src/**/test/*.py", "src/a/b/test/c/a.py", false, nil},
+	{"src/**", "src", true, nil},
+	{"src/**", "source/a", false, nil},
+	{"*.{go,mod}", "go.mod", true, nil},
+	{"*.{go,mod}", "go.sum", false, nil},
+	{"{cmd,pkg/{a,b}}/*.go", "pkg/b/x.go", true, nil},
+	{"{cmd,pkg/{a,b}}/*.go", "pkg/c/x.go", false, nil},
+	{"\\{a,b}", "{a,b}", true, nil},
+	{"[{]a", "{a", true, nil},
+	{"!**/*_test.go", "pkg/a_test.go", false, nil},
+	{"!**/*_test.go", "pkg/a.go", true, nil},
+	{"{a,b", "a", false, errBadPattern},
+	{"a,b}", "a,b}", true, nil},
+	{"**/[", "a/b", false, errBadPattern},
+}
+
+func TestMatchGlobstar(t *testing.T) {
+	for _, tt := range matchGlobstarTests {
+		ok, err := matchGlobstar(tt.pattern, tt.s)
+		if ok != tt.match || err != tt.err {
+			t.Errorf("matchGlobstar(%#q, %#q) = %v, %v want %v, %v", tt.pattern, tt.s, ok, err, tt.match, tt.err)
+		}
+	}
+}
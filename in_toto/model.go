@@ -433,13 +433,32 @@ type SupplyChainItem struct {
 }
 
 /*
-validateArtifactRule calls UnpackRule to validate that the passed rule conforms
-with any of the available rule formats.
+validateArtifactRule calls parseLayoutRule to validate that the passed rule
+conforms with any of the available rule formats, and that its pinned digest,
+if any, is a digest of a known hash algorithm.  Manifests of MATCH-DIGEST rules
+must be pinned with an algorithm, which in-toto can compute.  Digests given by
+parameter placeholders are validated after parameter substitution.
 */
 func validateArtifactRule(rule []string) error {
-	if _, err := UnpackRule(rule); err != nil {
+	parsed, err := parseLayoutRule(rule)
+	if err != nil {
 		return err
 	}
+	switch r := parsed.(type) {
+	case RequireRule:
+		if r.Digest != "" {
+			return validatePinnedDigest(r.Algorithm, r.Digest)
+		}
+	case MatchDigestRule:
+		if containsPlaceholder(r.Algorithm) {
+			return nil
+		}
+		if _, ok := getHashMapping()[r.Algorithm]; !ok {
+			return fmt.Errorf("unsupported hash algorithm '%s' for manifest"+
+				" in rule %s", r.Algorithm, rule)
+		}
+		return validatePinnedDigest(r.Algorithm, r.Digest)
+	}
 	return nil
 }
 
@@ -508,20 +527,48 @@ During final product verification in-toto looks for corresponding Link
 metadata, which is used as signed evidence that the step was performed
 according to the supply chain definition.  Materials and products used/produced
 by the step are constrained by the artifact rules in the step's
-ExpectedMaterials and ExpectedProducts fields.
+ExpectedMaterials and ExpectedProducts fields.  If ThresholdParameter names a
+parameter, the step's threshold is set to the value of that parameter, see
+SubstituteParameters.
 */
 type Step struct {
 	Type                   string                  `json:"_type"`
 	PubKeys                []string                `json:"pubkeys"`
 	CertificateConstraints []CertificateConstraint `json:"cert_constraints,omitempty"`
 	ExpectedCommand        []string                `json:"expected_command"`
+	CommandAlignment       *CommandAlignmentPolicy `json:"command_alignment,omitempty"`
 	Threshold              int                     `json:"threshold"`
+	ThresholdIdentity      FunctionaryIdentity     `json:"threshold_identity,omitempty"`
+	ThresholdParameter     string                  `json:"threshold_parameter,omitempty"`
 	SupplyChainItem
 }
 
+/*
+FunctionaryIdentity configures how the functionaries, whose links count
+towards the threshold of a step, are told apart.  By default, each key id
+counts as a distinct functionary.  With an identity from a certificate, links
+signed with different certificates of the same identity, e.g. after a key
+rotation, count only once.  Links signed with a key listed in the step's
+PubKeys are still identified by their key id.
+*/
+type FunctionaryIdentity string
+
+const (
+	IdentityKeyID      FunctionaryIdentity = "keyid"
+	IdentityURI        FunctionaryIdentity = "uri"
+	IdentityEmail      FunctionaryIdentity = "email"
+	IdentityCommonName FunctionaryIdentity = "common_name"
+)
+
 // CheckCertConstraints returns true if the provided certificate matches at least one
 // of the constraints for this step.
 func (s Step) CheckCertConstraints(key Key, rootCAIDs []string, rootCertPool, intermediateCertPool *x509.CertPool) error {
+	return s.CheckCertConstraintsAt(key, rootCAIDs, rootCertPool, intermediateCertPool, time.Time{})
+}
+
+// CheckCertConstraintsAt provides the same functionality as CheckCertConstraints, but verifies
+// the certificate's chain of trust at the provided point in time. A zero time means the current time.
+func (s Step) CheckCertConstraintsAt(key Key, rootCAIDs []string, rootCertPool, intermediateCertPool *x509.CertPool, at time.Time) error {
 	if len(s.CertificateConstraints) == 0 {
 		return fmt.Errorf("no constraints found")
 	}
@@ -537,7 +584,7 @@ func (s Step) CheckCertConstraints(key Key, rootCAIDs []string, rootCertPool, in
 	}
 
 	for _, constraint := range s.CertificateConstraints {
-		err = constraint.Check(cert, rootCAIDs, rootCertPool, intermediateCertPool)
+		err = constraint.CheckAt(cert, rootCAIDs, rootCertPool, intermediateCertPool, at)
 		if err == nil {
 			return nil
 		}
@@ -563,10 +610,23 @@ func validateStep(step Step) error {
 			step.SupplyChainItem.Name)
 	}
 	for _, keyID := range step.PubKeys {
+		// Key ids may be parameters, which are validated after substitution
+		if containsPlaceholder(keyID) {
+			continue
+		}
 		if err := validateHexString(keyID); err != nil {
 			return err
 		}
 	}
+	if err := validateCommandAlignmentPolicy(step.CommandAlignment); err != nil {
+		return fmt.Errorf("step '%s': %w", step.Name, err)
+	}
+	switch step.ThresholdIdentity {
+	case "", IdentityKeyID, IdentityURI, IdentityEmail, IdentityCommonName:
+	default:
+		return fmt.Errorf("invalid threshold identity '%s' for step '%s'",
+			step.ThresholdIdentity, step.Name)
+	}
 	return nil
 }
 
@@ -584,16 +644,38 @@ public keys.  In addition, the layout may list a sequence of inspections that
 are executed during in-toto supply chain verification.  A layout should be
 contained in a generic Metablock object, which provides functionality for
 signing and signature verification, and reading from and writing to disk.
+Parameters declares the parameters, which are substituted in the layout
+before verification, see SubstituteParameters.  PatternDialect selects the
+syntax of artifact rule patterns, which defaults to PatternDialectLegacy.
+HashPolicy configures the hash algorithms MATCH rules rely on.  Without it,
+MATCH rules require equal hash objects.
 */
 type Layout struct {
-	Type            string         `json:"_type"`
-	Steps           []Step         `json:"steps"`
-	Inspect         []Inspection   `json:"inspect"`
-	Keys            map[string]Key `json:"keys"`
-	RootCas         map[string]Key `json:"rootcas,omitempty"`
-	IntermediateCas map[string]Key `json:"intermediatecas,omitempty"`
-	Expires         string         `json:"expires"`
-	Readme          string         `json:"readme"`
+	Type             string                          `json:"_type"`
+	Steps            []Step                          `json:"steps"`
+	Inspect          []Inspection                    `json:"inspect"`
+	Keys             map[string]Key                  `json:"keys"`
+	RootCas          map[string]Key                  `json:"rootcas,omitempty"`
+	IntermediateCas  map[string]Key                  `json:"intermediatecas,omitempty"`
+	CommandAlignment *CommandAlignmentPolicy         `json:"command_alignment,omitempty"`
+	Summary          *SummaryPolicy                  `json:"summary,omitempty"`
+	Parameters       map[string]ParameterDeclaration `json:"parameters,omitempty"`
+	PatternDialect   PatternDialect                  `json:"pattern_dialect,omitempty"`
+	HashPolicy       *HashPolicy                     `json:"hash_policy,omitempty"`
+	Expires          string                          `json:"expires"`
+	Readme           string                          `json:"readme"`
+}
+
+/*
+SummaryPolicy configures how the summary link of a layout is constructed, see
+GetSummaryLink.  The materials of the summary link are the union of the
+materials of the entry steps, and its products are the union of the products
+of the exit steps.  By default, the first step of the layout is the only entry
+step and the last step is the only exit step.
+*/
+type SummaryPolicy struct {
+	EntrySteps []string `json:"entry_steps,omitempty"`
+	ExitSteps  []string `json:"exit_steps,omitempty"`
 }
 
 // Go does not allow to pass `[]T` (slice with certain type) to a function
@@ -665,6 +747,26 @@ func validateLayout(layout Layout) error {
 		return err
 	}
 
+	if err := validateCommandAlignmentPolicy(layout.CommandAlignment); err != nil {
+		return err
+	}
+
+	if err := validateSummaryPolicy(layout); err != nil {
+		return err
+	}
+
+	if err := validateParameterDeclarations(layout); err != nil {
+		return err
+	}
+
+	if err := validatePatternDialect(layout); err != nil {
+		return err
+	}
+
+	if err := validateHashPolicy(layout.HashPolicy); err != nil {
+		return err
+	}
+
 	var namesSeen = make(map[string]bool)
 	for _, step := range layout.Steps {
 		if namesSeen[step.Name] {
@@ -676,6 +778,10 @@ func validateLayout(layout Layout) error {
 		if err := validateStep(step); err != nil {
 			return err
 		}
+
+		if err := validateExpectedCommandPatterns(layout, step); err != nil {
+			return err
+		}
 	}
 	for _, inspection := range layout.Inspect {
 		if namesSeen[inspection.Name] {
@@ -684,6 +790,46 @@ func validateLayout(layout Layout) error {
 
 		namesSeen[inspection.Name] = true
 	}
+
+	if err := validatePinnedDigests(layout); err != nil {
+		return err
+	}
+	return nil
+}
+
+/*
+supplyChainItems returns the supply chain items of the steps and inspections of
+the layout.
+*/
+func (l Layout) supplyChainItems() []SupplyChainItem {
+	items := make([]SupplyChainItem, 0, len(l.Steps)+len(l.Inspect))
+	for _, step := range l.Steps {
+		items = append(items, step.SupplyChainItem)
+	}
+	for _, inspection := range l.Inspect {
+		items = append(items, inspection.SupplyChainItem)
+	}
+	return items
+}
+
+/*
+validateSummaryPolicy ensures that the entry and exit steps of the summary
+policy of the passed layout, if any, are steps of the layout.
+*/
+func validateSummaryPolicy(layout Layout) error {
+	if layout.Summary == nil {
+		return nil
+	}
+	stepNames := NewSet()
+	for _, step := range layout.Steps {
+		stepNames.Add(step.Name)
+	}
+	for _, name := range append(append([]string{}, layout.Summary.EntrySteps...),
+		layout.Summary.ExitSteps...) {
+		if !stepNames.Has(name) {
+			return fmt.Errorf("summary refers to unknown step '%s'", name)
+		}
+	}
 	return nil
 }
 
@@ -702,6 +848,14 @@ func LoadMetadata(path string) (Metadata, error) {
 		return nil, err
 	}
 
+	return decodeMetadata(jsonBytes)
+}
+
+/*
+decodeMetadata decodes the passed JSON bytes either as DSSE envelope or as
+Metablock, depending on the format.
+*/
+func decodeMetadata(jsonBytes []byte) (Metadata, error) {
 	var rawData map[string]*json.RawMessage
 	if err := json.Unmarshal(jsonBytes, &rawData); err != nil {
 		return nil, err
@@ -664,6 +664,134 @@ func TestValidateLayout(t *testing.T) {
 			t.Errorf("%s: '%s' not in '%s'", name, tc.Expected, err)
 		}
 	}
+
+	layout = Layout{
+		Type:             "layout",
+		Expires:          "2020-02-27T18:03:43Z",
+		CommandAlignment: &CommandAlignmentPolicy{Mode: "strict"},
+	}
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "invalid command alignment mode 'strict'")
+
+	layout.CommandAlignment = &CommandAlignmentPolicy{Match: CommandMatchGlob}
+	layout.Steps = []Step{{
+		Type:            "step",
+		SupplyChainItem: SupplyChainItem{Name: "foo"},
+		ExpectedCommand: []string{"go", "build", "[a-"},
+	}}
+	err = validateLayout(layout)
+	assert.ErrorIs(t, err, errBadPattern)
+	layout.Steps[0].CommandAlignment = &CommandAlignmentPolicy{Match: CommandMatchExact}
+	assert.Nil(t, validateLayout(layout))
+
+	layout.Summary = &SummaryPolicy{ExitSteps: []string{"bar"}}
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "summary refers to unknown step 'bar'")
+	layout.Summary = nil
+
+	layout.Steps[0].ThresholdIdentity = "dns"
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "invalid threshold identity 'dns' for step 'foo'")
+	layout.Steps[0].ThresholdIdentity = ""
+
+	layout.Steps[0].PubKeys = []string{"{FUNCTIONARY}"}
+	assert.Nil(t, validateLayout(layout))
+
+	invalidDefault := "two"
+	layout.Parameters = map[string]ParameterDeclaration{
+		"THRESHOLD": {Type: ParameterInteger, Default: &invalidDefault},
+	}
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "invalid default for parameter 'THRESHOLD': 'two'"+
+		" is not an integer")
+
+	layout.Parameters = map[string]ParameterDeclaration{
+		"THRESHOLD": {Type: "float"},
+	}
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "invalid type 'float' for parameter 'THRESHOLD'")
+
+	layout.Parameters = map[string]ParameterDeclaration{"THRESHOLD": {}}
+	layout.Steps[0].ThresholdParameter = "THRESHOLD"
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "threshold parameter 'THRESHOLD' of step 'foo'"+
+		" must be an integer")
+	layout.Parameters = nil
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "step 'foo' refers to undeclared threshold"+
+		" parameter 'THRESHOLD'")
+	layout.Steps[0].ThresholdParameter = ""
+
+	layout.PatternDialect = "regex"
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "invalid pattern dialect 'regex'")
+
+	layout.PatternDialect = PatternDialectGlobstar
+	layout.Steps[0].ExpectedProducts = [][]string{{"ALLOW", "src/{a,b"}}
+	err = validateLayout(layout)
+	assert.ErrorIs(t, err, errBadPattern)
+	layout.Steps[0].ExpectedProducts = [][]string{{"ALLOW", "src/**/{a,b}"}}
+	assert.Nil(t, validateLayout(layout))
+
+	layout.HashPolicy = &HashPolicy{Algorithms: []string{"sha265"}}
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "unknown hash algorithm 'sha265'")
+	layout.HashPolicy = &HashPolicy{Algorithms: []string{"sha1", "sha256"},
+		MinimumStrength: 192}
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "hash policy accepts no algorithm of the minimum"+
+		" strength")
+	layout.HashPolicy = &HashPolicy{MinimumStrength: 192}
+	assert.Nil(t, validateLayout(layout))
+
+	sha256Digest := strings.Repeat("a", 64)
+	layout.Steps[0].ExpectedProducts = [][]string{
+		{"REQUIRE", "foo", "WITH", "sha256", sha256Digest}}
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "hash algorithm 'sha256' in rule [REQUIRE foo"+
+		" WITH sha256 "+sha256Digest+"] of 'foo' is not acceptable by the hash"+
+		" policy")
+	layout.HashPolicy = nil
+	assert.Nil(t, validateLayout(layout))
+	layout.Steps[0].ExpectedProducts = [][]string{
+		{"REQUIRE", "foo", "WITH", "sha265", sha256Digest}}
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "step invalid product rule: unknown hash"+
+		" algorithm 'sha265'")
+	layout.Steps[0].ExpectedProducts = [][]string{
+		{"REQUIRE", "foo", "WITH", "sha512", sha256Digest}}
+	err = validateLayout(layout)
+	assert.ErrorContains(t, err, "expected 128 hex characters")
+	layout.Steps[0].ExpectedProducts = [][]string{
+		{"MATCH-DIGEST", "foo", "FROM-FILE", "SHA224SUMS", "WITH", "sha224",
+			strings.Repeat("a", 56)}}
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "step invalid product rule: unsupported hash"+
+		" algorithm 'sha224' for manifest in rule [MATCH-DIGEST foo FROM-FILE"+
+		" SHA224SUMS WITH sha224 "+strings.Repeat("a", 56)+"]")
+
+	// Placeholders are validated after parameter substitution
+	layout.Steps[0].ExpectedProducts = [][]string{
+		{"REQUIRE", "foo", "WITH", "sha256", "{DIGEST}"},
+		{"REQUIRE", "foo", "WITH", "{ALGORITHM}", "{DIGEST}"},
+		{"MATCH-DIGEST", "foo", "FROM-FILE", "SHA256SUMS", "WITH", "sha256",
+			"{DIGEST}"}}
+	assert.Nil(t, validateLayout(layout))
+	layout.Steps[0].ExpectedProducts = nil
+
+	// Inspection rules are validated, too
+	layout.Inspect = []Inspection{{
+		Type:            "inspection",
+		SupplyChainItem: SupplyChainItem{Name: "untar"},
+		Run:             []string{"tar"},
+	}}
+	layout.Inspect[0].ExpectedMaterials = [][]string{
+		{"REQUIRE", "foo", "WITH", "sha512", sha256Digest}}
+	err = validateLayout(layout)
+	assert.EqualError(t, err, "invalid digest in rule [REQUIRE foo WITH sha512 "+
+		sha256Digest+"] of 'untar': invalid sha512 digest '"+sha256Digest+
+		"': expected 128 hex characters")
+	layout.Inspect = nil
 }
 
 func TestValidateStep(t *testing.T) {
@@ -0,0 +1,318 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrMissingParameter gets thrown if a required layout parameter is not passed
+var ErrMissingParameter = errors.New("missing required parameter")
+
+// ErrUnresolvedParameter gets thrown if a placeholder remains in the layout
+// after parameter substitution
+var ErrUnresolvedParameter = errors.New("unresolved parameter")
+
+/*
+ParameterType is the type of the value of a layout parameter.  Values are
+always passed as strings, the type only restricts their format.
+*/
+type ParameterType string
+
+const (
+	// ParameterString accepts any value (default)
+	ParameterString ParameterType = "string"
+	// ParameterInteger accepts decimal integers, e.g. for thresholds
+	ParameterInteger ParameterType = "integer"
+	// ParameterBoolean accepts the values "true" and "false"
+	ParameterBoolean ParameterType = "boolean"
+	// ParameterHex accepts hex strings, e.g. for key ids
+	ParameterHex ParameterType = "hex"
+)
+
+/*
+ParameterDeclaration declares a parameter of a layout, see Layout.Parameters.
+A required parameter must be passed to the verification.  Otherwise, the
+Default, if any, is used if the parameter is not passed.
+*/
+type ParameterDeclaration struct {
+	Type        ParameterType `json:"type,omitempty"`
+	Default     *string       `json:"default,omitempty"`
+	Required    bool          `json:"required,omitempty"`
+	Description string        `json:"description,omitempty"`
+}
+
+// parameterNameRegexp matches valid parameter names
+var parameterNameRegexp = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+// placeholderRegexp matches a parameter placeholder, optionally preceded by
+// '$'.  Placeholders preceded by '$' are shell variables such as "${HOME}" in
+// inspections, which are left alone, see isShellVariable.
+var placeholderRegexp = regexp.MustCompile(`\$?\{([a-zA-Z0-9_-]+)\}`)
+
+// isShellVariable returns true if the passed match of placeholderRegexp is a
+// shell variable rather than a parameter placeholder
+func isShellVariable(match string) bool {
+	return strings.HasPrefix(match, "$")
+}
+
+/*
+placeholderNames returns the names of the parameter placeholders in the passed
+string in order of appearance.
+*/
+func placeholderNames(s string) []string {
+	var names []string
+	for _, m := range placeholderRegexp.FindAllStringSubmatch(s, -1) {
+		if !isShellVariable(m[0]) {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// containsPlaceholder returns true if the passed string contains a parameter
+// placeholder
+func containsPlaceholder(s string) bool {
+	return len(placeholderNames(s)) > 0
+}
+
+/*
+validateParameterValue ensures that the passed value has the format of the
+passed parameter type.
+*/
+func validateParameterValue(paramType ParameterType, value string) error {
+	switch paramType {
+	case "", ParameterString:
+		return nil
+	case ParameterInteger:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("'%s' is not an integer", value)
+		}
+	case ParameterBoolean:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("'%s' is not a boolean", value)
+		}
+	case ParameterHex:
+		if err := validateHexString(value); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid parameter type '%s'", paramType)
+	}
+	return nil
+}
+
+/*
+validateParameterDeclarations ensures that the parameter declarations of the
+passed layout have valid names, types and defaults, and that the threshold
+parameters of its steps refer to declared integer parameters, even if the
+layout declares no other parameters.
+*/
+func validateParameterDeclarations(layout Layout) error {
+	for name, declaration := range layout.Parameters {
+		if !parameterNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid format for parameter '%s'", name)
+		}
+		switch declaration.Type {
+		case "", ParameterString, ParameterInteger, ParameterBoolean, ParameterHex:
+		default:
+			return fmt.Errorf("invalid type '%s' for parameter '%s'",
+				declaration.Type, name)
+		}
+		if declaration.Default != nil {
+			if err := validateParameterValue(declaration.Type,
+				*declaration.Default); err != nil {
+				return fmt.Errorf("invalid default for parameter '%s': %w", name, err)
+			}
+		}
+	}
+	for _, step := range layout.Steps {
+		if step.ThresholdParameter == "" {
+			continue
+		}
+		declaration, ok := layout.Parameters[step.ThresholdParameter]
+		if !ok {
+			return fmt.Errorf("step '%s' refers to undeclared threshold parameter"+
+				" '%s'", step.Name, step.ThresholdParameter)
+		}
+		if declaration.Type != ParameterInteger {
+			return fmt.Errorf("threshold parameter '%s' of step '%s' must be an"+
+				" integer", step.ThresholdParameter, step.Name)
+		}
+	}
+	return nil
+}
+
+/*
+resolveParameters returns the values of the parameters of the passed layout.
+Passed values take precedence over the defaults of the layout's parameter
+declarations.  If the layout declares parameters, passing an undeclared
+parameter, omitting a required parameter or passing a value of the wrong type
+is an error.
+*/
+func resolveParameters(layout Layout,
+	parameterDictionary map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(parameterDictionary))
+	for name, value := range parameterDictionary {
+		if !parameterNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("invalid format for parameter")
+		}
+		if len(layout.Parameters) > 0 {
+			if _, ok := layout.Parameters[name]; !ok {
+				return nil, fmt.Errorf("unknown parameter '%s'", name)
+			}
+		}
+		resolved[name] = value
+	}
+
+	for name, declaration := range layout.Parameters {
+		value, ok := resolved[name]
+		if !ok {
+			if declaration.Required {
+				return nil, fmt.Errorf("%w '%s'", ErrMissingParameter, name)
+			}
+			if declaration.Default == nil {
+				continue
+			}
+			value = *declaration.Default
+			resolved[name] = value
+		}
+		if err := validateParameterValue(declaration.Type, value); err != nil {
+			return nil, fmt.Errorf("invalid value for parameter '%s': %w", name, err)
+		}
+	}
+	return resolved, nil
+}
+
+/*
+substituteParameter replaces the placeholders in the passed string with the
+values of the passed parameters and fails, if a placeholder cannot be
+replaced.  Shell variables such as "${HOME}" are left alone, and substituted
+values are not substituted again.  The passed location is used in the error
+message.
+*/
+func substituteParameter(parameters map[string]string, s *string,
+	location string) error {
+	var unresolved string
+	*s = placeholderRegexp.ReplaceAllStringFunc(*s, func(match string) string {
+		if isShellVariable(match) {
+			return match
+		}
+		value, ok := parameters[match[1:len(match)-1]]
+		if !ok {
+			if unresolved == "" {
+				unresolved = match[1 : len(match)-1]
+			}
+			return match
+		}
+		return value
+	})
+	if unresolved != "" {
+		return fmt.Errorf("%w '%s' in %s", ErrUnresolvedParameter, unresolved,
+			location)
+	}
+	return nil
+}
+
+/*
+substituteParametersInSlice substitutes parameters in a copy of the passed
+slice.
+*/
+func substituteParametersInSlice(parameters map[string]string, slice []string,
+	location string) ([]string, error) {
+	if slice == nil {
+		return nil, nil
+	}
+	newSlice := append([]string{}, slice...)
+	for i := range newSlice {
+		if err := substituteParameter(parameters, &newSlice[i], location); err != nil {
+			return nil, err
+		}
+	}
+	return newSlice, nil
+}
+
+/*
+substituteParametersInRules substitutes parameters in a copy of the passed
+artifact rules.
+*/
+func substituteParametersInRules(parameters map[string]string, rules [][]string,
+	location string) ([][]string, error) {
+	if rules == nil {
+		return nil, nil
+	}
+	newRules := make([][]string, len(rules))
+	for i, rule := range rules {
+		newRule, err := substituteParametersInSlice(parameters, rule, location)
+		if err != nil {
+			return nil, err
+		}
+		newRules[i] = newRule
+	}
+	return newRules, nil
+}
+
+/*
+substituteParametersInStep substitutes parameters in the passed step and
+applies its threshold parameter, if any.
+*/
+func substituteParametersInStep(parameters map[string]string, step *Step) error {
+	location := fmt.Sprintf("step '%s'", step.Name)
+	var err error
+	if step.ExpectedMaterials, err = substituteParametersInRules(parameters,
+		step.ExpectedMaterials, location); err != nil {
+		return err
+	}
+	if step.ExpectedProducts, err = substituteParametersInRules(parameters,
+		step.ExpectedProducts, location); err != nil {
+		return err
+	}
+	if step.ExpectedCommand, err = substituteParametersInSlice(parameters,
+		step.ExpectedCommand, location); err != nil {
+		return err
+	}
+	if step.PubKeys, err = substituteParametersInSlice(parameters, step.PubKeys,
+		location); err != nil {
+		return err
+	}
+	for _, keyID := range step.PubKeys {
+		if err := validateHexString(keyID); err != nil {
+			return fmt.Errorf("%s: %w", location, err)
+		}
+	}
+
+	constraints := make([]CertificateConstraint, len(step.CertificateConstraints))
+	for i, constraint := range step.CertificateConstraints {
+		if err := substituteParameter(parameters, &constraint.CommonName,
+			location); err != nil {
+			return err
+		}
+		for _, field := range []*[]string{&constraint.DNSNames, &constraint.Emails,
+			&constraint.Organizations, &constraint.Roots, &constraint.URIs} {
+			if *field, err = substituteParametersInSlice(parameters, *field,
+				location); err != nil {
+				return err
+			}
+		}
+		constraints[i] = constraint
+	}
+	if step.CertificateConstraints != nil {
+		step.CertificateConstraints = constraints
+	}
+
+	if step.ThresholdParameter != "" {
+		value, ok := parameters[step.ThresholdParameter]
+		if !ok {
+			return fmt.Errorf("%w '%s' in threshold of %s", ErrUnresolvedParameter,
+				step.ThresholdParameter, location)
+		}
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 1 {
+			return fmt.Errorf("invalid threshold '%s' for %s", value, location)
+		}
+		step.Threshold = threshold
+	}
+	return nil
+}
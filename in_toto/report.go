@@ -0,0 +1,349 @@
+package in_toto
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+VerificationPhase names a phase of the verification workflow performed by
+InTotoVerify.
+*/
+type VerificationPhase string
+
+const (
+	PhaseLayoutSignatures      VerificationPhase = "layout-signatures"
+	PhaseLayoutExpiration      VerificationPhase = "layout-expiration"
+	PhaseParameterSubstitution VerificationPhase = "parameter-substitution"
+	PhaseLinkLoading           VerificationPhase = "link-loading"
+	PhaseThresholds            VerificationPhase = "thresholds"
+	PhaseSublayouts            VerificationPhase = "sublayouts"
+	PhaseCommandAlignment      VerificationPhase = "command-alignment"
+	PhaseArtifactRules         VerificationPhase = "artifact-rules"
+	PhaseInspections           VerificationPhase = "inspections"
+)
+
+// verificationPhases lists all phases in the order they are performed.
+var verificationPhases = []VerificationPhase{
+	PhaseLayoutSignatures,
+	PhaseLayoutExpiration,
+	PhaseParameterSubstitution,
+	PhaseLinkLoading,
+	PhaseThresholds,
+	PhaseSublayouts,
+	PhaseCommandAlignment,
+	PhaseArtifactRules,
+	PhaseInspections,
+}
+
+/*
+VerificationStatus is the outcome of a verification phase, step or
+inspection.  Phases that were not reached, because verification was aborted
+earlier, are reported as skipped.
+*/
+type VerificationStatus string
+
+const (
+	StatusPassed  VerificationStatus = "passed"
+	StatusFailed  VerificationStatus = "failed"
+	StatusSkipped VerificationStatus = "skipped"
+)
+
+// PhaseReport records the outcome of a single verification phase.
+type PhaseReport struct {
+	Phase  VerificationPhase  `json:"phase"`
+	Status VerificationStatus `json:"status"`
+	Error  string             `json:"error,omitempty"`
+}
+
+/*
+LinkReport records a link that was considered for a step, identified by the
+key id of its signer.  For accepted links of steps, whose threshold counts
+functionaries by identity, Identity holds the identity of the signer, see
+FunctionaryIdentity.  For rejected links Error holds the reason.
+*/
+type LinkReport struct {
+	Name     string `json:"name"`
+	KeyID    string `json:"keyid"`
+	Identity string `json:"identity,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+/*
+ItemReport records the outcome of verifying a single step or inspection of a
+layout.  AcceptedLinks, RejectedLinks and DissentingLinks are only populated
+for steps.  DissentingLinks lists accepted links, which were ignored, because
+they report different artifacts than a threshold of agreeing links.  If an
+artifact rule failed, FailedRule holds the rule as it appears in the layout.
+*/
+type ItemReport struct {
+	Name            string                         `json:"name"`
+	Type            string                         `json:"type"`
+	Status          VerificationStatus             `json:"status"`
+	AcceptedLinks   []LinkReport                   `json:"accepted_links,omitempty"`
+	RejectedLinks   []LinkReport                   `json:"rejected_links,omitempty"`
+	DissentingLinks []LinkReport                   `json:"dissenting_links,omitempty"`
+	Sublayouts      map[string]*VerificationReport `json:"sublayouts,omitempty"`
+	Warnings        []string                       `json:"warnings,omitempty"`
+	FailedRule      []string                       `json:"failed_rule,omitempty"`
+	Error           string                         `json:"error,omitempty"`
+}
+
+/*
+PlannedInspection records an inspection, which was not run, because
+verification was performed as dry run, see WithDryRun.  Run, ExpectedMaterials
+and ExpectedProducts are recorded after parameter substitution.
+*/
+type PlannedInspection struct {
+	Name              string     `json:"name"`
+	Run               []string   `json:"run"`
+	ExpectedMaterials [][]string `json:"expected_materials"`
+	ExpectedProducts  [][]string `json:"expected_products"`
+}
+
+/*
+VerificationReport is a structured record of a run of the verification
+workflow.  Besides the overall result, it lists the outcome of each
+verification phase as well as of each step and inspection of the layout.  The
+report is meant to be serialized, e.g. to JSON, and consumed by tooling.
+
+For a dry run, DryRun is set, the inspections phase is skipped and
+PlannedInspections lists the inspections that would have been run.  Passed
+then only refers to the checks that were performed.
+
+Evidence holds the evidence graph of the verification, see EvidenceGraph.
+*/
+type VerificationReport struct {
+	Passed             bool                `json:"passed"`
+	DryRun             bool                `json:"dry_run,omitempty"`
+	Error              string              `json:"error,omitempty"`
+	Phases             []PhaseReport       `json:"phases"`
+	Steps              []*ItemReport       `json:"steps"`
+	Inspections        []*ItemReport       `json:"inspections"`
+	PlannedInspections []PlannedInspection `json:"planned_inspections,omitempty"`
+	Evidence           *EvidenceGraph      `json:"evidence"`
+	SummaryLink        Metadata            `json:"-"`
+}
+
+/*
+newVerificationReport returns a report with all verification phases marked as
+skipped.  Phases are updated as verification proceeds.
+*/
+func newVerificationReport() *VerificationReport {
+	report := &VerificationReport{
+		Phases:      make([]PhaseReport, 0, len(verificationPhases)),
+		Steps:       []*ItemReport{},
+		Inspections: []*ItemReport{},
+		Evidence:    &EvidenceGraph{Items: []*ItemEvidence{}},
+	}
+	for _, phase := range verificationPhases {
+		report.Phases = append(report.Phases, PhaseReport{
+			Phase:  phase,
+			Status: StatusSkipped,
+		})
+	}
+	return report
+}
+
+/*
+Phase returns the report of the passed phase.  The second return value is
+false, if the phase is unknown.
+*/
+func (r *VerificationReport) Phase(phase VerificationPhase) (PhaseReport, bool) {
+	for _, phaseReport := range r.Phases {
+		if phaseReport.Phase == phase {
+			return phaseReport, true
+		}
+	}
+	return PhaseReport{}, false
+}
+
+/*
+Step returns the report of the step with the passed name, or nil if the step
+was not reached during verification.
+*/
+func (r *VerificationReport) Step(name string) *ItemReport {
+	return findItemReport(r.Steps, name)
+}
+
+/*
+Inspection returns the report of the inspection with the passed name, or nil
+if the inspection was not reached during verification.
+*/
+func (r *VerificationReport) Inspection(name string) *ItemReport {
+	return findItemReport(r.Inspections, name)
+}
+
+func findItemReport(items []*ItemReport, name string) *ItemReport {
+	for _, item := range items {
+		if item.Name == name {
+			return item
+		}
+	}
+	return nil
+}
+
+/*
+recordPhase marks the passed phase as passed or failed depending on err.  It is
+a no-op on a nil report, which allows the verification workflow to run without
+reporting.
+*/
+func (r *VerificationReport) recordPhase(phase VerificationPhase, err error) {
+	if r == nil {
+		return
+	}
+	for i := range r.Phases {
+		if r.Phases[i].Phase != phase {
+			continue
+		}
+		if err != nil {
+			r.Phases[i].Status = StatusFailed
+			r.Phases[i].Error = err.Error()
+		} else {
+			r.Phases[i].Status = StatusPassed
+		}
+	}
+}
+
+/*
+item returns the report for the passed step or inspection, creating it if it
+does not exist yet.  It returns nil on a nil report.
+*/
+func (r *VerificationReport) item(itemI interface{}) *ItemReport {
+	if r == nil {
+		return nil
+	}
+	switch item := itemI.(type) {
+	case Step:
+		if report := r.Step(item.Name); report != nil {
+			return report
+		}
+		report := &ItemReport{Name: item.Name, Type: "step", Status: StatusSkipped}
+		r.Steps = append(r.Steps, report)
+		return report
+	case Inspection:
+		if report := r.Inspection(item.Name); report != nil {
+			return report
+		}
+		report := &ItemReport{Name: item.Name, Type: "inspection", Status: StatusSkipped}
+		r.Inspections = append(r.Inspections, report)
+		return report
+	}
+	return nil
+}
+
+/*
+recordPlannedInspections marks the report as dry run and records the passed
+inspections as planned, see PlannedInspection.
+*/
+func (r *VerificationReport) recordPlannedInspections(inspections []Inspection) {
+	if r == nil {
+		return
+	}
+	r.DryRun = true
+	r.PlannedInspections = make([]PlannedInspection, 0, len(inspections))
+	for _, inspection := range inspections {
+		r.item(inspection)
+		r.PlannedInspections = append(r.PlannedInspections, PlannedInspection{
+			Name:              inspection.Name,
+			Run:               inspection.Run,
+			ExpectedMaterials: inspection.ExpectedMaterials,
+			ExpectedProducts:  inspection.ExpectedProducts,
+		})
+	}
+}
+
+/*
+finish sets the overall result of the report.
+*/
+func (r *VerificationReport) finish(summaryLink Metadata, err error) {
+	if r == nil {
+		return
+	}
+	r.SummaryLink = summaryLink
+	r.Passed = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// recordResult marks the item as passed or failed depending on err.
+func (ir *ItemReport) recordResult(err error) {
+	if ir == nil {
+		return
+	}
+	if err != nil {
+		ir.Status = StatusFailed
+		ir.Error = err.Error()
+		return
+	}
+	// Don't overwrite a failure recorded by an earlier phase
+	if ir.Status != StatusFailed {
+		ir.Status = StatusPassed
+	}
+}
+
+/*
+recordLinks stores the accepted and rejected links of a step, sorted by key id
+for a deterministic report.
+*/
+func (ir *ItemReport) recordLinks(stepName string, accepted map[string]Metadata,
+	rejected map[string]error) {
+	if ir == nil {
+		return
+	}
+	ir.AcceptedLinks = make([]LinkReport, 0, len(accepted))
+	for keyID := range accepted {
+		ir.AcceptedLinks = append(ir.AcceptedLinks, LinkReport{
+			Name:  fmt.Sprintf(LinkNameFormat, stepName, keyID),
+			KeyID: keyID,
+		})
+	}
+	ir.RejectedLinks = make([]LinkReport, 0, len(rejected))
+	for keyID, err := range rejected {
+		ir.RejectedLinks = append(ir.RejectedLinks, LinkReport{
+			Name:  fmt.Sprintf(LinkNameFormat, stepName, keyID),
+			KeyID: keyID,
+			Error: err.Error(),
+		})
+	}
+	sort.Slice(ir.AcceptedLinks, func(i, j int) bool {
+		return ir.AcceptedLinks[i].KeyID < ir.AcceptedLinks[j].KeyID
+	})
+	sort.Slice(ir.RejectedLinks, func(i, j int) bool {
+		return ir.RejectedLinks[i].KeyID < ir.RejectedLinks[j].KeyID
+	})
+}
+
+/*
+recordIdentities stores the passed functionary identities, keyed by key id, in
+the accepted links, if they differ from the key id.
+*/
+func (ir *ItemReport) recordIdentities(identities map[string]string) {
+	if ir == nil {
+		return
+	}
+	for i, link := range ir.AcceptedLinks {
+		if identity := identities[link.KeyID]; identity != link.KeyID {
+			ir.AcceptedLinks[i].Identity = identity
+		}
+	}
+}
+
+/*
+recordDissentingLinks stores the dissenting links of a step, identified by the
+passed sorted key ids.
+*/
+func (ir *ItemReport) recordDissentingLinks(stepName string, keyIDs []string) {
+	if ir == nil {
+		return
+	}
+	ir.DissentingLinks = make([]LinkReport, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		ir.DissentingLinks = append(ir.DissentingLinks, LinkReport{
+			Name:  fmt.Sprintf(LinkNameFormat, stepName, keyID),
+			KeyID: keyID,
+			Error: "reports different artifacts than the agreeing links",
+		})
+	}
+}
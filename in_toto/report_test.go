@@ -0,0 +1,127 @@
+package in_toto
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInTotoVerifyWithReport(t *testing.T) {
+	layoutMb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubKey Key
+	if err := pubKey.LoadKey("alice.pub", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{pubKey.KeyID: pubKey}
+
+	t.Run("passing verification", func(t *testing.T) {
+		report, err := InTotoVerifyWithReport(layoutMb, layoutKeys, ".", "",
+			map[string]string{}, [][]byte{}, testOSisWindows())
+		assert.Nil(t, err)
+		defer os.Remove("untar.link")
+
+		assert.True(t, report.Passed)
+		assert.NotNil(t, report.SummaryLink)
+		for _, phase := range report.Phases {
+			assert.Equal(t, StatusPassed, phase.Status, "phase %s", phase.Phase)
+		}
+
+		writeCode := report.Step("write-code")
+		if assert.NotNil(t, writeCode) {
+			assert.Equal(t, StatusPassed, writeCode.Status)
+			assert.Equal(t, []LinkReport{{
+				Name:  "write-code.b7d643de.link",
+				KeyID: "b7d643dec0a051096ee5d87221b5d91a33daa658699d30903e1cefb90c418401",
+			}}, writeCode.AcceptedLinks)
+			assert.Empty(t, writeCode.RejectedLinks)
+		}
+		untar := report.Inspection("untar")
+		if assert.NotNil(t, untar) {
+			assert.Equal(t, StatusPassed, untar.Status)
+		}
+
+		// The report must be serializable
+		_, err = json.Marshal(report)
+		assert.Nil(t, err)
+	})
+
+	t.Run("failing link loading", func(t *testing.T) {
+		report, err := InTotoVerifyWithReport(layoutMb, layoutKeys, "does-not-exist", "",
+			map[string]string{}, [][]byte{}, testOSisWindows())
+		assert.NotNil(t, err)
+		assert.False(t, report.Passed)
+		assert.Equal(t, err.Error(), report.Error)
+
+		phase, ok := report.Phase(PhaseLinkLoading)
+		assert.True(t, ok)
+		assert.Equal(t, StatusFailed, phase.Status)
+		phase, _ = report.Phase(PhaseThresholds)
+		assert.Equal(t, StatusSkipped, phase.Status)
+	})
+}
+
+func TestVerificationReportFailedRule(t *testing.T) {
+	rule := []string{"DISALLOW", "*"}
+	step := Step{SupplyChainItem: SupplyChainItem{Name: "foo",
+		ExpectedMaterials: [][]string{rule}}}
+	metadata := map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo",
+		Materials: map[string]HashObj{"foo.py": {"sha256": "abc"}}}}}
+
+	v := &verification{report: newVerificationReport()}
+	if err := v.verifyArtifacts([]interface{}{step}, metadata); err == nil {
+		t.Fatal("expected artifact rule error")
+	}
+
+	itemReport := v.report.Step("foo")
+	if itemReport == nil {
+		t.Fatal("expected report for step 'foo'")
+	}
+	if itemReport.Status != StatusFailed {
+		t.Errorf("expected status '%s', got '%s'", StatusFailed, itemReport.Status)
+	}
+	if !reflect.DeepEqual(itemReport.FailedRule, rule) {
+		t.Errorf("expected failed rule '%s', got '%s'", rule, itemReport.FailedRule)
+	}
+}
+
+func TestVerificationReportRejectedLinks(t *testing.T) {
+	keyID1 := "b7d643dec0a051096ee5d87221b5d91a33daa658699d30903e1cefb90c418401"
+	keyID2 := "d3ffd1086938b3698618adf088bf14b13db4c8ae19e4e78d73da49ee88492710"
+
+	mb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := mb.GetPayload().(Layout)
+	layout.Steps = []Step{{SupplyChainItem: SupplyChainItem{Name: "foo"},
+		Threshold: 1, PubKeys: []string{keyID1}}}
+
+	link1, err := LoadMetadata("foo.b7d643de.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link2, err := LoadMetadata("foo.d3ffd108.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &verification{report: newVerificationReport()}
+	_, err = v.verifyLinkSignatureThresholds(context.Background(), layout,
+		map[string]map[string]Metadata{"foo": {keyID1: link1, keyID2: link2}}, nil, nil)
+	assert.Nil(t, err)
+
+	itemReport := v.report.Step("foo")
+	assert.Equal(t, StatusPassed, itemReport.Status)
+	assert.Len(t, itemReport.AcceptedLinks, 1)
+	assert.Equal(t, keyID1, itemReport.AcceptedLinks[0].KeyID)
+	assert.Len(t, itemReport.RejectedLinks, 1)
+	assert.Equal(t, keyID2, itemReport.RejectedLinks[0].KeyID)
+	assert.NotEmpty(t, itemReport.RejectedLinks[0].Error)
+}
@@ -1,131 +1,91 @@
 package in_toto
 
 import (
-	"fmt"
+	"strconv"
 	"strings"
 )
 
-// An error message issued in UnpackRule if it receives a malformed rule.
-var errorMsg = "Wrong rule format, available formats are:\n" +
-	"\tMATCH <pattern> [IN <source-path-prefix>] WITH (MATERIALS|PRODUCTS)" +
-	" [IN <destination-path-prefix>] FROM <step>,\n" +
-	"\tCREATE <pattern>,\n" +
-	"\tDELETE <pattern>,\n" +
-	"\tMODIFY <pattern>,\n" +
-	"\tALLOW <pattern>,\n" +
-	"\tDISALLOW <pattern>,\n" +
-	"\tREQUIRE <filename>\n\n"
-
 /*
-UnpackRule parses the passed rule and extracts and returns the information
-required for rule processing.  It can be used to verify if a rule has a valid
-format.  Available rule formats are:
+UnpackRule parses the passed rule with ParseRule and extracts and returns the
+information required for rule processing.  It can be used to verify if a rule
+has a valid format.  Available rule formats are:
 
 	MATCH <pattern> [IN <source-path-prefix>] WITH (MATERIALS|PRODUCTS)
 		[IN <destination-path-prefix>] FROM <step>,
+	MATCH-DIGEST <pattern> FROM-FILE <manifest> WITH <algorithm> <hex digest>,
 	CREATE <pattern>,
 	DELETE <pattern>,
 	MODIFY <pattern>,
 	ALLOW <pattern>,
-	DISALLOW <pattern>
+	DISALLOW <pattern>,
+	REQUIRE <filename> [WITH <algorithm> <hex digest>],
+	REQUIRE-ANY <pattern>,
+	REQUIRE-ALL-OF <pattern> <pattern>...,
+	EXPECT-COUNT <pattern> (==|!=|<|<=|>|>=) <count>
 
-Rule tokens are normalized to lower case before returning.  The returned map
-has the following format:
+Rule tokens and hash algorithms are normalized to lower case before
+returning.  The returned map has the following format, where the pattern of a
+REQUIRE-ALL-OF rule is its first pattern, see RequireAllOfRule for all:
 
 	{
-		"type": "match" | "create" | "delete" |"modify" | "allow" | "disallow"
+		"type": "match" | "match-digest" | "create" | "delete" |"modify" |
+			"allow" | "disallow" | "require" | "require-any" |
+			"require-all-of" | "expect-count"
 		"pattern": "<file name pattern>",
 		"srcPrefix": "<path or empty string>", // MATCH rule only
 		"dstPrefix": "<path or empty string>", // MATCH rule only
 		"dstType": "materials" | "products">, // MATCH rule only
 		"dstName": "<step name>", // Match rule only
+		"manifest": "<manifest path>", // MATCH-DIGEST rule only
+		"algorithm": "<hash algorithm>", // MATCH-DIGEST or REQUIRE rule with digest only
+		"digest": "<hex digest>", // MATCH-DIGEST or REQUIRE rule with digest only
+		"op": "==" | "!=" | "<" | "<=" | ">" | ">=", // EXPECT-COUNT rule only
+		"count": "<non-negative integer>", // EXPECT-COUNT rule only
 	}
 
 If the rule does not match any of the available formats the first return value
-is nil and the second return value is the error.
+is nil and the second return value is a RuleSyntaxError.
 */
 func UnpackRule(rule []string) (map[string]string, error) {
-	// Cache rule len
-	ruleLen := len(rule)
-
-	// Create all lower rule copy to case-insensitively parse out tokens whose
-	// position we don't know yet. We keep the original rule to retain the
-	// non-token elements' case.
-	ruleLower := make([]string, ruleLen)
-	for i, val := range rule {
-		ruleLower[i] = strings.ToLower(val)
+	parsed, err := ParseRule(rule)
+	if err != nil {
+		return nil, err
 	}
 
-	switch ruleLower[0] {
-	case "create", "modify", "delete", "allow", "disallow", "require":
-		if ruleLen != 2 {
-			return nil,
-				fmt.Errorf("%s Got:\n\t %s", errorMsg, rule)
-		}
-
-		return map[string]string{
-			"type":    ruleLower[0],
-			"pattern": rule[1],
-		}, nil
-
-	case "match":
-		var srcPrefix string
-		var dstType string
-		var dstPrefix string
-		var dstName string
-
-		// MATCH <pattern> IN <source-path-prefix> WITH (MATERIALS|PRODUCTS) \
-		// IN <destination-path-prefix> FROM <step>
-		if ruleLen == 10 && ruleLower[2] == "in" &&
-			ruleLower[4] == "with" && ruleLower[6] == "in" &&
-			ruleLower[8] == "from" {
-			srcPrefix = rule[3]
-			dstType = ruleLower[5]
-			dstPrefix = rule[7]
-			dstName = rule[9]
-			// MATCH <pattern> IN <source-path-prefix> WITH (MATERIALS|PRODUCTS) \
-			// FROM <step>
-		} else if ruleLen == 8 && ruleLower[2] == "in" &&
-			ruleLower[4] == "with" && ruleLower[6] == "from" {
-			srcPrefix = rule[3]
-			dstType = ruleLower[5]
-			dstPrefix = ""
-			dstName = rule[7]
-
-			// MATCH <pattern> WITH (MATERIALS|PRODUCTS) IN <destination-path-prefix>
-			// FROM <step>
-		} else if ruleLen == 8 && ruleLower[2] == "with" &&
-			ruleLower[4] == "in" && ruleLower[6] == "from" {
-			srcPrefix = ""
-			dstType = ruleLower[3]
-			dstPrefix = rule[5]
-			dstName = rule[7]
-
-			// MATCH <pattern> WITH (MATERIALS|PRODUCTS) FROM <step>
-		} else if ruleLen == 6 && ruleLower[2] == "with" &&
-			ruleLower[4] == "from" {
-			srcPrefix = ""
-			dstType = ruleLower[3]
-			dstPrefix = ""
-			dstName = rule[5]
-
-		} else {
-			return nil,
-				fmt.Errorf("%s Got:\n\t %s", errorMsg, rule)
-
+	ruleType := strings.ToLower(parsed.Tokens()[0])
+	ruleData := map[string]string{
+		"type":    ruleType,
+		"pattern": parsed.Patterns()[0],
+	}
+	switch r := parsed.(type) {
+	case MatchRule:
+		ruleData["srcPrefix"] = r.SourcePrefix
+		ruleData["dstPrefix"] = r.DestinationPrefix
+		ruleData["dstType"] = r.DestinationType
+		ruleData["dstName"] = r.DestinationName
+	case MatchDigestRule:
+		ruleData["manifest"] = r.Manifest
+		ruleData["algorithm"] = r.Algorithm
+		ruleData["digest"] = r.Digest
+	case RequireRule:
+		if r.Digest != "" {
+			ruleData["algorithm"] = r.Algorithm
+			ruleData["digest"] = r.Digest
 		}
-
-		return map[string]string{
-			"type":      ruleLower[0],
-			"pattern":   rule[1],
-			"srcPrefix": srcPrefix,
-			"dstPrefix": dstPrefix,
-			"dstType":   dstType,
-			"dstName":   dstName,
-		}, nil
-
-	default:
-		return nil,
-			fmt.Errorf("%s Got:\n\t %s", errorMsg, rule)
+	case ExpectCountRule:
+		ruleData["op"] = r.Op
+		ruleData["count"] = strconv.Itoa(r.Count)
 	}
+	return ruleData, nil
+}
+
+// countComparisons maps the comparison operators of EXPECT-COUNT rules to
+// their implementation
+var countComparisons = map[string]func(actual, expected int) bool{
+	"==": func(actual, expected int) bool { return actual == expected },
+	"!=": func(actual, expected int) bool { return actual != expected },
+	"<":  func(actual, expected int) bool { return actual < expected },
+	"<=": func(actual, expected int) bool { return actual <= expected },
+	">":  func(actual, expected int) bool { return actual > expected },
+	">=": func(actual, expected int) bool { return actual >= expected },
 }
@@ -1,7 +1,10 @@
 package in_toto
 
 import (
+	"errors"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestUnpackValidRules(t *testing.T) {
@@ -21,6 +24,12 @@ func TestUnpackValidRules(t *testing.T) {
 		{"MATCH", "foo", "WITH", "PRODUCTS", "IN", "dest-path",
 			"FROM", "step-name"},
 		{"MATCH", "foo", "WITH", "MATERIALS", "FROM", "step-name"},
+		{"REQUIRE", "foo", "WITH", "SHA256", "ABCDEF"},
+		{"MATCH-DIGEST", "foo", "FROM-FILE", "SHA256SUMS", "WITH", "sha256",
+			"ABCDEF"},
+		{"REQUIRE-ANY", "*.sig"},
+		{"REQUIRE-ALL-OF", "*.sig", "*.tar.gz"},
+		{"EXPECT-COUNT", "*.tar.gz", "==", "1"},
 	}
 
 	// These are the expected results from rulelib.UnpackRule for above rules
@@ -44,6 +53,13 @@ func TestUnpackValidRules(t *testing.T) {
 		{"type": "match", "pattern": "foo",
 			"srcPrefix": "", "dstPrefix": "",
 			"dstType": "materials", "dstName": "step-name"},
+		{"type": "require", "pattern": "foo", "algorithm": "sha256",
+			"digest": "abcdef"},
+		{"type": "match-digest", "pattern": "foo", "manifest": "SHA256SUMS",
+			"algorithm": "sha256", "digest": "abcdef"},
+		{"type": "require-any", "pattern": "*.sig"},
+		{"type": "require-all-of", "pattern": "*.sig"},
+		{"type": "expect-count", "pattern": "*.tar.gz", "op": "==", "count": "1"},
 	}
 
 	for i, rule := range rules {
@@ -53,7 +69,8 @@ func TestUnpackValidRules(t *testing.T) {
 		}
 
 		for _, key := range []string{"type", "pattern", "srcPrefix", "dstPrefix",
-			"dstName", "dstType"} {
+			"dstName", "dstType", "manifest", "algorithm", "digest", "op",
+			"count"} {
 			if returnedRuleMap[key] != expectedRuleMaps[i][key] {
 				t.Errorf("invalid '%s' in unpacked rule '%s', should be '%s', got"+
 					" '%s'", key, rule, expectedRuleMaps[i][key],
@@ -71,6 +88,17 @@ func TestUnpackInvalidRules(t *testing.T) {
 		{"MATCH", "foo", "too-many-patterns", "IN", "source-path", "WITH",
 			"PRODUCTS", "IN", "dest-path", "FROM", "step-name"},
 		{"MATCH", "foo", "WITH", "GUMMY", "BEARS"},
+		{"REQUIRE", "foo", "WITH", "sha256"},
+		{"REQUIRE", "foo", "WITH", "sha256", "not-hex"},
+		{"MATCH-DIGEST", "foo", "FROM", "SHA256SUMS"},
+		{"MATCH-DIGEST", "foo", "FROM-FILE", "SHA256SUMS"},
+		{"MATCH-DIGEST", "foo", "FROM-FILE", "/etc/SHA256SUMS", "WITH", "sha256",
+			"abcdef"},
+		{"REQUIRE-ANY", "*.sig", "*.asc"},
+		{"REQUIRE-ALL-OF"},
+		{"EXPECT-COUNT", "*.tar.gz", "=", "1"},
+		{"EXPECT-COUNT", "*.tar.gz", "==", "-1"},
+		{"EXPECT-COUNT", "*.tar.gz", "==", "one"},
 	}
 	for _, rule := range rules {
 		if _, err := UnpackRule(rule); err == nil {
@@ -78,3 +106,128 @@ func TestUnpackInvalidRules(t *testing.T) {
 		}
 	}
 }
+
+func TestParseRule(t *testing.T) {
+	tables := []struct {
+		rule     []string
+		expected ArtifactRule
+		tokens   []string
+	}{
+		{[]string{"match", "foo", "in", "src", "with", "products", "in", "dst",
+			"from", "build"},
+			MatchRule{Pattern: "foo", SourcePrefix: "src", DestinationType: "products",
+				DestinationPrefix: "dst", DestinationName: "build"},
+			[]string{"MATCH", "foo", "IN", "src", "WITH", "PRODUCTS", "IN", "dst",
+				"FROM", "build"}},
+		{[]string{"MATCH", "foo", "WITH", "MATERIALS", "FROM", "build"},
+			MatchRule{Pattern: "foo", DestinationType: "materials",
+				DestinationName: "build"}, nil},
+		{[]string{"MATCH-DIGEST", "vendor/*", "FROM-FILE", "SHA256SUMS", "with",
+			"sha256", "ABC"},
+			MatchDigestRule{Pattern: "vendor/*", Manifest: "SHA256SUMS",
+				Algorithm: "sha256", Digest: "abc"},
+			[]string{"MATCH-DIGEST", "vendor/*", "FROM-FILE", "SHA256SUMS", "WITH",
+				"sha256", "abc"}},
+		{[]string{"Allow", "*.py"}, AllowRule{Pattern: "*.py"},
+			[]string{"ALLOW", "*.py"}},
+		{[]string{"DISALLOW", "*"}, DisallowRule{Pattern: "*"}, nil},
+		{[]string{"CREATE", "foo"}, CreateRule{Pattern: "foo"}, nil},
+		{[]string{"DELETE", "foo"}, DeleteRule{Pattern: "foo"}, nil},
+		{[]string{"MODIFY", "foo"}, ModifyRule{Pattern: "foo"}, nil},
+		{[]string{"REQUIRE", "foo"}, RequireRule{Filename: "foo"}, nil},
+		{[]string{"REQUIRE", "foo", "with", "SHA256", "ABC"},
+			RequireRule{Filename: "foo", Algorithm: "sha256", Digest: "abc"},
+			[]string{"REQUIRE", "foo", "WITH", "sha256", "abc"}},
+		{[]string{"REQUIRE-ANY", "*.sig"}, RequireAnyRule{Pattern: "*.sig"}, nil},
+		{[]string{"REQUIRE-ALL-OF", "*.sig", "*.tar.gz"},
+			RequireAllOfRule{PatternList: []string{"*.sig", "*.tar.gz"}}, nil},
+		{[]string{"EXPECT-COUNT", "*.tar.gz", ">=", "1"},
+			ExpectCountRule{Pattern: "*.tar.gz", Op: ">=", Count: 1}, nil},
+	}
+	for _, table := range tables {
+		parsed, err := ParseRule(table.rule)
+		assert.Nil(t, err)
+		assert.Equal(t, table.expected, parsed)
+		if table.tokens == nil {
+			table.tokens = table.rule
+		}
+		assert.Equal(t, table.tokens, parsed.Tokens())
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	tables := []struct {
+		rule     []string
+		position int
+		err      string
+	}{
+		{[]string{}, 1, "expected rule type at token 1, got end of rule"},
+		{[]string{"SUBVERT", "foo"}, 1, "unknown rule type at token 1, got 'SUBVERT'"},
+		{[]string{"CREATE"}, 2, "expected pattern at token 2, got end of rule"},
+		{[]string{"CREATE", "foo", "bar"}, 3,
+			"expected end of rule at token 3, got 'bar'"},
+		{[]string{"MATCH", "foo", "FROM", "build"}, 3,
+			"expected WITH at token 3, got 'FROM'"},
+		{[]string{"MATCH", "foo", "WITH", "GUMMY", "BEARS"}, 4,
+			"expected MATERIALS or PRODUCTS at token 4, got 'GUMMY'"},
+		{[]string{"MATCH", "foo", "IN", "src", "WITH", "PRODUCTS", "build"}, 7,
+			"expected FROM at token 7, got 'build'"},
+		{[]string{"MATCH", "foo", "WITH", "PRODUCTS", "FROM"}, 6,
+			"expected step or inspection name at token 6, got end of rule"},
+		{[]string{"REQUIRE", "foo", "WITH", "sha256", "xyz"}, 5,
+			"expected hex digest at token 5, got 'xyz'"},
+		{[]string{"MATCH-DIGEST", "foo", "FROM-FILE", "/SHA256SUMS"}, 4,
+			"expected relative manifest path at token 4, got '/SHA256SUMS'"},
+		{[]string{"MATCH-DIGEST", "foo", "FROM-FILE", "../SHA256SUMS"}, 4,
+			"expected relative manifest path at token 4, got '../SHA256SUMS'"},
+		{[]string{"MATCH-DIGEST", "foo", "FROM-FILE", "SHA256SUMS"}, 5,
+			"expected WITH at token 5, got end of rule"},
+		{[]string{"EXPECT-COUNT", "foo", "=", "1"}, 3,
+			"expected == or != or < or <= or > or >= at token 3, got '='"},
+		{[]string{"EXPECT-COUNT", "foo", "==", "-1"}, 4,
+			"expected non-negative count at token 4, got '-1'"},
+		{[]string{"REQUIRE-ALL-OF"}, 2, "expected pattern at token 2"},
+	}
+	for _, table := range tables {
+		_, err := ParseRule(table.rule)
+		var syntaxErr *RuleSyntaxError
+		if assert.True(t, errors.As(err, &syntaxErr), table.rule) {
+			assert.Equal(t, table.position, syntaxErr.Position)
+			assert.ErrorContains(t, err, table.err)
+		}
+	}
+}
+
+func TestParseLayoutRule(t *testing.T) {
+	rule := []string{"REQUIRE", "foo", "WITH", "{ALGORITHM}", "{DIGEST}"}
+	parsed, err := parseLayoutRule(rule)
+	assert.Nil(t, err)
+	assert.Equal(t, RequireRule{Filename: "foo", Algorithm: "{ALGORITHM}",
+		Digest: "{DIGEST}"}, parsed)
+
+	// Placeholders are only accepted before parameter substitution
+	_, err = ParseRule(rule)
+	assert.ErrorContains(t, err, "expected hex digest at token 5, got '{DIGEST}'")
+
+	rule = []string{"EXPECT-COUNT", "*.tar.gz", "==", "{COUNT}"}
+	parsed, err = parseLayoutRule(rule)
+	assert.Nil(t, err)
+	assert.Equal(t, ExpectCountRule{Pattern: "*.tar.gz", Op: "=="}, parsed)
+	_, err = ParseRule(rule)
+	assert.ErrorContains(t, err, "expected non-negative count at token 4,"+
+		" got '{COUNT}'")
+}
+
+func TestTokenizeRule(t *testing.T) {
+	tokens, err := TokenizeRule(`  MATCH "my file" WITH PRODUCTS FROM 'build step' `)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"MATCH", "my file", "WITH", "PRODUCTS", "FROM",
+		"build step"}, tokens)
+
+	tokens, err = TokenizeRule(`ALLOW ""`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ALLOW", ""}, tokens)
+
+	_, err = TokenizeRule(`ALLOW "foo`)
+	assert.EqualError(t, err, `unterminated quote in rule 'ALLOW "foo'`)
+}
@@ -0,0 +1,485 @@
+package in_toto
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+ArtifactRule is a parsed artifact rule, see ParseRule.  Layouts keep storing
+rules as lists of tokens, which Tokens returns in canonical form, i.e. with
+upper case keywords.  Patterns returns the artifact patterns of the rule.
+*/
+type ArtifactRule interface {
+	Tokens() []string
+	Patterns() []string
+}
+
+/*
+MatchRule is a rule of the form:
+
+	MATCH <pattern> [IN <source-path-prefix>] WITH (MATERIALS|PRODUCTS)
+		[IN <destination-path-prefix>] FROM <step>
+
+DestinationType is either "materials" or "products".
+*/
+type MatchRule struct {
+	Pattern           string
+	SourcePrefix      string
+	DestinationType   string
+	DestinationPrefix string
+	DestinationName   string
+}
+
+/*
+MatchDigestRule is a rule of the form:
+
+	MATCH-DIGEST <pattern> FROM-FILE <manifest> WITH <algorithm> <hex digest>
+
+Manifest is a relative path, which must not leave the manifest directory.  The
+manifest must have the pinned digest, because it is not signed itself.
+Algorithm and Digest are lower case.
+*/
+type MatchDigestRule struct {
+	Pattern   string
+	Manifest  string
+	Algorithm string
+	Digest    string
+}
+
+// CreateRule is a rule of the form: CREATE <pattern>
+type CreateRule struct{ Pattern string }
+
+// DeleteRule is a rule of the form: DELETE <pattern>
+type DeleteRule struct{ Pattern string }
+
+// ModifyRule is a rule of the form: MODIFY <pattern>
+type ModifyRule struct{ Pattern string }
+
+// AllowRule is a rule of the form: ALLOW <pattern>
+type AllowRule struct{ Pattern string }
+
+// DisallowRule is a rule of the form: DISALLOW <pattern>
+type DisallowRule struct{ Pattern string }
+
+/*
+RequireRule is a rule of the form:
+
+	REQUIRE <filename> [WITH <algorithm> <hex digest>]
+
+Algorithm and Digest are lower case and empty without digest.
+*/
+type RequireRule struct {
+	Filename  string
+	Algorithm string
+	Digest    string
+}
+
+// RequireAnyRule is a rule of the form: REQUIRE-ANY <pattern>
+type RequireAnyRule struct{ Pattern string }
+
+// RequireAllOfRule is a rule of the form: REQUIRE-ALL-OF <pattern>...
+type RequireAllOfRule struct{ PatternList []string }
+
+/*
+ExpectCountRule is a rule of the form:
+
+	EXPECT-COUNT <pattern> (==|!=|<|<=|>|>=) <count>
+*/
+type ExpectCountRule struct {
+	Pattern string
+	Op      string
+	Count   int
+}
+
+func (r MatchRule) Tokens() []string {
+	tokens := []string{"MATCH", r.Pattern}
+	if r.SourcePrefix != "" {
+		tokens = append(tokens, "IN", r.SourcePrefix)
+	}
+	tokens = append(tokens, "WITH", strings.ToUpper(r.DestinationType))
+	if r.DestinationPrefix != "" {
+		tokens = append(tokens, "IN", r.DestinationPrefix)
+	}
+	return append(tokens, "FROM", r.DestinationName)
+}
+
+func (r MatchDigestRule) Tokens() []string {
+	return []string{"MATCH-DIGEST", r.Pattern, "FROM-FILE", r.Manifest, "WITH",
+		r.Algorithm, r.Digest}
+}
+
+func (r CreateRule) Tokens() []string     { return []string{"CREATE", r.Pattern} }
+func (r DeleteRule) Tokens() []string     { return []string{"DELETE", r.Pattern} }
+func (r ModifyRule) Tokens() []string     { return []string{"MODIFY", r.Pattern} }
+func (r AllowRule) Tokens() []string      { return []string{"ALLOW", r.Pattern} }
+func (r DisallowRule) Tokens() []string   { return []string{"DISALLOW", r.Pattern} }
+func (r RequireAnyRule) Tokens() []string { return []string{"REQUIRE-ANY", r.Pattern} }
+
+func (r RequireRule) Tokens() []string {
+	if r.Digest == "" {
+		return []string{"REQUIRE", r.Filename}
+	}
+	return []string{"REQUIRE", r.Filename, "WITH", r.Algorithm, r.Digest}
+}
+
+func (r RequireAllOfRule) Tokens() []string {
+	return append([]string{"REQUIRE-ALL-OF"}, r.PatternList...)
+}
+
+func (r ExpectCountRule) Tokens() []string {
+	return []string{"EXPECT-COUNT", r.Pattern, r.Op, strconv.Itoa(r.Count)}
+}
+
+func (r MatchRule) Patterns() []string        { return []string{r.Pattern} }
+func (r MatchDigestRule) Patterns() []string  { return []string{r.Pattern} }
+func (r CreateRule) Patterns() []string       { return []string{r.Pattern} }
+func (r DeleteRule) Patterns() []string       { return []string{r.Pattern} }
+func (r ModifyRule) Patterns() []string       { return []string{r.Pattern} }
+func (r AllowRule) Patterns() []string        { return []string{r.Pattern} }
+func (r DisallowRule) Patterns() []string     { return []string{r.Pattern} }
+func (r RequireRule) Patterns() []string      { return []string{r.Filename} }
+func (r RequireAnyRule) Patterns() []string   { return []string{r.Pattern} }
+func (r RequireAllOfRule) Patterns() []string { return r.PatternList }
+func (r ExpectCountRule) Patterns() []string  { return []string{r.Pattern} }
+
+/*
+RuleSyntaxError is returned by ParseRule for a malformed rule.  Position is the
+one-based index of the offending token in Rule, or len(Rule)+1 if the rule
+ended prematurely.
+*/
+type RuleSyntaxError struct {
+	Rule     []string
+	Position int
+	Msg      string
+}
+
+func (e *RuleSyntaxError) Error() string {
+	found := "end of rule"
+	if e.Position <= len(e.Rule) {
+		found = fmt.Sprintf("'%s'", e.Rule[e.Position-1])
+	}
+	return fmt.Sprintf("invalid rule format: %s at token %d, got %s, in rule %s",
+		e.Msg, e.Position, found, e.Rule)
+}
+
+// ruleParser is a cursor over the tokens of a rule
+type ruleParser struct {
+	tokens []string
+	pos    int
+	// accept parameter placeholders in place of values, see parseLayoutRule
+	placeholders bool
+}
+
+// fail returns a syntax error for the token at the cursor
+func (p *ruleParser) fail(format string, args ...interface{}) error {
+	return &RuleSyntaxError{
+		Rule:     p.tokens,
+		Position: p.pos + 1,
+		Msg:      fmt.Sprintf(format, args...),
+	}
+}
+
+// value consumes and returns the token at the cursor, which is described by
+// what in the error returned at the end of the rule
+func (p *ruleParser) value(what string) (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", p.fail("expected %s", what)
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+// keyword consumes the token at the cursor, if it is one of the passed
+// keywords regardless of case, and returns the keyword in lower case
+func (p *ruleParser) keyword(keywords ...string) (string, error) {
+	if p.pos < len(p.tokens) {
+		for _, keyword := range keywords {
+			if strings.EqualFold(p.tokens[p.pos], keyword) {
+				p.pos++
+				return strings.ToLower(keyword), nil
+			}
+		}
+	}
+	return "", p.fail("expected %s", strings.Join(keywords, " or "))
+}
+
+// optional consumes the token at the cursor and returns true, if it is the
+// passed keyword regardless of case
+func (p *ruleParser) optional(keyword string) bool {
+	if p.pos < len(p.tokens) && strings.EqualFold(p.tokens[p.pos], keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// end fails if there are tokens left
+func (p *ruleParser) end() error {
+	if p.pos < len(p.tokens) {
+		return p.fail("expected end of rule")
+	}
+	return nil
+}
+
+/*
+ParseRule parses the passed artifact rule, as found in the ExpectedMaterials
+and ExpectedProducts of steps and inspections, into one of MatchRule,
+MatchDigestRule, CreateRule, DeleteRule, ModifyRule, AllowRule, DisallowRule,
+RequireRule, RequireAnyRule, RequireAllOfRule and ExpectCountRule.  Keywords
+are case-insensitive.  A malformed rule yields a RuleSyntaxError, which
+points to the offending token.
+*/
+func ParseRule(rule []string) (ArtifactRule, error) {
+	return (&ruleParser{tokens: rule}).parse()
+}
+
+/*
+parseLayoutRule parses the passed artifact rule of a layout, whose parameters
+may not be substituted yet, see SubstituteParameters.  Other than ParseRule,
+it accepts parameter placeholders in place of hash algorithms, hex digests and
+counts, which are validated after substitution.  The returned rule is only
+meant for validation.
+*/
+func parseLayoutRule(rule []string) (ArtifactRule, error) {
+	return (&ruleParser{tokens: rule, placeholders: true}).parse()
+}
+
+// parse parses the rule, see ParseRule
+func (p *ruleParser) parse() (ArtifactRule, error) {
+	rule := p.tokens
+	ruleType, err := p.value("rule type")
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed ArtifactRule
+	switch strings.ToLower(ruleType) {
+	case "match":
+		parsed, err = p.parseMatch()
+	case "match-digest":
+		parsed, err = p.parseMatchDigest()
+	case "create", "delete", "modify", "allow", "disallow", "require-any":
+		var pattern string
+		if pattern, err = p.value("pattern"); err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(ruleType) {
+		case "create":
+			parsed = CreateRule{pattern}
+		case "delete":
+			parsed = DeleteRule{pattern}
+		case "modify":
+			parsed = ModifyRule{pattern}
+		case "allow":
+			parsed = AllowRule{pattern}
+		case "disallow":
+			parsed = DisallowRule{pattern}
+		case "require-any":
+			parsed = RequireAnyRule{pattern}
+		}
+	case "require":
+		parsed, err = p.parseRequire()
+	case "require-all-of":
+		var r RequireAllOfRule
+		var pattern string
+		if pattern, err = p.value("pattern"); err != nil {
+			return nil, err
+		}
+		r.PatternList = append([]string{pattern}, rule[p.pos:]...)
+		p.pos = len(rule)
+		parsed = r
+	case "expect-count":
+		parsed, err = p.parseExpectCount()
+	default:
+		p.pos--
+		return nil, p.fail("unknown rule type")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// parseMatch parses the remainder of a MATCH rule
+func (p *ruleParser) parseMatch() (ArtifactRule, error) {
+	var r MatchRule
+	var err error
+	if r.Pattern, err = p.value("pattern"); err != nil {
+		return nil, err
+	}
+	if p.optional("IN") {
+		if r.SourcePrefix, err = p.value("source path prefix"); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = p.keyword("WITH"); err != nil {
+		return nil, err
+	}
+	if r.DestinationType, err = p.keyword("MATERIALS", "PRODUCTS"); err != nil {
+		return nil, err
+	}
+	if p.optional("IN") {
+		if r.DestinationPrefix, err = p.value("destination path prefix"); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = p.keyword("FROM"); err != nil {
+		return nil, err
+	}
+	if r.DestinationName, err = p.value("step or inspection name"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseMatchDigest parses the remainder of a MATCH-DIGEST rule
+func (p *ruleParser) parseMatchDigest() (ArtifactRule, error) {
+	var r MatchDigestRule
+	var err error
+	if r.Pattern, err = p.value("pattern"); err != nil {
+		return nil, err
+	}
+	if _, err = p.keyword("FROM-FILE"); err != nil {
+		return nil, err
+	}
+	if r.Manifest, err = p.value("manifest"); err != nil {
+		return nil, err
+	}
+	if !filepath.IsLocal(r.Manifest) {
+		p.pos--
+		return nil, p.fail("expected relative manifest path")
+	}
+	if _, err = p.keyword("WITH"); err != nil {
+		return nil, err
+	}
+	if r.Algorithm, r.Digest, err = p.digest(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseRequire parses the remainder of a REQUIRE rule
+func (p *ruleParser) parseRequire() (ArtifactRule, error) {
+	var r RequireRule
+	var err error
+	if r.Filename, err = p.value("filename"); err != nil {
+		return nil, err
+	}
+	if !p.optional("WITH") {
+		return r, nil
+	}
+	if r.Algorithm, r.Digest, err = p.digest(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// digest consumes a hash algorithm and a hex digest and returns both in lower
+// case, unless they are parameter placeholders
+func (p *ruleParser) digest() (string, string, error) {
+	algorithm, err := p.value("hash algorithm")
+	if err != nil {
+		return "", "", err
+	}
+	digest, err := p.value("hex digest")
+	if err != nil {
+		return "", "", err
+	}
+	if p.isPlaceholder(digest) {
+		return lowerUnlessPlaceholder(algorithm), digest, nil
+	}
+	if validateHexString(digest) != nil {
+		p.pos--
+		return "", "", p.fail("expected hex digest")
+	}
+	return lowerUnlessPlaceholder(algorithm), strings.ToLower(digest), nil
+}
+
+// isPlaceholder returns true if the passed token contains a parameter
+// placeholder, which the parser accepts in place of a value
+func (p *ruleParser) isPlaceholder(token string) bool {
+	return p.placeholders && containsPlaceholder(token)
+}
+
+// lowerUnlessPlaceholder returns the passed token in lower case, unless it
+// contains a parameter placeholder, whose name is case-sensitive
+func lowerUnlessPlaceholder(token string) string {
+	if containsPlaceholder(token) {
+		return token
+	}
+	return strings.ToLower(token)
+}
+
+// parseExpectCount parses the remainder of an EXPECT-COUNT rule
+func (p *ruleParser) parseExpectCount() (ArtifactRule, error) {
+	var r ExpectCountRule
+	var err error
+	if r.Pattern, err = p.value("pattern"); err != nil {
+		return nil, err
+	}
+	if r.Op, err = p.keyword("==", "!=", "<", "<=", ">", ">="); err != nil {
+		return nil, err
+	}
+	count, err := p.value("count")
+	if err != nil {
+		return nil, err
+	}
+	if p.isPlaceholder(count) {
+		// The count is checked once the layout's parameters are substituted
+		return r, nil
+	}
+	if r.Count, err = strconv.Atoi(count); err != nil || r.Count < 0 {
+		p.pos--
+		return nil, p.fail("expected non-negative count")
+	}
+	return r, nil
+}
+
+/*
+TokenizeRule splits an artifact rule written as a single line, e.g.
+"MATCH 'my file' WITH PRODUCTS FROM build", into its tokens, which can be
+passed to ParseRule or stored in a layout.  Tokens are separated by white
+space, unless quoted with single or double quotes.
+*/
+func TokenizeRule(rule string) ([]string, error) {
+	var tokens []string
+	var token strings.Builder
+	inToken := false
+	var quote rune
+	for _, c := range rule {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				token.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inToken = true
+		case unicode.IsSpace(c):
+			if inToken {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				inToken = false
+			}
+		default:
+			token.WriteRune(c)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in rule '%s'", rule)
+	}
+	if inToken {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, nil
+}
@@ -2,15 +2,16 @@ package in_toto
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/shibumi/go-pathspec"
 )
@@ -23,6 +24,13 @@ var ErrUnsupportedHashAlgorithm = errors.New("unsupported hash algorithm detecte
 
 var ErrEmptyCommandArgs = errors.New("the command args are empty")
 
+/*
+commandWaitDelay is the time RunCommandContext waits for the output pipes of a
+command to be closed after the command was killed due to the cancellation of
+its context, e.g. because it started child processes, which are not killed.
+*/
+const commandWaitDelay = 5 * time.Second
+
 // visitedSymlinks is a hashset that contains all paths that we have visited.
 var visitedSymlinks Set
 
@@ -93,9 +101,20 @@ If recording an artifact fails the first return value is nil and the second
 return value is the error.
 */
 func RecordArtifacts(paths []string, hashAlgorithms []string, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool) (evalArtifacts map[string]HashObj, err error) {
+	return RecordArtifactsContext(context.Background(), paths, hashAlgorithms,
+		gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+}
+
+/*
+RecordArtifactsContext provides the same functionality as RecordArtifacts, but
+aborts recording, if the passed context is done before all artifacts are
+recorded.  In that case the context's error is returned.  Recorded artifacts
+are logged at debug level, see ContextWithLogger.
+*/
+func RecordArtifactsContext(ctx context.Context, paths []string, hashAlgorithms []string, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool) (evalArtifacts map[string]HashObj, err error) {
 	// Make sure to initialize a fresh hashset for every RecordArtifacts call
 	visitedSymlinks = NewSet()
-	evalArtifactsUnnormalized, err := recordArtifacts(paths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+	evalArtifactsUnnormalized, err := recordArtifacts(ctx, paths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +125,8 @@ func RecordArtifacts(paths []string, hashAlgorithms []string, gitignorePatterns
 		// Convert windows filepath to unix filepath.
 		evalArtifacts[filepath.ToSlash(key)] = value
 	}
+	loggerFromContext(ctx).Debug("recorded artifacts", "paths", paths,
+		"count", len(evalArtifacts))
 
 	return evalArtifacts, nil
 }
@@ -128,7 +149,7 @@ the following format:
 If recording an artifact fails the first return value is nil and the second
 return value is the error.
 */
-func recordArtifacts(paths []string, hashAlgorithms []string, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool) (map[string]HashObj, error) {
+func recordArtifacts(ctx context.Context, paths []string, hashAlgorithms []string, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool) (map[string]HashObj, error) {
 	artifacts := make(map[string]HashObj)
 	for _, path := range paths {
 		err := filepath.Walk(path,
@@ -138,6 +159,10 @@ func recordArtifacts(paths []string, hashAlgorithms []string, gitignorePatterns
 				if err != nil {
 					return err
 				}
+				// Abort if the context is done, e.g. due to a timeout
+				if err := ctx.Err(); err != nil {
+					return err
+				}
 				// We need to call pathspec.GitIgnore inside of our filepath.Walk, because otherwise
 				// we will not catch all paths. Just imagine a path like "." and a pattern like "*.pub".
 				// If we would call pathspec outside of the filepath.Walk this would not match.
@@ -188,7 +213,7 @@ func recordArtifacts(paths []string, hashAlgorithms []string, gitignorePatterns
 					visitedSymlinks.Add(path)
 					// We recursively call recordArtifacts() to follow
 					// the new path.
-					evalArtifacts, evalErr := recordArtifacts([]string{evalSym}, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+					evalArtifacts, evalErr := recordArtifacts(ctx, []string{evalSym}, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
 					if evalErr != nil {
 						return evalErr
 					}
@@ -208,6 +233,7 @@ func recordArtifacts(paths []string, hashAlgorithms []string, gitignorePatterns
 				if err != nil {
 					return err
 				}
+				loggerFromContext(ctx).Debug("recorded artifact", "path", path)
 
 				for _, strip := range lStripPaths {
 					if strings.HasPrefix(path, strip) {
@@ -275,39 +301,57 @@ NOTE: Since stdout and stderr are captured, they cannot be seen during the
 command execution.
 */
 func RunCommand(cmdArgs []string, runDir string) (map[string]interface{}, error) {
+	return RunCommandContext(context.Background(), cmdArgs, runDir)
+}
+
+/*
+RunCommandContext provides the same functionality as RunCommand, but kills the
+command, if the passed context is done before the command exits.  In that case
+the first return value is nil and the second return value is the context's
+error.
+*/
+func RunCommandContext(ctx context.Context, cmdArgs []string, runDir string) (map[string]interface{}, error) {
 	if len(cmdArgs) == 0 {
 		return nil, ErrEmptyCommandArgs
 	}
 
-	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
-
+	cmd := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
 	if runDir != "" {
 		cmd.Dir = runDir
 	}
+	return runPreparedCommand(ctx, cmd)
+}
 
-	stderrPipe, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, err
-	}
-	stdoutPipe, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, err
-	}
+/*
+runPreparedCommand runs the passed command, which must have been created with
+the passed context, and returns its exit code, stdout and stderr as byproducts.
+See RunCommandContext for details.
+*/
+func runPreparedCommand(ctx context.Context, cmd *exec.Cmd) (map[string]interface{}, error) {
+	cmd.WaitDelay = commandWaitDelay
+
+	// Capture stdout and stderr in buffers, instead of reading from pipes, so
+	// that Wait does not block on pipes held open by child processes of a
+	// killed command longer than WaitDelay
+	// TODO: duplicate stdout, stderr
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
 
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
 
-	// TODO: duplicate stdout, stderr
-	stdout, _ := io.ReadAll(stdoutPipe)
-	stderr, _ := io.ReadAll(stderrPipe)
-
-	retVal := waitErrToExitCode(cmd.Wait())
+	waitErr := cmd.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	retVal := waitErrToExitCode(waitErr)
 
 	return map[string]interface{}{
 		"return-value": float64(retVal),
-		"stdout":       string(stdout),
-		"stderr":       string(stderr),
+		"stdout":       stdout.String(),
+		"stderr":       stderr.String(),
 	}, nil
 }
 
@@ -320,7 +364,31 @@ Metablock object.  If command execution or artifact recording fails the first
 return value is an empty Metablock and the second return value is the error.
 */
 func InTotoRun(name string, runDir string, materialPaths []string, productPaths []string, cmdArgs []string, key Key, hashAlgorithms []string, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool, useDSSE bool) (Metadata, error) {
-	materials, err := RecordArtifacts(materialPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+	return InTotoRunContext(context.Background(), name, runDir, materialPaths,
+		productPaths, cmdArgs, key, hashAlgorithms, gitignorePatterns,
+		lStripPaths, lineNormalization, followSymlinkDirs, useDSSE)
+}
+
+/*
+InTotoRunContext provides the same functionality as InTotoRun, but aborts
+artifact recording and kills the command, if the passed context is done, e.g.
+because a timeout expired.  In that case the first return value is nil and the
+second return value is the context's error.  It logs to the logger of the
+passed context, see ContextWithLogger.
+*/
+func InTotoRunContext(ctx context.Context, name string, runDir string, materialPaths []string, productPaths []string, cmdArgs []string, key Key, hashAlgorithms []string, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool, useDSSE bool) (Metadata, error) {
+	return inTotoRun(ctx, name, runDir, materialPaths, productPaths, cmdArgs,
+		key, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization,
+		followSymlinkDirs, useDSSE, RunCommandContext)
+}
+
+/*
+inTotoRun provides the functionality of InTotoRunContext, but executes the
+command with the passed runCommand function, e.g. to run it in a sandbox.
+*/
+func inTotoRun(ctx context.Context, name string, runDir string, materialPaths []string, productPaths []string, cmdArgs []string, key Key, hashAlgorithms []string, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool, useDSSE bool,
+	runCommand func(ctx context.Context, cmdArgs []string, runDir string) (map[string]interface{}, error)) (Metadata, error) {
+	materials, err := RecordArtifactsContext(ctx, materialPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
 	if err != nil {
 		return nil, err
 	}
@@ -328,13 +396,18 @@ func InTotoRun(name string, runDir string, materialPaths []string, productPaths
 	// make sure that we only run RunCommand if cmdArgs is not nil or empty
 	byProducts := map[string]interface{}{}
 	if len(cmdArgs) != 0 {
-		byProducts, err = RunCommand(cmdArgs, runDir)
+		logger := loggerFromContext(ctx)
+		logger.Debug("running command", "step", name, "command", cmdArgs,
+			"runDir", runDir)
+		byProducts, err = runCommand(ctx, cmdArgs, runDir)
 		if err != nil {
 			return nil, err
 		}
+		logger.Debug("command exited", "step", name,
+			"return-value", byProducts["return-value"])
 	}
 
-	products, err := RecordArtifacts(productPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+	products, err := RecordArtifactsContext(ctx, productPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
 	if err != nil {
 		return nil, err
 	}
@@ -381,7 +454,18 @@ by a single command.  InTotoRecordStart collects the hashes of the materials
 before any commands are run, signs the unfinished link, and returns the link.
 */
 func InTotoRecordStart(name string, materialPaths []string, key Key, hashAlgorithms, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool, useDSSE bool) (Metadata, error) {
-	materials, err := RecordArtifacts(materialPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+	return InTotoRecordStartContext(context.Background(), name, materialPaths,
+		key, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization,
+		followSymlinkDirs, useDSSE)
+}
+
+/*
+InTotoRecordStartContext provides the same functionality as InTotoRecordStart,
+but aborts artifact recording, if the passed context is done, and logs to the
+logger of the passed context, see ContextWithLogger.
+*/
+func InTotoRecordStartContext(ctx context.Context, name string, materialPaths []string, key Key, hashAlgorithms, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool, useDSSE bool) (Metadata, error) {
+	materials, err := RecordArtifactsContext(ctx, materialPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
 	if err != nil {
 		return nil, err
 	}
@@ -430,6 +514,17 @@ commands run between InTotoRecordStart and InTotoRecordStop.  The resultant
 finished link metablock is then signed by the provided key and returned.
 */
 func InTotoRecordStop(prelimLinkEnv Metadata, productPaths []string, key Key, hashAlgorithms, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool, useDSSE bool) (Metadata, error) {
+	return InTotoRecordStopContext(context.Background(), prelimLinkEnv,
+		productPaths, key, hashAlgorithms, gitignorePatterns, lStripPaths,
+		lineNormalization, followSymlinkDirs, useDSSE)
+}
+
+/*
+InTotoRecordStopContext provides the same functionality as InTotoRecordStop,
+but aborts artifact recording, if the passed context is done, and logs to the
+logger of the passed context, see ContextWithLogger.
+*/
+func InTotoRecordStopContext(ctx context.Context, prelimLinkEnv Metadata, productPaths []string, key Key, hashAlgorithms, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool, useDSSE bool) (Metadata, error) {
 	if err := prelimLinkEnv.VerifySignature(key); err != nil {
 		return nil, err
 	}
@@ -439,7 +534,7 @@ func InTotoRecordStop(prelimLinkEnv Metadata, productPaths []string, key Key, ha
 		return nil, errors.New("invalid metadata block")
 	}
 
-	products, err := RecordArtifacts(productPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+	products, err := RecordArtifactsContext(ctx, productPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
 	if err != nil {
 		return nil, err
 	}
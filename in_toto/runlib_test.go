@@ -1,6 +1,7 @@
 package in_toto
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"runtime"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/secure-systems-lab/go-securesystemslib/dsse"
 	"github.com/stretchr/testify/assert"
@@ -396,6 +398,36 @@ func TestRunCommandErrors(t *testing.T) {
 	}
 }
 
+func TestRunCommandContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sleep")
+	}
+
+	// Kill command that does not exit before the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result, err := RunCommandContext(ctx, []string{"sleep", "10"}, "")
+	if result != nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RunCommandContext returned '(%s, %s)', expected '(nil, %s)'",
+			result, err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("RunCommandContext returned after %s, expected it to be killed", elapsed)
+	}
+
+	// Don't start command and don't record artifacts with a canceled context
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := RunCommandContext(ctx, []string{"sh", "-c", "true"}, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("RunCommandContext returned '%s', expected '%s'", err, context.Canceled)
+	}
+	if _, err := InTotoRunContext(ctx, "foo", "", []string{"."}, nil, []string{"sh", "-c", "true"},
+		Key{}, []string{"sha256"}, nil, nil, false, false, false); !errors.Is(err, context.Canceled) {
+		t.Errorf("InTotoRunContext returned '%s', expected '%s'", err, context.Canceled)
+	}
+}
+
 func TestInTotoRun(t *testing.T) {
 	// Successfully run InTotoRun
 	linkName := "Name"
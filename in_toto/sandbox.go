@@ -0,0 +1,108 @@
+package in_toto
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+)
+
+// ErrSandboxUnsupported gets thrown if inspections cannot be sandboxed on the current platform
+var ErrSandboxUnsupported = errors.New("sandboxed inspections are only supported on Linux")
+
+// ErrSandboxMainNotCalled gets thrown if a program runs sandboxed inspections
+// without calling SandboxMain
+var ErrSandboxMainNotCalled = errors.New("sandboxed inspections require calling SandboxMain at the start of main")
+
+// sandboxMainCalled is set by SandboxMain
+var sandboxMainCalled bool
+
+/*
+SandboxLimits configures the resource limits (rlimits) of sandboxed inspection
+commands.  A zero value means that the corresponding limit is not changed.
+*/
+type SandboxLimits struct {
+	// Maximum CPU time in seconds (RLIMIT_CPU)
+	CPUSeconds uint64
+	// Maximum size of the virtual memory in bytes (RLIMIT_AS)
+	AddressSpaceBytes uint64
+	// Maximum size of created files in bytes (RLIMIT_FSIZE)
+	FileSizeBytes uint64
+	// Maximum number of open file descriptors (RLIMIT_NOFILE)
+	OpenFiles uint64
+	// Maximum number of processes of the user (RLIMIT_NPROC)
+	Processes uint64
+}
+
+// DefaultSandboxLimits are the resource limits used by NewSandboxInspectionRunner.
+var DefaultSandboxLimits = SandboxLimits{
+	CPUSeconds:        600,
+	AddressSpaceBytes: 4 << 30,
+	FileSizeBytes:     1 << 30,
+	OpenFiles:         1024,
+}
+
+/*
+SandboxInspectionRunner is an InspectionRunner, which runs inspection commands
+isolated from the host, so that a malicious layout cannot compromise the
+verifying machine.  On Linux, the command is run in new user, mount, network,
+PID, IPC and UTS namespaces, where it has no network access, the whole file
+system including the run directory is mounted read-only, /tmp is a private
+tmpfs, and the command has no capabilities and the configured resource limits.
+Of the host environment, only PATH, TZ, LANG and LC_* are passed, HOME and
+TMPDIR are set to /tmp.  Artifacts are recorded outside of the sandbox.
+
+The sandbox requires unprivileged user namespaces.  On other platforms,
+RunInspection returns ErrSandboxUnsupported.  To set up the sandbox, the
+current executable is re-executed, which must be handled by calling
+SandboxMain at the start of main, or RunInspection returns
+ErrSandboxMainNotCalled.
+*/
+type SandboxInspectionRunner struct {
+	Limits SandboxLimits
+}
+
+/*
+SandboxMain must be called at the start of main by programs that use
+SandboxInspectionRunner.  It returns immediately, unless the current process
+was re-executed by SandboxInspectionRunner, in which case it sets up the
+sandbox and executes the inspection command, and never returns.
+*/
+func SandboxMain() {
+	sandboxMainCalled = true
+	sandboxMain()
+}
+
+/*
+NewSandboxInspectionRunner returns a SandboxInspectionRunner, which uses
+DefaultSandboxLimits.
+*/
+func NewSandboxInspectionRunner() *SandboxInspectionRunner {
+	return &SandboxInspectionRunner{Limits: DefaultSandboxLimits}
+}
+
+func (r *SandboxInspectionRunner) RunInspection(ctx context.Context,
+	inspection Inspection, runDir string, lineNormalization bool,
+	useDSSE bool) (Metadata, error) {
+	paths := []string{"."}
+	if runDir != "" {
+		paths = []string{runDir}
+	}
+	// The sandbox needs an absolute path to mount the run directory
+	sandboxDir, err := filepath.Abs(runDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return inTotoRun(ctx, inspection.Name, runDir, paths, paths,
+		inspection.Run, Key{}, []string{"sha256"}, nil, nil, lineNormalization,
+		false, useDSSE, func(ctx context.Context, cmdArgs []string, _ string) (map[string]interface{}, error) {
+			if len(cmdArgs) == 0 {
+				return nil, ErrEmptyCommandArgs
+			}
+			cmd, err := sandboxCommand(ctx, cmdArgs, sandboxDir, r.Limits)
+			if err != nil {
+				return nil, err
+			}
+			return runPreparedCommand(ctx, cmd)
+		})
+}
@@ -0,0 +1,265 @@
+//go:build linux
+// +build linux
+
+package in_toto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+/*
+sandboxInitEnv is the environment variable, which passes the sandboxConfig to
+the re-executed process that sets up the sandbox, see sandboxInit.
+*/
+const sandboxInitEnv = "IN_TOTO_SANDBOX_INIT"
+
+// sandboxConfig configures the sandbox set up by sandboxInit.
+type sandboxConfig struct {
+	RunDir string        `json:"run_dir"`
+	Limits SandboxLimits `json:"limits"`
+}
+
+/*
+sandboxEnvNames lists the variables of the host environment, which are passed
+to sandboxed commands, in addition to the LC_* locale variables.
+*/
+var sandboxEnvNames = []string{"PATH", "TZ", "LANG"}
+
+/*
+sandboxMain sets up the sandbox and executes the inspection command, if the
+current process was re-executed by sandboxCommand, see SandboxMain.
+*/
+func sandboxMain() {
+	config, ok := os.LookupEnv(sandboxInitEnv)
+	if !ok {
+		return
+	}
+	if err := sandboxInit(config, os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "in-toto sandbox: %s\n", err)
+	}
+	// Only reached if the sandbox could not be set up
+	os.Exit(125)
+}
+
+/*
+sandboxCommand returns a command, which re-executes the current executable in
+new namespaces, where it sets up the sandbox and executes cmdArgs in runDir,
+see sandboxInit.  The command only gets the host environment variables listed
+in sandboxEnvNames.
+*/
+func sandboxCommand(ctx context.Context, cmdArgs []string, runDir string,
+	limits SandboxLimits) (*exec.Cmd, error) {
+	if !sandboxMainCalled {
+		return nil, ErrSandboxMainNotCalled
+	}
+	config, err := json.Marshal(sandboxConfig{RunDir: runDir, Limits: limits})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "/proc/self/exe", cmdArgs...)
+	cmd.Args[0] = "in-toto-sandbox"
+	cmd.Dir = runDir
+	cmd.Env = append(sandboxEnv(os.Environ()), sandboxInitEnv+"="+string(config))
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS |
+			syscall.CLONE_NEWNET | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC |
+			syscall.CLONE_NEWUTS,
+		// Map the current user to root in the sandbox, which is required to
+		// set up mounts.  All capabilities are dropped before running cmdArgs.
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+		},
+		GidMappingsEnableSetgroups: false,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+	return cmd, nil
+}
+
+/*
+sandboxEnv returns the variables of the passed environment, which are listed
+in sandboxEnvNames or are locale variables, and sets HOME and TMPDIR to /tmp.
+*/
+func sandboxEnv(environ []string) []string {
+	env := []string{"HOME=/tmp", "TMPDIR=/tmp"}
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, "LC_") {
+			env = append(env, kv)
+			continue
+		}
+		for _, allowed := range sandboxEnvNames {
+			if name == allowed {
+				env = append(env, kv)
+			}
+		}
+	}
+	return env
+}
+
+/*
+sandboxInit runs in the re-executed process created by sandboxCommand.  It
+remounts the whole file system read-only, mounts a private tmpfs at /tmp, a
+read-only bind of the run directory and a new /proc, sets the resource limits,
+drops all capabilities and executes cmdArgs.  It only returns if setting up the
+sandbox fails.
+*/
+func sandboxInit(configJSON string, cmdArgs []string) error {
+	// Capabilities are a per-thread attribute, they must be dropped on the
+	// thread that executes the command
+	runtime.LockOSThread()
+
+	var config sandboxConfig
+	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
+		return err
+	}
+	if len(cmdArgs) == 0 {
+		return ErrEmptyCommandArgs
+	}
+
+	// Don't propagate any mounts to the host
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+
+	// Keep a reference to the run directory, which might be hidden by /tmp
+	runDirFd, err := unix.Open(config.RunDir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open run directory: %w", err)
+	}
+	defer unix.Close(runDirFd)
+	var runDirStat unix.Statfs_t
+	if err := unix.Fstatfs(runDirFd, &runDirStat); err != nil {
+		return fmt.Errorf("failed to stat run directory: %w", err)
+	}
+
+	// Protect the host, e.g. the home directory, the link directory and the
+	// layout, from the command.  Only the mounts created below are writable.
+	if err := unix.MountSetattr(-1, "/", unix.AT_RECURSIVE,
+		&unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}); err != nil {
+		return fmt.Errorf("failed to remount / read-only: %w", err)
+	}
+
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("failed to mount /tmp: %w", err)
+	}
+
+	// Bind the run directory to itself, or to the same path in the new /tmp,
+	// and remount it read-only.  Flags of the original mount must be kept,
+	// because they are locked in a user namespace.
+	if err := os.MkdirAll(config.RunDir, 0700); err != nil {
+		return fmt.Errorf("failed to create run directory: %w", err)
+	}
+	runDirRef := "/proc/self/fd/" + strconv.Itoa(runDirFd)
+	if err := unix.Mount(runDirRef, config.RunDir, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to bind run directory: %w", err)
+	}
+	if err := unix.Mount("", config.RunDir, "",
+		unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY|lockedMountFlags(runDirStat), ""); err != nil {
+		return fmt.Errorf("failed to remount run directory read-only: %w", err)
+	}
+
+	// Hide the processes of the host
+	if err := unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("failed to mount /proc: %w", err)
+	}
+
+	if err := setSandboxLimits(config.Limits); err != nil {
+		return err
+	}
+	if err := dropCapabilities(); err != nil {
+		return err
+	}
+
+	if err := os.Chdir(config.RunDir); err != nil {
+		return err
+	}
+	path, err := exec.LookPath(cmdArgs[0])
+	if err != nil {
+		return err
+	}
+	// The environment was filtered by sandboxCommand
+	env := make([]string, 0, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, sandboxInitEnv+"=") {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return unix.Exec(path, cmdArgs, env)
+}
+
+/*
+lockedMountFlags returns the flags of the passed mount, which cannot be
+cleared in a user namespace.
+*/
+func lockedMountFlags(stat unix.Statfs_t) uintptr {
+	var flags uintptr
+	for stFlag, msFlag := range map[uint64]uintptr{
+		unix.ST_NOSUID:     unix.MS_NOSUID,
+		unix.ST_NODEV:      unix.MS_NODEV,
+		unix.ST_NOEXEC:     unix.MS_NOEXEC,
+		unix.ST_NOATIME:    unix.MS_NOATIME,
+		unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+		unix.ST_RELATIME:   unix.MS_RELATIME,
+	} {
+		if uint64(stat.Flags)&stFlag != 0 {
+			flags |= msFlag
+		}
+	}
+	return flags
+}
+
+// setSandboxLimits sets the non-zero resource limits.
+func setSandboxLimits(limits SandboxLimits) error {
+	for resource, limit := range map[int]uint64{
+		unix.RLIMIT_CPU:    limits.CPUSeconds,
+		unix.RLIMIT_AS:     limits.AddressSpaceBytes,
+		unix.RLIMIT_FSIZE:  limits.FileSizeBytes,
+		unix.RLIMIT_NOFILE: limits.OpenFiles,
+		unix.RLIMIT_NPROC:  limits.Processes,
+	} {
+		if limit == 0 {
+			continue
+		}
+		if err := unix.Setrlimit(resource, &unix.Rlimit{Cur: limit, Max: limit}); err != nil {
+			return fmt.Errorf("failed to set resource limit %d: %w", resource, err)
+		}
+	}
+	return nil
+}
+
+/*
+dropCapabilities irrevocably drops all capabilities of the calling thread, so
+that the executed command cannot undo the sandbox, e.g. by remounting the run
+directory.
+*/
+func dropCapabilities() error {
+	for c := 0; c <= unix.CAP_LAST_CAP; c++ {
+		// Capabilities unknown to the kernel return EINVAL
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && err != unix.EINVAL {
+			return fmt.Errorf("failed to drop capability %d: %w", c, err)
+		}
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to clear ambient capabilities: %w", err)
+	}
+	var data [2]unix.CapUserData
+	if err := unix.Capset(&unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}, &data[0]); err != nil {
+		return fmt.Errorf("failed to clear capabilities: %w", err)
+	}
+	return unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0)
+}
@@ -0,0 +1,110 @@
+//go:build linux
+// +build linux
+
+package in_toto
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSandboxInspectionRunner(t *testing.T) {
+	runDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(runDir, "foo"), []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runner := NewSandboxInspectionRunner()
+	run := func(command string) map[string]interface{} {
+		linkEnv, err := runner.RunInspection(context.Background(), Inspection{
+			SupplyChainItem: SupplyChainItem{Name: "sandbox"},
+			Run:             []string{"sh", "-c", command},
+		}, runDir, false, false)
+		if err != nil {
+			t.Skipf("sandbox not available: %s", err)
+		}
+		return linkEnv.GetPayload().(Link).ByProducts
+	}
+
+	if byProducts := run("true"); byProducts["return-value"] != float64(0) {
+		t.Skipf("sandbox not available: %s", byProducts["stderr"])
+	}
+
+	t.Run("run dir is readable", func(t *testing.T) {
+		byProducts := run("cat foo")
+		assert.Equal(t, float64(0), byProducts["return-value"])
+		assert.Equal(t, "foo", byProducts["stdout"])
+	})
+
+	t.Run("run dir is read-only", func(t *testing.T) {
+		byProducts := run("echo bar > foo")
+		assert.NotEqual(t, float64(0), byProducts["return-value"])
+		content, err := os.ReadFile(filepath.Join(runDir, "foo"))
+		assert.Nil(t, err)
+		assert.Equal(t, "foo", string(content))
+	})
+
+	t.Run("private tmp", func(t *testing.T) {
+		byProducts := run("touch /tmp/in-toto-sandbox-test && ls -A /tmp")
+		assert.Equal(t, float64(0), byProducts["return-value"])
+		_, err := os.Stat("/tmp/in-toto-sandbox-test")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("host file system is read-only", func(t *testing.T) {
+		// /tmp is hidden by the private /tmp of the sandbox
+		hostDir, err := os.MkdirTemp("/var/tmp", "in-toto-sandbox-test")
+		if err != nil {
+			t.Skipf("no writable host directory outside of /tmp: %s", err)
+		}
+		defer os.RemoveAll(hostDir)
+		byProducts := run("touch " + filepath.Join(hostDir, "foo"))
+		assert.NotEqual(t, float64(0), byProducts["return-value"])
+		_, err = os.Stat(filepath.Join(hostDir, "foo"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("filtered environment", func(t *testing.T) {
+		t.Setenv("IN_TOTO_SANDBOX_TEST_SECRET", "secret")
+		t.Setenv("LC_ALL", "C")
+		byProducts := run("env")
+		env := strings.Split(byProducts["stdout"].(string), "\n")
+		assert.Contains(t, env, "HOME=/tmp")
+		assert.Contains(t, env, "LC_ALL=C")
+		assert.NotContains(t, byProducts["stdout"], "IN_TOTO_SANDBOX")
+	})
+
+	t.Run("SandboxMain not called", func(t *testing.T) {
+		sandboxMainCalled = false
+		defer func() { sandboxMainCalled = true }()
+		_, err := runner.RunInspection(context.Background(), Inspection{
+			SupplyChainItem: SupplyChainItem{Name: "sandbox"},
+			Run:             []string{"true"},
+		}, runDir, false, false)
+		assert.ErrorIs(t, err, ErrSandboxMainNotCalled)
+	})
+
+	t.Run("no network", func(t *testing.T) {
+		byProducts := run("cat /proc/net/dev")
+		assert.Equal(t, float64(0), byProducts["return-value"])
+		for _, line := range strings.Split(byProducts["stdout"].(string), "\n")[2:] {
+			if line = strings.TrimSpace(line); line != "" {
+				assert.True(t, strings.HasPrefix(line, "lo:"), line)
+			}
+		}
+	})
+
+	t.Run("no capabilities", func(t *testing.T) {
+		byProducts := run("grep CapEff /proc/self/status")
+		assert.Equal(t, "CapEff:\t0000000000000000\n", byProducts["stdout"])
+	})
+
+	t.Run("resource limits", func(t *testing.T) {
+		byProducts := run("ulimit -n")
+		assert.Equal(t, "1024\n", byProducts["stdout"])
+	})
+}
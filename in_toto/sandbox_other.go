@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package in_toto
+
+import (
+	"context"
+	"os/exec"
+)
+
+// sandboxMain has nothing to handle on this platform, see SandboxMain.
+func sandboxMain() {}
+
+// sandboxCommand is not supported on this platform, see SandboxInspectionRunner.
+func sandboxCommand(_ context.Context, _ []string, _ string,
+	_ SandboxLimits) (*exec.Cmd, error) {
+	return nil, ErrSandboxUnsupported
+}
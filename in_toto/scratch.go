@@ -0,0 +1,148 @@
+package in_toto
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+copyToScratchDir copies the directory tree at srcDir into a new temporary
+directory and returns its path.  Regular files keep their permissions, other
+file types than directories and symlinks are ignored.  Symlinks are copied as
+relative symlinks to the copy of their target, see scratchLinkTarget, so that
+the copy cannot be used to modify the original tree.  The caller must remove
+the returned directory.
+*/
+func copyToScratchDir(srcDir string) (string, error) {
+	info, err := os.Stat(srcDir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", srcDir)
+	}
+
+	// Resolve the tree itself, to find symlinks that point outside of it
+	srcRoot, err := filepath.Abs(srcDir)
+	if err == nil {
+		srcRoot, err = filepath.EvalSymlinks(srcRoot)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	scratchDir, err := os.MkdirTemp("", "in-toto-inspection-")
+	if err != nil {
+		return "", err
+	}
+
+	err = filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(scratchDir, relPath)
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			return os.MkdirAll(dstPath, mode.Perm()|0700)
+		case mode&os.ModeSymlink != 0:
+			target, err := scratchLinkTarget(srcRoot, path, relPath)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dstPath)
+		case mode.IsRegular():
+			return copyFile(path, dstPath, mode.Perm())
+		}
+		return nil
+	})
+	if err != nil {
+		os.RemoveAll(scratchDir)
+		return "", err
+	}
+	return scratchDir, nil
+}
+
+/*
+scratchLinkTarget returns the target for the copy of the symlink at linkPath,
+which is located at relPath in the tree at root.  The target is the resolved
+target of the symlink relative to the symlink.  Symlinks that don't resolve to
+a path in the tree, e.g. absolute symlinks to other files or dangling
+symlinks, are rejected.
+*/
+func scratchLinkTarget(root string, linkPath string, relPath string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(linkPath)
+	if err == nil {
+		resolved, err = filepath.Abs(resolved)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve symlink %s: %w", relPath, err)
+	}
+	relTarget, err := filepath.Rel(root, resolved)
+	if err != nil || relTarget == ".." ||
+		strings.HasPrefix(relTarget, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("symlink %s points outside of %s", relPath, root)
+	}
+	return filepath.Rel(filepath.Dir(relPath), relTarget)
+}
+
+// copyFile copies the regular file at src to a new file at dst.
+func copyFile(src string, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+/*
+trimArtifactPrefix removes the passed directory from the names of the
+materials and products of the passed link, so that artifacts recorded in a
+scratch directory have the same names as if they were recorded in the current
+working directory.
+*/
+func trimArtifactPrefix(linkEnv Metadata, dir string) (Metadata, error) {
+	link, ok := linkEnv.GetPayload().(Link)
+	if !ok {
+		return nil, fmt.Errorf("invalid metadata")
+	}
+	prefix := dir + string(filepath.Separator)
+	trim := func(artifacts map[string]HashObj) map[string]HashObj {
+		trimmed := make(map[string]HashObj, len(artifacts))
+		for name, hashObj := range artifacts {
+			trimmed[strings.TrimPrefix(name, prefix)] = hashObj
+		}
+		return trimmed
+	}
+	link.Materials = trim(link.Materials)
+	link.Products = trim(link.Products)
+
+	switch env := linkEnv.(type) {
+	case *Metablock:
+		env.Signed = link
+	case *Envelope:
+		if err := env.SetPayload(link); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnknownMetadataType
+	}
+	return linkEnv, nil
+}
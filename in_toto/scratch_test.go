@@ -0,0 +1,79 @@
+package in_toto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyToScratchDir(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newTree := func(t *testing.T) string {
+		srcDir := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(srcDir, "sub"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(srcDir, "foo"), []byte("foo"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return srcDir
+	}
+
+	t.Run("symlinks point into the copy", func(t *testing.T) {
+		srcDir := newTree(t)
+		// An absolute and a relative symlink to a file in the tree
+		if err := os.Symlink(filepath.Join(srcDir, "foo"),
+			filepath.Join(srcDir, "sub", "abs")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("../foo", filepath.Join(srcDir, "sub", "rel")); err != nil {
+			t.Fatal(err)
+		}
+		scratchDir, err := copyToScratchDir(srcDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(scratchDir)
+
+		for _, name := range []string{"abs", "rel"} {
+			target, err := os.Readlink(filepath.Join(scratchDir, "sub", name))
+			assert.Nil(t, err)
+			assert.Equal(t, filepath.Join("..", "foo"), target)
+		}
+
+		// Writing through a symlink of the copy leaves the tree untouched
+		err = os.WriteFile(filepath.Join(scratchDir, "sub", "abs"), []byte("bar"), 0644)
+		assert.Nil(t, err)
+		content, err := os.ReadFile(filepath.Join(srcDir, "foo"))
+		assert.Nil(t, err)
+		assert.Equal(t, "foo", string(content))
+	})
+
+	for name, target := range map[string]string{
+		"absolute symlink outside of the tree": filepath.Join(outside, "secret"),
+		"relative symlink outside of the tree": "",
+		"dangling symlink":                     "does-not-exist",
+	} {
+		t.Run(name, func(t *testing.T) {
+			srcDir := newTree(t)
+			if target == "" {
+				var err error
+				target, err = filepath.Rel(filepath.Join(srcDir, "sub"),
+					filepath.Join(outside, "secret"))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Symlink(target, filepath.Join(srcDir, "sub", "link")); err != nil {
+				t.Fatal(err)
+			}
+			_, err := copyToScratchDir(srcDir)
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -1,11 +1,15 @@
 package in_toto
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 )
 
 var ErrUnknownMetadataType = errors.New("unknown metadata type encountered: not link or layout")
@@ -89,14 +93,22 @@ func (s Set) Difference(s2 Set) Set {
 /*
 Filter creates and returns a new Set with the elements of the set on which it
 was called that match the passed pattern. A matching error is treated like a
-non-match plus a warning is printed.
+non-match plus a warning is logged to slog.Default.
 */
 func (s Set) Filter(pattern string) Set {
+	return s.filter(pattern, match)
+}
+
+/*
+filter is like Filter, but matches the elements with the passed matcher, see
+PatternDialect.
+*/
+func (s Set) filter(pattern string, matches patternMatcher) Set {
 	res := NewSet()
 	for elem := range s {
-		matched, err := match(pattern, elem)
+		matched, err := matches(pattern, elem)
 		if err != nil {
-			fmt.Printf("WARNING: %s, pattern was '%s'\n", err, pattern)
+			slog.Warn(err.Error(), "pattern", pattern)
 			continue
 		}
 		if !matched {
@@ -120,6 +132,13 @@ func (s Set) Slice() []string {
 	return res
 }
 
+// sortedSlice returns the elements of the passed Set in a sorted string slice.
+func sortedSlice(s Set) []string {
+	res := s.Slice()
+	sort.Strings(res)
+	return res
+}
+
 /*
 artifactsDictKeyStrings returns string keys of passed HashObj map in an
 unordered string slice.
@@ -134,6 +153,63 @@ func artifactsDictKeyStrings(m map[string]HashObj) []string {
 	return res
 }
 
+/*
+parallelFor calls fn for every index in [0, n) using at most parallelism
+concurrent goroutines and returns once all calls have returned.  With a
+parallelism of 1 or less, fn is called sequentially in index order.  To keep
+results deterministic, fn should store its result by index and callers should
+process the results in index order.  Once the passed context is done, the
+remaining indices are skipped and the context's error is returned.
+*/
+func parallelFor(ctx context.Context, parallelism int, n int, fn func(i int)) error {
+	if parallelism <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			fn(i)
+		}
+		return nil
+	}
+	if parallelism > n {
+		parallelism = n
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(parallelism)
+	for w := 0; w < parallelism; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				if ctx.Err() != nil {
+					continue
+				}
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return ctx.Err()
+}
+
+/*
+sortedKeyIDs returns the key ids of the passed map of link metadata per
+functionary in a sorted string slice.
+*/
+func sortedKeyIDs(m map[string]Metadata) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
 /*
 IsSubSet checks if the parameter subset is a
 subset of the superset s.
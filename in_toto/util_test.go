@@ -1,9 +1,12 @@
 package in_toto
 
 import (
+	"context"
+	"errors"
 	"os"
 	"reflect"
 	"sort"
+	"sync/atomic"
 	"testing"
 )
 
@@ -113,6 +116,45 @@ func TestSubsetCheck(t *testing.T) {
 	}
 }
 
+func TestParallelFor(t *testing.T) {
+	for _, parallelism := range []int{0, 1, 3, 100} {
+		results := make([]int, 10)
+		err := parallelFor(context.Background(), parallelism, len(results),
+			func(i int) {
+				results[i] = i * i
+			})
+		if err != nil {
+			t.Errorf("parallelFor(%d) returned error: %s", parallelism, err)
+		}
+		for i, result := range results {
+			if result != i*i {
+				t.Errorf("parallelFor(%d) returned %d at index %d, expected %d",
+					parallelism, result, i, i*i)
+			}
+		}
+	}
+}
+
+func TestParallelForCanceled(t *testing.T) {
+	for _, parallelism := range []int{1, 3} {
+		ctx, cancel := context.WithCancel(context.Background())
+		var calls int32
+		err := parallelFor(ctx, parallelism, 100, func(i int) {
+			atomic.AddInt32(&calls, 1)
+			cancel()
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("parallelFor(%d) returned %v, expected context.Canceled",
+				parallelism, err)
+		}
+		// Only calls that started before the cancellation are made
+		if int(calls) > parallelism {
+			t.Errorf("parallelFor(%d) made %d calls after cancellation",
+				parallelism, calls)
+		}
+	}
+}
+
 func TestIsWritable(t *testing.T) {
 	notWritable, err := os.MkdirTemp("", "")
 	if err != nil {
@@ -0,0 +1,466 @@
+package in_toto
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"time"
+)
+
+/*
+Verifier performs the verification workflow described in InTotoVerify.  It is
+configured with functional options, see NewVerifier, and can be used for any
+number of verifications.
+*/
+type Verifier struct {
+	linkSource             LinkSource
+	runDir                 string
+	parameters             map[string]string
+	intermediatePems       [][]byte
+	lineNormalization      bool
+	summaryLinkName        string
+	collectAllFailures     bool
+	now                    func() time.Time
+	logger                 *slog.Logger
+	inspectionRunner       InspectionRunner
+	inspectionTimeout      time.Duration
+	parallelism            int
+	linkAgreementPolicy    LinkAgreementPolicy
+	dryRun                 bool
+	scratchRunDir          bool
+	inspectionLinkDir      string
+	ruleTracer             RuleTracer
+	commandAlignmentPolicy CommandAlignmentPolicy
+	sublayoutParameters    map[string]map[string]string
+	sublayoutLinkSources   map[string]LinkSource
+	maxSublayoutDepth      int
+	manifestDir            string
+}
+
+/*
+DefaultMaxSublayoutDepth is the maximum number of nested sublayouts, unless
+configured otherwise, see WithMaxSublayoutDepth.
+*/
+const DefaultMaxSublayoutDepth = 8
+
+/*
+VerifyOption configures a Verifier, see NewVerifier.  VerifyOptions may also be
+passed to InTotoVerify and related functions, where they take precedence over
+the positional arguments.
+*/
+type VerifyOption func(v *Verifier)
+
+/*
+NewVerifier returns a Verifier configured with the passed options.  Without
+options, links are loaded from the current working directory, inspections are
+run in the current working directory, and no parameters are substituted.
+*/
+func NewVerifier(opts ...VerifyOption) *Verifier {
+	v := &Verifier{}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+/*
+WithLinkSource configures the Verifier to load links from the passed
+LinkSource.
+*/
+func WithLinkSource(source LinkSource) VerifyOption {
+	return func(v *Verifier) {
+		v.linkSource = source
+	}
+}
+
+/*
+WithRunDir configures the Verifier to run inspections in the passed directory.
+The directory must exist, must be writable, and must not be a symlink.
+*/
+func WithRunDir(runDir string) VerifyOption {
+	return func(v *Verifier) {
+		v.runDir = runDir
+	}
+}
+
+/*
+WithParameters configures the parameters that are substituted in the layout,
+see SubstituteParameters.
+*/
+func WithParameters(parameterDictionary map[string]string) VerifyOption {
+	return func(v *Verifier) {
+		v.parameters = parameterDictionary
+	}
+}
+
+/*
+WithIntermediates configures PEM encoded intermediate certificates, which are
+used in addition to the intermediates in the layout to verify the chain of
+trust of functionary certificates.
+*/
+func WithIntermediates(intermediatePems [][]byte) VerifyOption {
+	return func(v *Verifier) {
+		v.intermediatePems = intermediatePems
+	}
+}
+
+/*
+WithLineNormalization configures whether line separators are normalized when
+hashing the artifacts of inspections.
+*/
+func WithLineNormalization(lineNormalization bool) VerifyOption {
+	return func(v *Verifier) {
+		v.lineNormalization = lineNormalization
+	}
+}
+
+/*
+WithSummaryLinkName configures the name of the summary link returned by a
+successful verification.  The name only matters for sublayouts, where it
+associates the summary with a step of the superlayout.
+*/
+func WithSummaryLinkName(name string) VerifyOption {
+	return func(v *Verifier) {
+		v.summaryLinkName = name
+	}
+}
+
+/*
+WithCollectAllFailures configures the verification workflow to keep verifying
+all remaining steps and inspections after a step or inspection failed.  Steps
+that already failed are skipped in subsequent phases.  If any step or
+inspection failed, a *VerificationErrors is returned, which lists each failure
+as *VerificationFailure.
+*/
+func WithCollectAllFailures() VerifyOption {
+	return func(v *Verifier) {
+		v.collectAllFailures = true
+	}
+}
+
+/*
+WithClock configures the function that returns the current time, which is used
+to verify the expiration of layouts and the validity of functionary
+certificates.  It defaults to time.Now.
+*/
+func WithClock(now func() time.Time) VerifyOption {
+	return func(v *Verifier) {
+		v.now = now
+	}
+}
+
+/*
+WithVerificationTime configures the Verifier to verify the supply chain as of
+the passed point in time, e.g. the release date of an artifact.  It controls
+the expiration check of layouts and the validity checks of functionary
+certificates.
+*/
+func WithVerificationTime(at time.Time) VerifyOption {
+	return WithClock(func() time.Time {
+		return at
+	})
+}
+
+/*
+WithLogger configures the logger that receives warnings, e.g. about commands
+that don't align with the expected command of a step, and debug messages about
+the verification workflow, with structured fields such as step, keyid and
+rule.  Without this option, the logger of the context passed to Verify is used,
+see ContextWithLogger.
+*/
+func WithLogger(logger *slog.Logger) VerifyOption {
+	return func(v *Verifier) {
+		v.logger = logger
+	}
+}
+
+/*
+WithInspectionRunner configures the InspectionRunner that executes the
+commands of inspections.  It defaults to DefaultInspectionRunner.
+*/
+func WithInspectionRunner(runner InspectionRunner) VerifyOption {
+	return func(v *Verifier) {
+		v.inspectionRunner = runner
+	}
+}
+
+/*
+WithInspectionTimeout configures the maximum duration of each inspection.  An
+inspection, whose command does not exit in time, is killed and fails.  A zero
+duration means no timeout.
+*/
+func WithInspectionTimeout(timeout time.Duration) VerifyOption {
+	return func(v *Verifier) {
+		v.inspectionTimeout = timeout
+	}
+}
+
+/*
+WithParallelism configures the maximum number of links that are loaded and
+whose signatures are verified concurrently.  A parallelism smaller than 1 uses
+the number of CPUs usable by the current process.  Without this option, links
+are processed sequentially.  A custom LinkSource must be safe for concurrent
+use, if the parallelism is greater than 1.  The parallelism does not affect the
+verification result, the report or the returned errors.
+*/
+func WithParallelism(parallelism int) VerifyOption {
+	return func(v *Verifier) {
+		if parallelism < 1 {
+			parallelism = runtime.GOMAXPROCS(0)
+		}
+		v.parallelism = parallelism
+	}
+}
+
+/*
+WithLinkAgreementPolicy configures whether all links for a step must report
+the same artifacts, which is the default, or only a threshold of links, see
+LinkAgreementPolicy.  Dissenting links are reported as warnings and in the
+DissentingLinks of the step's report.
+*/
+func WithLinkAgreementPolicy(policy LinkAgreementPolicy) VerifyOption {
+	return func(v *Verifier) {
+		v.linkAgreementPolicy = policy
+	}
+}
+
+/*
+WithScratchRunDir configures the Verifier to run each inspection in a new
+temporary copy of the run directory, or of the current working directory, if
+no run directory is configured, see WithRunDir.  The copy is removed after the
+inspection, so that inspections neither modify their inputs nor affect each
+other.  The run directory only needs to be readable.  Artifacts are recorded
+relative to the copy, i.e. as if the inspection was run in the current working
+directory.
+*/
+func WithScratchRunDir() VerifyOption {
+	return func(v *Verifier) {
+		v.scratchRunDir = true
+	}
+}
+
+/*
+WithInspectionLinkDir configures the directory, to which the unsigned links of
+inspections are written.  It defaults to the current working directory.  If
+a link cannot be written to the configured directory, the inspection fails.
+*/
+func WithInspectionLinkDir(dir string) VerifyOption {
+	return func(v *Verifier) {
+		v.inspectionLinkDir = dir
+	}
+}
+
+/*
+WithManifestDir configures the directory, from which the relative manifest
+paths of MATCH-DIGEST rules are loaded.  It defaults to the current working
+directory.  Each rule pins the digest of its manifest, so that the manifest is
+covered by the layout signature.
+*/
+func WithManifestDir(dir string) VerifyOption {
+	return func(v *Verifier) {
+		v.manifestDir = dir
+	}
+}
+
+/*
+WithRuleTracer configures a RuleTracer, which is called for each artifact rule
+applied to the steps and inspections of the layout and its sublayouts, e.g. to
+explain why a rule failed.
+*/
+func WithRuleTracer(tracer RuleTracer) VerifyOption {
+	return func(v *Verifier) {
+		v.ruleTracer = tracer
+	}
+}
+
+/*
+WithSublayoutParameters configures the parameters that are substituted in the
+sublayout, to which the step with the passed path resolves, see
+SubstituteParameters.  The path consists of the names of the steps that
+resolve to sublayouts, starting at the root layout, joined by "/", e.g.
+"build" for the step "build" of the root layout, or "build/compile" for the
+step "compile" of the sublayout "build".  Without this option, no parameters
+are substituted in sublayouts.
+*/
+func WithSublayoutParameters(sublayoutPath string,
+	parameterDictionary map[string]string) VerifyOption {
+	return func(v *Verifier) {
+		if v.sublayoutParameters == nil {
+			v.sublayoutParameters = make(map[string]map[string]string)
+		}
+		v.sublayoutParameters[sublayoutPath] = parameterDictionary
+	}
+}
+
+/*
+WithSublayoutLinkSource configures the LinkSource for the links of the
+sublayout, to which the step with the passed path resolves, see
+WithSublayoutParameters for the path format.  Without this option, the source
+is provided by the link source of the superlayout, see LinkSource.
+*/
+func WithSublayoutLinkSource(sublayoutPath string, source LinkSource) VerifyOption {
+	return func(v *Verifier) {
+		if v.sublayoutLinkSources == nil {
+			v.sublayoutLinkSources = make(map[string]LinkSource)
+		}
+		v.sublayoutLinkSources[sublayoutPath] = source
+	}
+}
+
+/*
+WithMaxSublayoutDepth configures the maximum number of nested sublayouts,
+which guards against cyclic or deeply nested layouts.  Verification fails with
+ErrSublayoutDepthExceeded, if a sublayout is nested deeper.  A depth smaller
+than 1 uses DefaultMaxSublayoutDepth, which is also the default.
+*/
+func WithMaxSublayoutDepth(depth int) VerifyOption {
+	return func(v *Verifier) {
+		if depth < 1 {
+			depth = DefaultMaxSublayoutDepth
+		}
+		v.maxSublayoutDepth = depth
+	}
+}
+
+/*
+WithCommandAlignmentPolicy configures the command alignment policy of steps,
+for which neither the step nor the layout configure the mode or match of the
+command alignment check, see CommandAlignmentPolicy.  E.g. pass
+CommandAlignmentEnforce to fail steps with misaligned commands by default.
+*/
+func WithCommandAlignmentPolicy(policy CommandAlignmentPolicy) VerifyOption {
+	return func(v *Verifier) {
+		v.commandAlignmentPolicy = policy
+	}
+}
+
+/*
+WithDryRun configures the Verifier to perform all checks of the verification
+workflow except for inspections, e.g. to check the link evidence on an
+untrusted machine.  Inspection commands are not executed and inspection
+artifact rules are not verified.  Instead, the inspections are listed in the
+PlannedInspections of the report.  This also applies to sublayouts.
+*/
+func WithDryRun() VerifyOption {
+	return func(v *Verifier) {
+		v.dryRun = true
+	}
+}
+
+/*
+Verify verifies the software supply chain described by the passed layout,
+whose signatures are verified using the passed keys.  It returns a
+VerificationReport, which records the outcome of each verification phase and
+holds the summary link in its SummaryLink field.  The report is returned
+regardless of whether verification passes or fails.  If the passed context is
+done, verification is aborted and running inspections are killed.
+*/
+func (vf *Verifier) Verify(ctx context.Context, layoutEnv Metadata,
+	layoutKeys map[string]Key) (*VerificationReport, error) {
+	v := &verification{Verifier: *vf, report: newVerificationReport()}
+	if v.logger == nil {
+		v.logger = loggerFromContext(ctx)
+	}
+
+	var summaryLink Metadata
+	var err error
+	// A scratch copy only requires a readable run directory, which is
+	// checked when copying it
+	if v.runDir != "" && !v.scratchRunDir {
+		err = checkRunDir(v.runDir)
+	}
+	if err == nil {
+		summaryLink, err = v.verify(ctx, layoutEnv, layoutKeys)
+	}
+	v.report.finish(summaryLink, err)
+	return v.report, err
+}
+
+/*
+checkRunDir performs sanity checks on the directory, in which inspections are
+run.
+*/
+func checkRunDir(runDir string) error {
+	// check if path exists
+	info, err := os.Stat(runDir)
+	if err != nil {
+		return err
+	}
+
+	// check if runDir is a symlink
+	if info.Mode()&os.ModeSymlink == os.ModeSymlink {
+		return ErrInspectionRunDirIsSymlink
+	}
+
+	// check if runDir is writable and a directory
+	err = isWritable(runDir)
+	if err != nil {
+		return err
+	}
+
+	// check if runDir is empty (we do not want to overwrite files)
+	// We abuse File.Readdirnames for this action.
+	f, err := os.Open(runDir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// We use Readdirnames(1) for performance reasons, one child node
+	// is enough to proof that the directory is not empty
+	_, err = f.Readdirnames(1)
+	// if io.EOF gets returned as error the directory is empty
+	if err == io.EOF {
+		return err
+	}
+	return f.Close()
+}
+
+/*
+InspectionRunner executes the command of an inspection in runDir.  It returns
+unsigned link metadata, which records the artifacts in runDir before command
+execution as materials and after command execution as products, and the exit
+code of the command as "return-value" byproduct, see InTotoRun.
+*/
+type InspectionRunner interface {
+	RunInspection(ctx context.Context, inspection Inspection, runDir string,
+		lineNormalization bool, useDSSE bool) (Metadata, error)
+}
+
+/*
+DefaultInspectionRunner runs inspection commands as child processes of the
+current process using InTotoRunContext.  If runDir is empty, the command is
+run in the current working directory.
+*/
+type DefaultInspectionRunner struct{}
+
+func (DefaultInspectionRunner) RunInspection(ctx context.Context,
+	inspection Inspection, runDir string, lineNormalization bool,
+	useDSSE bool) (Metadata, error) {
+	paths := []string{"."}
+	if runDir != "" {
+		paths = []string{runDir}
+	}
+
+	return InTotoRunContext(ctx, inspection.Name, runDir, paths, paths,
+		inspection.Run, Key{}, []string{"sha256"}, nil, nil, lineNormalization, false, useDSSE)
+}
+
+/*
+legacyVerifyOptions translates the positional arguments of InTotoVerify and
+related functions to options, followed by the passed options, which take
+precedence.
+*/
+func legacyVerifyOptions(linkDir string, runDir string, stepName string,
+	parameterDictionary map[string]string, intermediatePems [][]byte,
+	lineNormalization bool, opts []VerifyOption) []VerifyOption {
+	return append([]VerifyOption{
+		WithLinkSource(NewDirectoryLinkSource(linkDir)),
+		WithRunDir(runDir),
+		WithSummaryLinkName(stepName),
+		WithParameters(parameterDictionary),
+		WithIntermediates(intermediatePems),
+		WithLineNormalization(lineNormalization),
+	}, opts...)
+}
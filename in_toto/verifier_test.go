@@ -0,0 +1,437 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingInspectionRunner records the names of the inspections it runs
+type recordingInspectionRunner struct {
+	inspections []string
+}
+
+func (r *recordingInspectionRunner) RunInspection(ctx context.Context,
+	inspection Inspection, runDir string, lineNormalization bool,
+	useDSSE bool) (Metadata, error) {
+	r.inspections = append(r.inspections, inspection.Name)
+	return DefaultInspectionRunner{}.RunInspection(ctx, inspection, runDir,
+		lineNormalization, useDSSE)
+}
+
+// cancelingLinkSource cancels the verification once it loaded links
+type cancelingLinkSource struct {
+	LinkSource
+	cancel context.CancelFunc
+	steps  []string
+}
+
+func (s *cancelingLinkSource) Links(stepName string) (map[string]Metadata, error) {
+	s.steps = append(s.steps, stepName)
+	s.cancel()
+	return s.LinkSource.Links(stepName)
+}
+
+func TestVerifier(t *testing.T) {
+	layoutMb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubKey Key
+	if err := pubKey.LoadKey("alice.pub", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{pubKey.KeyID: pubKey}
+
+	t.Run("passing verification", func(t *testing.T) {
+		runner := &recordingInspectionRunner{}
+		verifier := NewVerifier(
+			WithLinkSource(NewDirectoryLinkSource(".")),
+			WithSummaryLinkName("demo"),
+			WithLineNormalization(testOSisWindows()),
+			WithInspectionRunner(runner),
+		)
+		report, err := verifier.Verify(context.Background(), layoutMb, layoutKeys)
+		defer os.Remove("untar.link")
+		assert.Nil(t, err)
+		assert.True(t, report.Passed)
+		assert.Equal(t, []string{"untar"}, runner.inspections)
+		if assert.NotNil(t, report.SummaryLink) {
+			assert.Equal(t, "demo", report.SummaryLink.GetPayload().(Link).Name)
+		}
+
+		// The evidence graph lists the accepted links and MATCH sources
+		if assert.Len(t, report.Evidence.Items, 3) {
+			packageEvidence := report.Evidence.Items[1]
+			assert.Equal(t, "package", packageEvidence.Name)
+			if assert.Len(t, packageEvidence.Links, 1) {
+				assert.Equal(t, "package.d3ffd108.link", packageEvidence.Links[0].Path)
+				linkBytes, err := os.ReadFile("package.d3ffd108.link")
+				assert.Nil(t, err)
+				digest := sha256.Sum256(linkBytes)
+				assert.Equal(t, HashObj{"sha256": hex.EncodeToString(digest[:])},
+					packageEvidence.Links[0].Digest)
+			}
+			assert.Equal(t, []MatchEvidence{{
+				ArtifactType: "materials",
+				Rule:         []string{"MATCH", "foo.py", "WITH", "PRODUCTS", "FROM", "write-code"},
+				Source:       "write-code",
+				Artifacts:    []string{"foo.py"},
+			}}, packageEvidence.Matches)
+			assert.Equal(t, "inspection", report.Evidence.Items[2].Type)
+		}
+		var dot bytes.Buffer
+		assert.Nil(t, report.Evidence.WriteDOT(&dot))
+		assert.Contains(t, dot.String(), `"item:package" -> "link:package/d3ffd108`)
+		assert.Contains(t, dot.String(), `"item:untar" -> "item:package" [style=dashed, label="materials: foo.tar.gz"];`)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		runner := &recordingInspectionRunner{}
+		verifier := NewVerifier(
+			WithLinkSource(NewDirectoryLinkSource(".")),
+			WithInspectionRunner(runner),
+			WithDryRun(),
+		)
+		report, err := verifier.Verify(context.Background(), layoutMb, layoutKeys)
+		assert.Nil(t, err)
+		assert.True(t, report.DryRun)
+		assert.Empty(t, runner.inspections)
+		phase, _ := report.Phase(PhaseInspections)
+		assert.Equal(t, StatusSkipped, phase.Status)
+		phase, _ = report.Phase(PhaseArtifactRules)
+		assert.Equal(t, StatusPassed, phase.Status)
+		if assert.Len(t, report.PlannedInspections, 1) {
+			assert.Equal(t, "untar", report.PlannedInspections[0].Name)
+			assert.Equal(t, []string{"tar", "xfz", "foo.tar.gz"},
+				report.PlannedInspections[0].Run)
+		}
+		assert.Equal(t, StatusSkipped, report.Inspection("untar").Status)
+		_, err = os.Stat("untar.link")
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+
+	t.Run("scratch run dir", func(t *testing.T) {
+		linkDir := t.TempDir()
+		filesBefore, err := os.ReadDir(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier := NewVerifier(
+			WithLinkSource(NewDirectoryLinkSource(".")),
+			WithRunDir("."),
+			WithScratchRunDir(),
+			WithInspectionLinkDir(linkDir),
+			WithLineNormalization(testOSisWindows()),
+		)
+		_, err = verifier.Verify(context.Background(), layoutMb, layoutKeys)
+		assert.Nil(t, err)
+
+		// The inspection link is written to the configured directory and
+		// records artifacts relative to the scratch copy
+		linkEnv, err := LoadMetadata(filepath.Join(linkDir, "untar.link"))
+		if assert.Nil(t, err) {
+			assert.Contains(t, linkEnv.GetPayload().(Link).Products, "foo.py")
+		}
+		filesAfter, err := os.ReadDir(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(filesBefore), len(filesAfter))
+	})
+
+	t.Run("inspection link dir not writable", func(t *testing.T) {
+		verifier := NewVerifier(
+			WithLinkSource(NewDirectoryLinkSource(".")),
+			WithScratchRunDir(),
+			WithInspectionLinkDir("does-not-exist"),
+			WithLineNormalization(testOSisWindows()),
+		)
+		_, err := verifier.Verify(context.Background(), layoutMb, layoutKeys)
+		var inspectionErr *InspectionFailedError
+		if assert.True(t, errors.As(err, &inspectionErr)) {
+			assert.Contains(t, inspectionErr.Error(), "failed to write inspection link")
+		}
+	})
+
+	t.Run("expired at the configured time", func(t *testing.T) {
+		verifier := NewVerifier(WithClock(func() time.Time {
+			return time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+		}))
+		report, err := verifier.Verify(context.Background(), layoutMb, layoutKeys)
+		var expiredErr *LayoutExpiredError
+		assert.True(t, errors.As(err, &expiredErr))
+		phase, _ := report.Phase(PhaseLayoutExpiration)
+		assert.Equal(t, StatusFailed, phase.Status)
+	})
+
+	t.Run("verification time", func(t *testing.T) {
+		verifier := NewVerifier(WithVerificationTime(
+			time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)))
+		_, err := verifier.Verify(context.Background(), layoutMb, layoutKeys)
+		var expiredErr *LayoutExpiredError
+		assert.True(t, errors.As(err, &expiredErr))
+	})
+
+	t.Run("parallelism", func(t *testing.T) {
+		layout := layoutMb.GetPayload().(Layout)
+		layout.Steps = append([]Step{}, layout.Steps...)
+		layout.Steps[1].PubKeys = []string{"deadbeef"}
+
+		verifyLinks := func(parallelism int) (map[string]map[string]Metadata, *VerificationReport, []error) {
+			v := &verification{
+				Verifier: *NewVerifier(WithCollectAllFailures(),
+					WithParallelism(parallelism)),
+				report: newVerificationReport(),
+			}
+			stepsMetadata, err := v.loadLinksForLayout(context.Background(), layout, NewDirectoryLinkSource("."))
+			if err != nil {
+				t.Fatal(err)
+			}
+			stepsMetadataVerified, err := v.verifyLinkSignatureThresholds(context.Background(), layout,
+				stepsMetadata, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return stepsMetadataVerified, v.report, v.failures
+		}
+
+		sequentialLinks, sequentialReport, sequentialErrs := verifyLinks(1)
+		parallelLinks, parallelReport, parallelErrs := verifyLinks(8)
+		assert.Equal(t, sequentialLinks, parallelLinks)
+		assert.Equal(t, sequentialReport, parallelReport)
+		assert.Equal(t, sequentialErrs, parallelErrs)
+		var thresholdErr *ThresholdError
+		if assert.Len(t, parallelErrs, 1) && assert.True(t, errors.As(parallelErrs[0], &thresholdErr)) {
+			assert.Equal(t, "package", thresholdErr.Step)
+		}
+	})
+
+	t.Run("enforced command alignment", func(t *testing.T) {
+		layout := layoutMb.GetPayload().(Layout)
+		layout.Steps = append([]Step{}, layout.Steps...)
+		layout.Steps[1].ExpectedCommand = []string{"tar", "zcvf", "*"}
+		stepsMetadata, err := (&verification{}).loadLinksForLayout(context.Background(), layout,
+			NewDirectoryLinkSource("."))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v := &verification{
+			Verifier: *NewVerifier(WithCollectAllFailures(),
+				WithCommandAlignmentPolicy(CommandAlignmentPolicy{Mode: CommandAlignmentEnforce})),
+			report: newVerificationReport(),
+		}
+		err = v.verifyStepCommandAlignment(layout, stepsMetadata)
+		assert.Nil(t, err)
+		var alignmentErr *CommandAlignmentError
+		if assert.Len(t, v.failures, 1) && assert.True(t, errors.As(v.failures[0], &alignmentErr)) {
+			assert.Equal(t, "package", alignmentErr.Step)
+		}
+		assert.Equal(t, StatusFailed, v.report.Step("package").Status)
+
+		// The step's policy takes precedence over the Verifier's policy
+		layout.Steps[1].CommandAlignment = &CommandAlignmentPolicy{Mode: CommandAlignmentWarn}
+		v = &verification{Verifier: v.Verifier, report: newVerificationReport()}
+		assert.Nil(t, v.verifyStepCommandAlignment(layout, stepsMetadata))
+		assert.Len(t, v.failures, 0)
+		assert.Len(t, v.report.Step("package").Warnings, 1)
+	})
+
+	t.Run("invalid run dir", func(t *testing.T) {
+		verifier := NewVerifier(WithRunDir("does-not-exist"))
+		report, err := verifier.Verify(context.Background(), layoutMb, layoutKeys)
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+		assert.False(t, report.Passed)
+	})
+
+	t.Run("inspection timeout", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("requires sleep")
+		}
+		layout := layoutMb.GetPayload().(Layout)
+		layout.Inspect = []Inspection{{
+			SupplyChainItem: SupplyChainItem{Name: "sleep"},
+			Run:             []string{"sleep", "10"},
+		}}
+		v := &verification{Verifier: *NewVerifier(
+			WithInspectionTimeout(100 * time.Millisecond))}
+		_, err := v.runInspections(context.Background(), layout, false)
+		var inspectionErr *InspectionFailedError
+		if assert.True(t, errors.As(err, &inspectionErr)) {
+			assert.Equal(t, "sleep", inspectionErr.Inspection)
+		}
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := NewVerifier().Verify(ctx, layoutMb, layoutKeys)
+		assert.True(t, errors.Is(err, context.Canceled))
+
+		// Cancellation during link loading stops the verification before the
+		// links of the remaining steps are loaded
+		ctx, cancel = context.WithCancel(context.Background())
+		source := &cancelingLinkSource{LinkSource: NewDirectoryLinkSource("."),
+			cancel: cancel}
+		runner := &recordingInspectionRunner{}
+		_, err = NewVerifier(WithLinkSource(source), WithParallelism(1),
+			WithInspectionRunner(runner)).Verify(ctx, layoutMb, layoutKeys)
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Equal(t, []string{"write-code"}, source.steps)
+		assert.Empty(t, runner.inspections)
+	})
+
+	t.Run("positional arguments are overridden by options", func(t *testing.T) {
+		_, err := InTotoVerify(layoutMb, layoutKeys, ".", "", nil, nil,
+			testOSisWindows(), WithLinkSource(NewDirectoryLinkSource("does-not-exist")))
+		var thresholdErr *ThresholdError
+		assert.True(t, errors.As(err, &thresholdErr))
+	})
+}
+
+func TestVerifierLogger(t *testing.T) {
+	layout := Layout{Steps: []Step{{
+		SupplyChainItem: SupplyChainItem{Name: "foo"},
+		ExpectedCommand: []string{"rm", "-rf", "."},
+	}}}
+	stepsMetadata := map[string]map[string]Metadata{
+		"foo": {"a": &Metablock{Signed: Link{Command: []string{"rm", "-rf", "/"}}}},
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	v := &verification{Verifier: *NewVerifier(WithLogger(logger))}
+	v.verifyStepCommandAlignment(layout, stepsMetadata)
+	assert.Contains(t, buf.String(), "level=WARN")
+	assert.Contains(t, buf.String(), "Expected command for step 'foo'")
+}
+
+func TestContextWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	ctx := ContextWithLogger(context.Background(), logger)
+
+	_, err := InTotoRunContext(ctx, "foo", "", []string{"foo.tar.gz"}, nil,
+		[]string{"sh", "-c", "true"}, Key{}, []string{"sha256"}, nil, nil,
+		false, false, false)
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), `msg="running command" step=foo`)
+	assert.Contains(t, buf.String(), `msg="recorded artifact" path=foo.tar.gz`)
+
+	// The Verifier uses the logger of the context, if none is configured
+	buf.Reset()
+	layoutMb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubKey Key
+	if err := pubKey.LoadKey("alice.pub", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewVerifier(WithLinkSource(NewDirectoryLinkSource(".")), WithDryRun(),
+		WithLineNormalization(testOSisWindows())).Verify(ctx, layoutMb,
+		map[string]Key{pubKey.KeyID: pubKey})
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), `msg="applied artifact rule" item=package artifactType=materials rule="[MATCH foo.py WITH PRODUCTS FROM write-code]"`)
+}
+
+func TestVerifierNotLayout(t *testing.T) {
+	var alice Key
+	if err := alice.LoadKey("alice", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	var alicePub Key
+	if err := alicePub.LoadKey("alice.pub", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A correctly signed link is no layout
+	linkMb := &Metablock{Signed: Link{Type: "link", Name: "foo"}}
+	if err := linkMb.Sign(alice); err != nil {
+		t.Fatal(err)
+	}
+	report, err := NewVerifier().Verify(context.Background(), linkMb,
+		map[string]Key{alicePub.KeyID: alicePub})
+	assert.ErrorIs(t, err, ErrNotLayout)
+	phase, _ := report.Phase(PhaseLayoutSignatures)
+	assert.Equal(t, StatusFailed, phase.Status)
+	assert.Equal(t, ErrNotLayout.Error(), phase.Error)
+}
+
+func TestVerifierSublayouts(t *testing.T) {
+	var alice Key
+	if err := alice.LoadKey("alice", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	var alicePub Key
+	if err := alicePub.LoadKey("alice.pub", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A layout, whose only step resolves to the layout itself
+	layoutMb := &Metablock{Signed: Layout{
+		Type:    "layout",
+		Expires: time.Now().Add(time.Hour).UTC().Format(ISO8601DateSchema),
+		Keys:    map[string]Key{alicePub.KeyID: alicePub},
+		Steps: []Step{{
+			Type:            "step",
+			PubKeys:         []string{alicePub.KeyID},
+			Threshold:       1,
+			SupplyChainItem: SupplyChainItem{Name: "sub"},
+		}},
+	}}
+	if err := layoutMb.Sign(alice); err != nil {
+		t.Fatal(err)
+	}
+	source := NewMemoryLinkSource()
+	source.AddLink("sub", alicePub.KeyID, layoutMb)
+	source.AddSublayout("sub", alicePub.KeyID, source)
+	layoutKeys := map[string]Key{alicePub.KeyID: alicePub}
+
+	t.Run("maximum depth", func(t *testing.T) {
+		_, err := NewVerifier(WithLinkSource(source), WithMaxSublayoutDepth(2)).
+			Verify(context.Background(), layoutMb, layoutKeys)
+		assert.ErrorIs(t, err, ErrSublayoutDepthExceeded)
+		assert.Contains(t, err.Error(), "sublayout 'sub/sub/sub' is nested 3 levels deep")
+
+		_, err = NewVerifier(WithLinkSource(source)).
+			Verify(context.Background(), layoutMb, layoutKeys)
+		assert.ErrorIs(t, err, ErrSublayoutDepthExceeded)
+		assert.Contains(t, err.Error(), "the maximum is 8")
+	})
+
+	t.Run("sublayout parameters", func(t *testing.T) {
+		report, err := NewVerifier(WithLinkSource(source),
+			WithSublayoutParameters("sub/sub", map[string]string{"in valid": "x"})).
+			Verify(context.Background(), layoutMb, layoutKeys)
+		assert.EqualError(t, err, "invalid format for parameter")
+		subReport := report.Step("sub").Sublayouts[alicePub.KeyID]
+		phase, _ := subReport.Phase(PhaseParameterSubstitution)
+		assert.Equal(t, StatusPassed, phase.Status)
+		subSubReport := subReport.Step("sub").Sublayouts[alicePub.KeyID]
+		phase, _ = subSubReport.Phase(PhaseParameterSubstitution)
+		assert.Equal(t, StatusFailed, phase.Status)
+	})
+
+	t.Run("sublayout link source", func(t *testing.T) {
+		_, err := NewVerifier(WithLinkSource(source),
+			WithSublayoutLinkSource("sub", NewMemoryLinkSource())).
+			Verify(context.Background(), layoutMb, layoutKeys)
+		var thresholdErr *ThresholdError
+		if assert.True(t, errors.As(err, &thresholdErr)) {
+			assert.Equal(t, 0, thresholdErr.Found)
+		}
+	})
+}
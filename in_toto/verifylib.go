@@ -6,15 +6,16 @@ See https://github.com/in-toto/docs/blob/master/in-toto-spec.md
 package in_toto
 
 import (
+	"context"
 	"crypto/x509"
 	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"os"
 	"path"
 	"path/filepath"
 	"reflect"
-	"regexp"
+	"sort"
 	"strings"
 	"time"
 )
@@ -24,6 +25,9 @@ var ErrInspectionRunDirIsSymlink = errors.New("runDir is a symlink. This is a se
 
 var ErrNotLayout = errors.New("verification workflow passed a non-layout")
 
+// ErrSublayoutDepthExceeded gets thrown if sublayouts are nested too deeply, see WithMaxSublayoutDepth
+var ErrSublayoutDepthExceeded = errors.New("maximum sublayout depth exceeded")
+
 /*
 RunInspections iteratively executes the command in the Run field of all
 inspections of the passed layout, creating unsigned link metadata that records
@@ -43,52 +47,128 @@ non-zero exit code, the first return value is an empty Metablock map and the
 second return value is the error.
 */
 func RunInspections(layout Layout, runDir string, lineNormalization bool, useDSSE bool) (map[string]Metadata, error) {
+	return RunInspectionsContext(context.Background(), layout, runDir,
+		lineNormalization, useDSSE)
+}
+
+/*
+RunInspectionsContext provides the same functionality as RunInspections, but
+kills a running inspection command and returns an error, if the passed context
+is done.
+*/
+func RunInspectionsContext(ctx context.Context, layout Layout, runDir string, lineNormalization bool, useDSSE bool) (map[string]Metadata, error) {
+	v := &verification{Verifier: Verifier{runDir: runDir,
+		lineNormalization: lineNormalization}}
+	return v.runInspections(ctx, layout, useDSSE)
+}
+
+func (v *verification) runInspections(ctx context.Context, layout Layout, useDSSE bool) (map[string]Metadata, error) {
 	inspectionMetadata := make(map[string]Metadata)
 
 	for _, inspection := range layout.Inspect {
-
-		paths := []string{"."}
-		if runDir != "" {
-			paths = []string{runDir}
+		linkEnv, err := v.runInspection(ctx, inspection, useDSSE)
+		v.report.item(inspection).recordResult(err)
+		if err != nil {
+			if err := v.itemFailed(PhaseInspections, inspection.Name, err); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
-		linkEnv, err := InTotoRun(inspection.Name, runDir, paths, paths,
-			inspection.Run, Key{}, []string{"sha256"}, nil, nil, lineNormalization, false, useDSSE)
+		inspectionMetadata[inspection.Name] = linkEnv
+	}
+	return inspectionMetadata, nil
+}
 
+// runInspection executes the command of a single inspection using the
+// InspectionRunner of the Verifier, in a scratch copy of the run directory if
+// configured, and dumps the resulting link. See RunInspections for details.
+func (v *verification) runInspection(ctx context.Context, inspection Inspection, useDSSE bool) (Metadata, error) {
+	var runner InspectionRunner = DefaultInspectionRunner{}
+	if v.inspectionRunner != nil {
+		runner = v.inspectionRunner
+	}
+	if v.inspectionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.inspectionTimeout)
+		defer cancel()
+	}
+
+	runDir := v.runDir
+	if v.scratchRunDir {
+		srcDir := runDir
+		if srcDir == "" {
+			srcDir = "."
+		}
+		scratchDir, err := copyToScratchDir(srcDir)
 		if err != nil {
-			return nil, err
+			return nil, &InspectionFailedError{
+				Inspection: inspection.Name,
+				Command:    inspection.Run,
+				Err:        fmt.Errorf("failed to copy run directory: %w", err),
+			}
 		}
+		defer os.RemoveAll(scratchDir)
+		runDir = scratchDir
+	}
 
-		link, ok := linkEnv.GetPayload().(Link)
-		if !ok {
-			return nil, fmt.Errorf("invalid metadata")
-		}
-		retVal := link.ByProducts["return-value"]
-		if retVal != float64(0) {
-			return nil, fmt.Errorf("inspection command '%s' of inspection '%s'"+
-				" returned a non-zero value: %d", inspection.Run, inspection.Name,
-				retVal)
+	v.log().Debug("running inspection", "inspection", inspection.Name,
+		"command", inspection.Run, "runDir", runDir)
+	linkEnv, err := runner.RunInspection(ContextWithLogger(ctx, v.log()),
+		inspection, runDir, v.lineNormalization, useDSSE)
+	if err == nil && v.scratchRunDir {
+		linkEnv, err = trimArtifactPrefix(linkEnv, runDir)
+	}
+	if err != nil {
+		return nil, &InspectionFailedError{
+			Inspection: inspection.Name,
+			Command:    inspection.Run,
+			Err:        err,
 		}
+	}
 
-		// Dump inspection link to cwd using the short link name format
-		linkName := fmt.Sprintf(LinkNameFormatShort, inspection.Name)
-		if err := linkEnv.Dump(linkName); err != nil {
-			fmt.Printf("JSON serialization or writing failed: %s", err)
+	link, ok := linkEnv.GetPayload().(Link)
+	if !ok {
+		return nil, fmt.Errorf("invalid metadata")
+	}
+	retVal, ok := link.ByProducts["return-value"].(float64)
+	if !ok || retVal != 0 {
+		return nil, &InspectionFailedError{
+			Inspection:  inspection.Name,
+			Command:     inspection.Run,
+			ReturnValue: int(retVal),
 		}
+	}
 
-		inspectionMetadata[inspection.Name] = linkEnv
+	// Dump inspection link to the configured directory, or cwd, using the
+	// short link name format.  Failing to write to the configured directory
+	// fails the inspection.
+	linkName := filepath.Join(v.inspectionLinkDir,
+		fmt.Sprintf(LinkNameFormatShort, inspection.Name))
+	if err := linkEnv.Dump(linkName); err != nil {
+		if v.inspectionLinkDir != "" {
+			return nil, &InspectionFailedError{
+				Inspection: inspection.Name,
+				Command:    inspection.Run,
+				Err:        fmt.Errorf("failed to write inspection link: %w", err),
+			}
+		}
+		v.log().Error("JSON serialization or writing failed",
+			"inspection", inspection.Name, "path", linkName, "error", err)
 	}
-	return inspectionMetadata, nil
+
+	return linkEnv, nil
 }
 
 // verifyMatchRule is a helper function to process artifact rules of
 // type MATCH. See VerifyArtifacts for more details.
-func verifyMatchRule(ruleData map[string]string,
+func verifyMatchRule(rule MatchRule,
 	srcArtifacts map[string]HashObj, srcArtifactQueue Set,
-	itemsMetadata map[string]Metadata) Set {
+	itemsMetadata map[string]Metadata, matches patternMatcher,
+	hashPolicy *HashPolicy, logger *slog.Logger) Set {
 	consumed := NewSet()
 	// Get destination link metadata
-	dstLinkEnv, exists := itemsMetadata[ruleData["dstName"]]
+	dstLinkEnv, exists := itemsMetadata[rule.DestinationName]
 	if !exists {
 		// Destination link does not exist, rule can't consume any
 		// artifacts
@@ -97,13 +177,13 @@ func verifyMatchRule(ruleData map[string]string,
 
 	dstLink, ok := dstLinkEnv.GetPayload().(Link)
 	if !ok {
-		fmt.Printf("invalid metadata")
+		logger.Error("invalid metadata", "step", rule.DestinationName)
 		return consumed
 	}
 
 	// Get artifacts from destination link metadata
 	var dstArtifacts map[string]HashObj
-	switch ruleData["dstType"] {
+	switch rule.DestinationType {
 	case "materials":
 		dstArtifacts = dstLink.Materials
 	case "products":
@@ -111,8 +191,8 @@ func verifyMatchRule(ruleData map[string]string,
 	}
 
 	// cleanup paths in pattern and artifact maps
-	if ruleData["pattern"] != "" {
-		ruleData["pattern"] = path.Clean(ruleData["pattern"])
+	if rule.Pattern != "" {
+		rule.Pattern = path.Clean(rule.Pattern)
 	}
 	for k := range srcArtifacts {
 		if path.Clean(k) != k {
@@ -129,11 +209,11 @@ func verifyMatchRule(ruleData map[string]string,
 
 	// Normalize optional source and destination prefixes, i.e. if
 	// there is a prefix, then add a trailing slash if not there yet
-	for _, prefix := range []string{"srcPrefix", "dstPrefix"} {
-		if ruleData[prefix] != "" {
-			ruleData[prefix] = path.Clean(ruleData[prefix])
-			if !strings.HasSuffix(ruleData[prefix], "/") {
-				ruleData[prefix] += "/"
+	for _, prefix := range []*string{&rule.SourcePrefix, &rule.DestinationPrefix} {
+		if *prefix != "" {
+			*prefix = path.Clean(*prefix)
+			if !strings.HasSuffix(*prefix, "/") {
+				*prefix += "/"
 			}
 		}
 	}
@@ -141,17 +221,17 @@ func verifyMatchRule(ruleData map[string]string,
 	for srcPath := range srcArtifactQueue {
 		// Remove optional source prefix from source artifact path
 		// Noop if prefix is empty, or artifact does not have it
-		srcBasePath := strings.TrimPrefix(srcPath, ruleData["srcPrefix"])
+		srcBasePath := strings.TrimPrefix(srcPath, rule.SourcePrefix)
 
 		// Ignore artifacts not matched by rule pattern
-		matched, err := match(ruleData["pattern"], srcBasePath)
+		matched, err := matches(rule.Pattern, srcBasePath)
 		if err != nil || !matched {
 			continue
 		}
 
 		// Construct corresponding destination artifact path, i.e.
 		// an optional destination prefix plus the source base path
-		dstPath := path.Clean(path.Join(ruleData["dstPrefix"], srcBasePath))
+		dstPath := path.Clean(path.Join(rule.DestinationPrefix, srcBasePath))
 
 		// Try to find the corresponding destination artifact
 		dstArtifact, exists := dstArtifacts[dstPath]
@@ -160,8 +240,8 @@ func verifyMatchRule(ruleData map[string]string,
 			continue
 		}
 
-		// Ignore artifact pairs with no matching hashes
-		if !reflect.DeepEqual(srcArtifacts[srcPath], dstArtifact) {
+		// Ignore artifact pairs with disagreeing hashes, see HashPolicy
+		if !hashPolicy.hashesAgree(srcArtifacts[srcPath], dstArtifact) {
 			continue
 		}
 
@@ -183,190 +263,444 @@ rule it is removed from the queue.  An artifact can only be consumed once in
 the course of processing the set of rules in ExpectedMaterials or
 ExpectedProducts.
 
-Rules of type MATCH, ALLOW, CREATE, DELETE, MODIFY and DISALLOW are supported.
-
-All rules except for DISALLOW consume queued artifacts on success, and
-leave the queue unchanged on failure.  Hence, it is left to a terminal
-DISALLOW rule to fail overall verification, if artifacts are left in the queue
-that should have been consumed by preceding rules.
+Rules of type MATCH, MATCH-DIGEST, ALLOW, CREATE, DELETE, MODIFY, DISALLOW,
+REQUIRE, REQUIRE-ANY, REQUIRE-ALL-OF and EXPECT-COUNT are supported.  MATCH
+rules require equal hash objects, as no HashPolicy is passed.  MATCH-DIGEST
+rules compare artifacts with the digests pinned in a manifest, whose relative
+path is resolved against the current working directory, see WithManifestDir,
+and whose own digest is pinned by the rule.
+
+All rules except for DISALLOW, REQUIRE, REQUIRE-ANY, REQUIRE-ALL-OF and
+EXPECT-COUNT consume queued artifacts on success, and leave the queue
+unchanged on failure.  The latter only assert which and how many artifacts
+are queued.  Hence, it is left to a terminal DISALLOW rule to fail overall
+verification, if artifacts are left in the queue that should have been
+consumed by preceding rules.
 */
 func VerifyArtifacts(items []interface{},
+	itemsMetadata map[string]Metadata) error {
+	return (&verification{}).verifyArtifacts(items, itemsMetadata)
+}
+
+/*
+RuleTrace records the application of a single artifact rule of a step or
+inspection during VerifyArtifacts, see WithRuleTracer.  Queue holds the queued
+artifacts before the rule was applied, Filtered the queued artifacts matched by
+the rule pattern, Consumed the artifacts removed from the queue by the rule,
+and Remaining the queue after the rule was applied.  Err is set if the rule
+failed, in which case no further rules of the item are applied.  Sublayout is
+the path of the sublayout the item belongs to, e.g. "sublayout", see
+WithSublayoutParameters, and empty for items of the verified layout.
+*/
+type RuleTrace struct {
+	Sublayout    string
+	ItemType     string
+	Item         string
+	ArtifactType string
+	Rule         []string
+	Queue        []string
+	Filtered     []string
+	Consumed     []string
+	Remaining    []string
+	Err          error
+}
+
+/*
+RuleTracer is called for each artifact rule applied during verification, in
+the order in which the rules are applied.
+*/
+type RuleTracer func(trace RuleTrace)
+
+func (v *verification) verifyArtifacts(items []interface{},
 	itemsMetadata map[string]Metadata) error {
 	// Verify artifact rules for each item in the layout
 	for _, itemI := range items {
-		// The layout item (interface) must be a Link or an Inspection we are only
-		// interested in the name and the expected materials and products
-		var itemName string
-		var expectedMaterials [][]string
-		var expectedProducts [][]string
-
+		phase, itemName := PhaseArtifactRules, ""
 		switch item := itemI.(type) {
 		case Step:
 			itemName = item.Name
-			expectedMaterials = item.ExpectedMaterials
-			expectedProducts = item.ExpectedProducts
-
 		case Inspection:
-			itemName = item.Name
-			expectedMaterials = item.ExpectedMaterials
-			expectedProducts = item.ExpectedProducts
+			phase, itemName = PhaseInspections, item.Name
+		}
+		// Items that failed earlier lack the metadata to verify
+		if v.hasFailed(itemName) {
+			continue
+		}
 
-		default: // Something wrong
-			return fmt.Errorf("VerifyArtifacts received an item of invalid type,"+
-				" elements of passed slice 'items' must be one of 'Step' or"+
-				" 'Inspection', got: '%s'", reflect.TypeOf(item))
+		failedRule, err := verifyItemArtifacts(itemI, itemsMetadata,
+			artifactRuleOptions{
+				matches:     v.patternDialect.matcher(),
+				hashPolicy:  v.hashPolicy,
+				manifestDir: v.manifestDir,
+			}, v.traceRule, v.log())
+		itemReport := v.report.item(itemI)
+		itemReport.recordResult(err)
+		if err != nil {
+			if itemReport != nil {
+				itemReport.FailedRule = failedRule
+			}
+			if err := v.itemFailed(phase, itemName, err); err != nil {
+				return err
+			}
 		}
+	}
+	return nil
+}
 
-		// Use the item's name to extract the corresponding link
-		srcLinkEnv, exists := itemsMetadata[itemName]
-		if !exists {
-			return fmt.Errorf("VerifyArtifacts could not find metadata"+
-				" for item '%s', got: '%s'", itemName, itemsMetadata)
+/*
+traceRule records the artifacts matched by MATCH rules in the evidence graph
+and passes the trace on to the RuleTracer of the Verifier, if any.
+*/
+func (v *verification) traceRule(trace RuleTrace) {
+	trace.Sublayout = v.sublayoutPath
+	v.report.recordMatchEvidence(trace)
+	if v.ruleTracer != nil {
+		v.ruleTracer(trace)
+	}
+}
+
+/*
+artifactRuleOptions configures how verifyItemArtifacts applies artifact rules.
+Rule patterns are matched with matches, see PatternDialect.  MATCH and
+MATCH-DIGEST rules compare artifacts according to hashPolicy, which may be
+nil, and relative manifest paths of MATCH-DIGEST rules are resolved against
+manifestDir.
+*/
+type artifactRuleOptions struct {
+	matches     patternMatcher
+	hashPolicy  *HashPolicy
+	manifestDir string
+}
+
+/*
+verifyItemArtifacts applies the material and product rules of a single step or
+inspection according to the passed options.  See VerifyArtifacts for details.
+If a rule fails, it is returned along with the error.  If tracer is not nil,
+it is called for each applied rule.  Applied rules are also logged to the
+passed logger at debug level.
+*/
+func verifyItemArtifacts(itemI interface{},
+	itemsMetadata map[string]Metadata, opts artifactRuleOptions,
+	tracer RuleTracer, logger *slog.Logger) ([]string, error) {
+	// The layout item (interface) must be a Link or an Inspection we are only
+	// interested in the name and the expected materials and products
+	var itemName string
+	var expectedMaterials [][]string
+	var expectedProducts [][]string
+
+	switch item := itemI.(type) {
+	case Step:
+		itemName = item.Name
+		expectedMaterials = item.ExpectedMaterials
+		expectedProducts = item.ExpectedProducts
+
+	case Inspection:
+		itemName = item.Name
+		expectedMaterials = item.ExpectedMaterials
+		expectedProducts = item.ExpectedProducts
+
+	default: // Something wrong
+		return nil, fmt.Errorf("VerifyArtifacts received an item of invalid type,"+
+			" elements of passed slice 'items' must be one of 'Step' or"+
+			" 'Inspection', got: '%s'", reflect.TypeOf(item))
+	}
+
+	// Use the item's name to extract the corresponding link
+	srcLinkEnv, exists := itemsMetadata[itemName]
+	if !exists {
+		return nil, fmt.Errorf("VerifyArtifacts could not find metadata"+
+			" for item '%s', got: '%s'", itemName, itemsMetadata)
+	}
+
+	// Create shortcuts to materials and products (including hashes) reported
+	// by the item's link, required to verify "match" rules
+	link, ok := srcLinkEnv.GetPayload().(Link)
+	if !ok {
+		return nil, fmt.Errorf("invalid metadata")
+	}
+	materials := link.Materials
+	products := link.Products
+
+	// All other rules only require the material or product paths (without
+	// hashes). We extract them from the corresponding maps and store them as
+	// sets for convenience in further processing
+	materialPaths := NewSet()
+	for _, p := range artifactsDictKeyStrings(materials) {
+		materialPaths.Add(path.Clean(p))
+	}
+	productPaths := NewSet()
+	for _, p := range artifactsDictKeyStrings(products) {
+		productPaths.Add(path.Clean(p))
+	}
+
+	// For `create`, `delete` and `modify` rules we prepare sets of artifacts
+	// (without hashes) that were created, deleted or modified in the current
+	// step or inspection
+	created := productPaths.Difference(materialPaths)
+	deleted := materialPaths.Difference(productPaths)
+	remained := materialPaths.Intersection(productPaths)
+	modified := NewSet()
+	for name := range remained {
+		if !reflect.DeepEqual(materials[name], products[name]) {
+			modified.Add(name)
 		}
+	}
 
-		// Create shortcuts to materials and products (including hashes) reported
-		// by the item's link, required to verify "match" rules
-		link, ok := srcLinkEnv.GetPayload().(Link)
+	// For each item we have to run rule verification, once per artifact type.
+	// Here we prepare the corresponding data for each round.
+	verificationDataList := []map[string]interface{}{
+		{
+			"srcType":       "materials",
+			"rules":         expectedMaterials,
+			"artifacts":     materials,
+			"artifactPaths": materialPaths,
+		},
+		{
+			"srcType":       "products",
+			"rules":         expectedProducts,
+			"artifacts":     products,
+			"artifactPaths": productPaths,
+		},
+	}
+	// Process all material rules using the corresponding materials and all
+	// product rules using the corresponding products
+	for _, verificationData := range verificationDataList {
+		rules, ok := verificationData["rules"].([][]string)
 		if !ok {
-			return fmt.Errorf("invalid metadata")
-		}
-		materials := link.Materials
-		products := link.Products
-
-		// All other rules only require the material or product paths (without
-		// hashes). We extract them from the corresponding maps and store them as
-		// sets for convenience in further processing
-		materialPaths := NewSet()
-		for _, p := range artifactsDictKeyStrings(materials) {
-			materialPaths.Add(path.Clean(p))
-		}
-		productPaths := NewSet()
-		for _, p := range artifactsDictKeyStrings(products) {
-			productPaths.Add(path.Clean(p))
-		}
-
-		// For `create`, `delete` and `modify` rules we prepare sets of artifacts
-		// (without hashes) that were created, deleted or modified in the current
-		// step or inspection
-		created := productPaths.Difference(materialPaths)
-		deleted := materialPaths.Difference(productPaths)
-		remained := materialPaths.Intersection(productPaths)
-		modified := NewSet()
-		for name := range remained {
-			if !reflect.DeepEqual(materials[name], products[name]) {
-				modified.Add(name)
-			}
+			return nil, fmt.Errorf(`rules must be of type [][]string`)
 		}
-
-		// For each item we have to run rule verification, once per artifact type.
-		// Here we prepare the corresponding data for each round.
-		verificationDataList := []map[string]interface{}{
-			{
-				"srcType":       "materials",
-				"rules":         expectedMaterials,
-				"artifacts":     materials,
-				"artifactPaths": materialPaths,
-			},
-			{
-				"srcType":       "products",
-				"rules":         expectedProducts,
-				"artifacts":     products,
-				"artifactPaths": productPaths,
-			},
-		}
-		// TODO: Add logging library (see in-toto/in-toto-golang#4)
-		// fmt.Printf("Verifying %s '%s' ", reflect.TypeOf(itemI), itemName)
-
-		// Process all material rules using the corresponding materials and all
-		// product rules using the corresponding products
-		for _, verificationData := range verificationDataList {
-			// TODO: Add logging library (see in-toto/in-toto-golang#4)
-			// fmt.Printf("%s...\n", verificationData["srcType"])
-
-			rules, ok := verificationData["rules"].([][]string)
-			if !ok {
-				return fmt.Errorf(`rules must be of type [][]string`)
+		artifacts, ok := verificationData["artifacts"].(map[string]HashObj)
+		if !ok {
+			return nil, fmt.Errorf(`artifacts must be of type map[string]HashObj`)
+		}
+		// Use artifacts (without hashes) as base queue. Each rule only operates
+		// on artifacts in that queue.  If a rule consumes an artifact (i.e. can
+		// be applied successfully), the artifact is removed from the queue. By
+		// applying a DISALLOW rule eventually, verification may return an error,
+		// if the rule matches any artifacts in the queue that should have been
+		// consumed earlier.
+		queue, ok := verificationData["artifactPaths"].(Set)
+		if !ok {
+			return nil, fmt.Errorf(`queue must be of type Set`)
+		}
+		srcType, ok := verificationData["srcType"].(string)
+		if !ok {
+			return nil, fmt.Errorf(`srcType must be of type string`)
+		}
+		// Report the state of the queue before and after each rule, and the
+		// error, if the rule failed
+		traceRule := func(rule []string, filtered Set, consumed Set, remaining Set, err error) {
+			logger.Debug("applied artifact rule", "item", itemName,
+				"artifactType", srcType, "rule", rule,
+				"consumed", len(consumed), "remaining", len(remaining),
+				"error", err)
+			if tracer == nil {
+				return
 			}
-			artifacts, ok := verificationData["artifacts"].(map[string]HashObj)
-			if !ok {
-				return fmt.Errorf(`artifacts must be of type map[string]HashObj`)
+			trace := RuleTrace{
+				ItemType:     reflect.TypeOf(itemI).Name(),
+				Item:         itemName,
+				ArtifactType: srcType,
+				Rule:         rule,
+				Queue:        sortedSlice(queue),
+				Filtered:     sortedSlice(filtered),
+				Consumed:     sortedSlice(consumed),
+				Remaining:    sortedSlice(remaining),
+				Err:          err,
 			}
-			// Use artifacts (without hashes) as base queue. Each rule only operates
-			// on artifacts in that queue.  If a rule consumes an artifact (i.e. can
-			// be applied successfully), the artifact is removed from the queue. By
-			// applying a DISALLOW rule eventually, verification may return an error,
-			// if the rule matches any artifacts in the queue that should have been
-			// consumed earlier.
-			queue, ok := verificationData["artifactPaths"].(Set)
-			if !ok {
-				return fmt.Errorf(`queue must be of type Set`)
+			tracer(trace)
+		}
+
+		// Verify rules sequentially
+		for _, rule := range rules {
+			// Parse rule and error out if it is malformed
+			// NOTE: the rule format should have been validated before
+			parsed, err := ParseRule(rule)
+			if err != nil {
+				traceRule(rule, nil, nil, queue, err)
+				return rule, err
 			}
-			// TODO: Add logging library (see in-toto/in-toto-golang#4)
-			// fmt.Printf("Initial state\nMaterials: %s\nProducts: %s\nQueue: %s\n\n",
-			// 	materialPaths.Slice(), productPaths.Slice(), queue.Slice())
-
-			// Verify rules sequentially
-			for _, rule := range rules {
-				// Parse rule and error out if it is malformed
-				// NOTE: the rule format should have been validated before
-				ruleData, err := UnpackRule(rule)
+
+			// Apply rule pattern to filter queued artifacts that are up for rule
+			// specific consumption
+			filtered := queue.filter(path.Clean(parsed.Patterns()[0]), opts.matches)
+
+			var consumed Set
+			switch r := parsed.(type) {
+			case MatchRule:
+				// Note: here we need to perform more elaborate filtering
+				consumed = verifyMatchRule(r, artifacts, queue,
+					itemsMetadata, opts.matches, opts.hashPolicy, logger)
+
+			case MatchDigestRule:
+				// Consumes filtered artifacts, whose hashes agree with those
+				// pinned in the manifest
+				manifest, err := loadDigestManifest(opts.manifestDir,
+					r.Manifest, r.Algorithm, r.Digest)
 				if err != nil {
-					return err
+					err = fmt.Errorf("failed to load manifest of rule %s: %w",
+						rule, err)
+					traceRule(rule, filtered, nil, queue, err)
+					return rule, err
+				}
+				consumed = NewSet()
+				for name := range filtered {
+					hashes, _ := artifactHashes(artifacts, name)
+					if pinned, ok := manifest[name]; ok &&
+						opts.hashPolicy.digestsAgree(hashes, pinned) {
+						consumed.Add(name)
+					}
+				}
+
+			case AllowRule:
+				// Consumes all filtered artifacts
+				consumed = filtered
+
+			case CreateRule:
+				// Consumes filtered artifacts that were created
+				consumed = filtered.Intersection(created)
+
+			case DeleteRule:
+				// Consumes filtered artifacts that were deleted
+				consumed = filtered.Intersection(deleted)
+
+			case ModifyRule:
+				// Consumes filtered artifacts that were modified
+				consumed = filtered.Intersection(modified)
+
+			case DisallowRule:
+				// Does not consume but errors out if artifacts were filtered
+				if len(filtered) > 0 {
+					err := &ArtifactRuleError{
+						ItemType:     reflect.TypeOf(itemI).Name(),
+						Item:         itemName,
+						Rule:         rule,
+						ParsedRule:   r,
+						Reason:       FailureDisallowed,
+						ArtifactType: srcType,
+						Paths:        filtered.Slice(),
+						Queue:        sortedSlice(queue),
+					}
+					traceRule(rule, filtered, nil, queue, err)
+					return rule, err
+				}
+			case RequireAnyRule:
+				// Does not consume but errors out if no artifacts were filtered
+				if len(filtered) == 0 {
+					err := &ArtifactRuleError{
+						ItemType:     reflect.TypeOf(itemI).Name(),
+						Item:         itemName,
+						Rule:         rule,
+						ParsedRule:   r,
+						Reason:       FailureMissing,
+						ArtifactType: srcType,
+						Queue:        sortedSlice(queue),
+					}
+					traceRule(rule, filtered, nil, queue, err)
+					return rule, err
+				}
+
+			case RequireAllOfRule:
+				// Does not consume but errors out if any pattern does not
+				// match a queued artifact
+				var missing []string
+				for _, pattern := range r.PatternList {
+					matched := queue.filter(path.Clean(pattern), opts.matches)
+					if len(matched) == 0 {
+						missing = append(missing, pattern)
+					}
+					for name := range matched {
+						filtered.Add(name)
+					}
+				}
+				if len(missing) > 0 {
+					err := &ArtifactRuleError{
+						ItemType:     reflect.TypeOf(itemI).Name(),
+						Item:         itemName,
+						Rule:         rule,
+						ParsedRule:   r,
+						Reason:       FailureMissing,
+						ArtifactType: srcType,
+						Paths:        missing,
+						Queue:        sortedSlice(queue),
+					}
+					traceRule(rule, filtered, nil, queue, err)
+					return rule, err
 				}
 
-				// Apply rule pattern to filter queued artifacts that are up for rule
-				// specific consumption
-				filtered := queue.Filter(path.Clean(ruleData["pattern"]))
-
-				var consumed Set
-				switch ruleData["type"] {
-				case "match":
-					// Note: here we need to perform more elaborate filtering
-					consumed = verifyMatchRule(ruleData, artifacts, queue, itemsMetadata)
-
-				case "allow":
-					// Consumes all filtered artifacts
-					consumed = filtered
-
-				case "create":
-					// Consumes filtered artifacts that were created
-					consumed = filtered.Intersection(created)
-
-				case "delete":
-					// Consumes filtered artifacts that were deleted
-					consumed = filtered.Intersection(deleted)
-
-				case "modify":
-					// Consumes filtered artifacts that were modified
-					consumed = filtered.Intersection(modified)
-
-				case "disallow":
-					// Does not consume but errors out if artifacts were filtered
-					if len(filtered) > 0 {
-						return fmt.Errorf("artifact verification failed for %s '%s',"+
-							" %s %s disallowed by rule %s",
-							reflect.TypeOf(itemI).Name(), itemName,
-							verificationData["srcType"], filtered.Slice(), rule)
+			case ExpectCountRule:
+				// Does not consume but errors out if the number of filtered
+				// artifacts does not compare to the expected count
+				if !countComparisons[r.Op](len(filtered), r.Count) {
+					err := &ArtifactRuleError{
+						ItemType:     reflect.TypeOf(itemI).Name(),
+						Item:         itemName,
+						Rule:         rule,
+						ParsedRule:   r,
+						Reason:       FailureCountMismatch,
+						ArtifactType: srcType,
+						Paths:        sortedSlice(filtered),
+						Queue:        sortedSlice(queue),
 					}
-				case "require":
-					// REQUIRE is somewhat of a weird animal that does not use
-					// patterns bur rather single filenames (for now).
-					if !queue.Has(ruleData["pattern"]) {
-						return fmt.Errorf("artifact verification failed for %s in REQUIRE '%s',"+
-							" because %s is not in %s", verificationData["srcType"],
-							ruleData["pattern"], ruleData["pattern"], queue.Slice())
+					traceRule(rule, filtered, nil, queue, err)
+					return rule, err
+				}
+
+			case RequireRule:
+				// REQUIRE is somewhat of a weird animal that does not use
+				// patterns bur rather single filenames (for now).  With a
+				// digest, the artifact must also have the pinned hash.
+				hashes, _ := artifactHashes(artifacts, r.Filename)
+				pinned := HashObj{r.Algorithm: r.Digest}
+				var reason ArtifactRuleFailure
+				switch {
+				case !queue.Has(r.Filename):
+					reason = FailureMissing
+				case r.Digest != "" && !opts.hashPolicy.digestsAgree(hashes, pinned):
+					reason = FailureDigestMismatch
+				}
+				if reason != "" {
+					err := &ArtifactRuleError{
+						ItemType:     reflect.TypeOf(itemI).Name(),
+						Item:         itemName,
+						Rule:         rule,
+						ParsedRule:   r,
+						Reason:       reason,
+						ArtifactType: srcType,
+						Paths:        []string{r.Filename},
+						Queue:        sortedSlice(queue),
 					}
+					traceRule(rule, filtered, nil, queue, err)
+					return rule, err
 				}
-				// Update queue by removing consumed artifacts
-				queue = queue.Difference(consumed)
-				// TODO: Add logging library (see in-toto/in-toto-golang#4)
-				// fmt.Printf("Rule: %s\nQueue: %s\n\n", rule, queue.Slice())
 			}
+			// Update queue by removing consumed artifacts
+			remaining := queue.Difference(consumed)
+			traceRule(rule, filtered, consumed, remaining, nil)
+			queue = remaining
 		}
 	}
-	return nil
+	return nil, nil
 }
 
+/*
+LinkAgreementPolicy determines how ReduceStepsMetadata treats multiple links
+for a step, which report different Materials or Products.
+*/
+type LinkAgreementPolicy int
+
+const (
+	// AllLinksAgree requires all links for a step to report the same
+	// Materials and Products.
+	AllLinksAgree LinkAgreementPolicy = iota
+	// ThresholdLinksAgree requires links of at least Threshold distinct
+	// functionaries for a step to report the same Materials and Products,
+	// where functionaries are identified as configured by the step's
+	// ThresholdIdentity.  Links that report different artifacts are
+	// dissenting and do not fail the step.
+	ThresholdLinksAgree
+)
+
 /*
 ReduceStepsMetadata merges for each step of the passed Layout all the passed
 per-functionary links into a single link, asserting that the reported Materials
@@ -383,74 +717,180 @@ step.  The function returns a map with one Metablock (link) per step:
 
 If links corresponding to the same step report different Materials or different
 Products, the first return value is an empty Metablock map and the second
-return value is the error.
+return value is the error.  See WithLinkAgreementPolicy to tolerate dissenting
+links.
 */
 func ReduceStepsMetadata(layout Layout,
+	stepsMetadata map[string]map[string]Metadata) (map[string]Metadata,
+	error) {
+	return (&verification{}).reduceStepsMetadata(layout, stepsMetadata)
+}
+
+func (v *verification) reduceStepsMetadata(layout Layout,
 	stepsMetadata map[string]map[string]Metadata) (map[string]Metadata,
 	error) {
 	stepsMetadataReduced := make(map[string]Metadata)
 
 	for _, step := range layout.Steps {
-		linksPerStep, ok := stepsMetadata[step.Name]
-		// We should never get here, layout verification must fail earlier
-		if !ok || len(linksPerStep) < 1 {
-			panic("Could not reduce metadata for step '" + step.Name +
-				"', no link metadata found.")
+		if v.hasFailed(step.Name) {
+			continue
 		}
+		linkEnv, dissenting, err := reduceStepMetadata(step,
+			stepsMetadata[step.Name], v.identities[step.Name],
+			v.linkAgreementPolicy)
+		if err != nil {
+			v.report.item(step).recordResult(err)
+			if err := v.itemFailed(PhaseArtifactRules, step.Name, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if len(dissenting) > 0 {
+			for _, keyID := range dissenting {
+				v.log().Warn(fmt.Sprintf("Link '%s' reports different artifacts"+
+					" than the other links for step '%s' and is ignored.",
+					fmt.Sprintf(LinkNameFormat, step.Name, keyID), step.Name),
+					"step", step.Name, "keyid", keyID)
+			}
+			v.report.item(step).recordDissentingLinks(step.Name, dissenting)
+		}
+		v.pruneLinkEvidence(step.Name, dissenting)
+		stepsMetadataReduced[step.Name] = linkEnv
+	}
+	return stepsMetadataReduced, nil
+}
 
-		// Get the first link (could be any link) for the current step, which will
-		// serve as reference link for below comparisons
-		var referenceKeyID string
-		var referenceLinkEnv Metadata
-		for keyID, linkEnv := range linksPerStep {
-			referenceLinkEnv = linkEnv
-			referenceKeyID = keyID
-			break
+/*
+reduceStepMetadata merges the passed per-functionary links of a single step
+according to the passed policy.  It returns the reference link, and the sorted
+key ids of dissenting links, which report different artifacts than the
+reference link.  Agreeing links count towards the threshold once per
+functionary, as identified by the passed identities per key id, or by their key
+id, if they have no identity.  See ReduceStepsMetadata for details.
+*/
+func reduceStepMetadata(step Step, linksPerStep map[string]Metadata,
+	identities map[string]string,
+	policy LinkAgreementPolicy) (Metadata, []string, error) {
+	// We should never get here, layout verification must fail earlier
+	if len(linksPerStep) < 1 {
+		panic("Could not reduce metadata for step '" + step.Name +
+			"', no link metadata found.")
+	}
+
+	// Group links that report equal artifacts, the first link of the first
+	// group serves as reference link for the comparisons
+	type agreeingLinks struct {
+		link        Link
+		keyIDs      []string
+		functionary Set
+	}
+	var groups []*agreeingLinks
+	for _, keyID := range sortedKeyIDs(linksPerStep) {
+		link, ok := linksPerStep[keyID].GetPayload().(Link)
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid metadata")
+		}
+		var group *agreeingLinks
+		for _, g := range groups {
+			if reflect.DeepEqual(link.Materials, g.link.Materials) &&
+				reflect.DeepEqual(link.Products, g.link.Products) {
+				group = g
+				break
+			}
+		}
+		if group == nil {
+			group = &agreeingLinks{link: link, functionary: NewSet()}
+			groups = append(groups, group)
+		}
+		group.keyIDs = append(group.keyIDs, keyID)
+		if identity, ok := identities[keyID]; ok {
+			group.functionary.Add(identity)
+		} else {
+			group.functionary.Add(keyID)
 		}
+	}
 
-		// Only one link, nothing to reduce, take the reference link
-		if len(linksPerStep) == 1 {
-			stepsMetadataReduced[step.Name] = referenceLinkEnv
+	// All links agree, nothing to reduce, take the reference link
+	if len(groups) == 1 {
+		return linksPerStep[groups[0].keyIDs[0]], nil, nil
+	}
 
-			// Multiple links, reduce but first check
-		} else {
-			// Artifact maps must be equal for each type among all links
-			// TODO: What should we do if there are more links, than the
-			// threshold requires, but not all of them are equal? Right now we would
-			// also error.
-			for keyID, linkEnv := range linksPerStep {
-				link, ok := linkEnv.GetPayload().(Link)
-				if !ok {
-					return nil, fmt.Errorf("invalid metadata")
-				}
-				refLink, ok := referenceLinkEnv.GetPayload().(Link)
-				if !ok {
-					return nil, fmt.Errorf("invalid metadata")
-				}
-				if !reflect.DeepEqual(link.Materials, refLink.Materials) ||
-					!reflect.DeepEqual(link.Products, refLink.Products) {
-					return nil, fmt.Errorf("link '%s' and '%s' have different"+
-						" artifacts",
-						fmt.Sprintf(LinkNameFormat, step.Name, referenceKeyID),
-						fmt.Sprintf(LinkNameFormat, step.Name, keyID))
-				}
-			}
-			// We haven't errored out, so we can reduce (i.e take the reference link)
-			stepsMetadataReduced[step.Name] = referenceLinkEnv
+	if policy != ThresholdLinksAgree {
+		return nil, nil, fmt.Errorf("link '%s' and '%s' have different"+
+			" artifacts",
+			fmt.Sprintf(LinkNameFormat, step.Name, groups[0].keyIDs[0]),
+			fmt.Sprintf(LinkNameFormat, step.Name, groups[1].keyIDs[0]))
+	}
+
+	// Exactly one group of links must reach the threshold of distinct
+	// functionaries, which is at least one
+	threshold := step.Threshold
+	if threshold < 1 {
+		threshold = 1
+	}
+	var majority *agreeingLinks
+	var dissenting []string
+	for _, group := range groups {
+		if len(group.functionary) < threshold {
+			dissenting = append(dissenting, group.keyIDs...)
+			continue
 		}
+		if majority != nil {
+			return nil, nil, fmt.Errorf("link '%s' and '%s' have different"+
+				" artifacts, and both are backed by a threshold of %d"+
+				" functionaries",
+				fmt.Sprintf(LinkNameFormat, step.Name, majority.keyIDs[0]),
+				fmt.Sprintf(LinkNameFormat, step.Name, group.keyIDs[0]),
+				threshold)
+		}
+		majority = group
 	}
-	return stepsMetadataReduced, nil
+	if majority == nil {
+		return nil, nil, fmt.Errorf("links for step '%s' have different"+
+			" artifacts, fewer than a threshold of %d functionaries agree",
+			step.Name, threshold)
+	}
+	sort.Strings(dissenting)
+	return linksPerStep[majority.keyIDs[0]], dissenting, nil
 }
 
 /*
 VerifyStepCommandAlignment (soft) verifies that for each step of the passed
 layout the command executed, as per the passed link, matches the expected
 command, as per the layout.  Soft verification means that, in case a command
-does not align, a warning is issued.
+does not align, a warning is issued.  Misaligned commands of steps, whose
+command alignment is enforced, are logged as errors.  Use
+CheckStepCommandAlignment to get these errors.
 */
 func VerifyStepCommandAlignment(layout Layout,
 	stepsMetadata map[string]map[string]Metadata) {
+	_ = CheckStepCommandAlignment(layout, stepsMetadata)
+}
+
+/*
+CheckStepCommandAlignment verifies that for each step of the passed layout the
+command executed, as per the passed link, aligns with the expected command, as
+per the layout, according to the CommandAlignmentPolicy of the step and the
+layout.  Misaligned commands of steps with CommandAlignmentWarn are logged as
+warnings, while for steps with CommandAlignmentEnforce a *CommandAlignmentError
+is returned.
+*/
+func CheckStepCommandAlignment(layout Layout,
+	stepsMetadata map[string]map[string]Metadata) error {
+	return (&verification{}).verifyStepCommandAlignment(layout, stepsMetadata)
+}
+
+func (v *verification) verifyStepCommandAlignment(layout Layout,
+	stepsMetadata map[string]map[string]Metadata) error {
 	for _, step := range layout.Steps {
+		if v.hasFailed(step.Name) {
+			continue
+		}
+		policy := resolveCommandAlignmentPolicy(layout, step,
+			v.commandAlignmentPolicy)
+		if policy.Mode == CommandAlignmentIgnore {
+			continue
+		}
 		linksPerStep, ok := stepsMetadata[step.Name]
 		// We should never get here, layout verification must fail earlier
 		if !ok || len(linksPerStep) < 1 {
@@ -458,23 +898,72 @@ func VerifyStepCommandAlignment(layout Layout,
 				"', no link metadata found.")
 		}
 
-		for signerKeyID, linkEnv := range linksPerStep {
-			link, ok := linkEnv.GetPayload().(Link)
-			if !ok {
-				fmt.Printf("invalid metadata")
-				return
+		if err := v.verifyCommandAlignment(step, policy, linksPerStep); err != nil {
+			if err := v.itemFailed(PhaseCommandAlignment, step.Name, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+verifyCommandAlignment verifies the commands reported by the passed links for
+the passed step according to the passed policy.  Warnings are recorded in the
+report of the step.  If the policy enforces command alignment, metadata other
+than links fails the step.
+*/
+func (v *verification) verifyCommandAlignment(step Step,
+	policy CommandAlignmentPolicy, linksPerStep map[string]Metadata) error {
+	itemReport := v.report.item(step)
+	for _, signerKeyID := range sortedKeyIDs(linksPerStep) {
+		link, ok := linksPerStep[signerKeyID].GetPayload().(Link)
+		if !ok {
+			if policy.Mode == CommandAlignmentEnforce {
+				err := fmt.Errorf("failed to verify command alignment for step"+
+					" '%s': metadata of '%s' is not a link", step.Name, signerKeyID)
+				itemReport.recordResult(err)
+				return err
 			}
-			expectedCommandS := strings.Join(step.ExpectedCommand, " ")
-			executedCommandS := strings.Join(link.Command, " ")
-
-			if expectedCommandS != executedCommandS {
-				linkName := fmt.Sprintf(LinkNameFormat, step.Name, signerKeyID)
-				fmt.Printf("WARNING: Expected command for step '%s' (%s) and command"+
-					" reported by '%s' (%s) differ.\n",
-					step.Name, expectedCommandS, linkName, executedCommandS)
+			v.log().Error("invalid metadata", "step", step.Name,
+				"keyid", signerKeyID)
+			continue
+		}
+		aligned, err := commandAligns(policy.Match, step.ExpectedCommand,
+			link.Command)
+		if err != nil {
+			err = fmt.Errorf("failed to verify command alignment for step"+
+				" '%s': %w", step.Name, err)
+			itemReport.recordResult(err)
+			return err
+		}
+		if aligned {
+			continue
+		}
+
+		linkName := fmt.Sprintf(LinkNameFormat, step.Name, signerKeyID)
+		if policy.Mode == CommandAlignmentEnforce {
+			err := &CommandAlignmentError{
+				Step:     step.Name,
+				Link:     linkName,
+				Match:    policy.Match,
+				Expected: step.ExpectedCommand,
+				Executed: link.Command,
 			}
+			v.log().Error(err.Error(), "step", step.Name, "keyid", signerKeyID)
+			itemReport.recordResult(err)
+			return err
+		}
+		warning := fmt.Sprintf("Expected command for step '%s' (%s) and"+
+			" command reported by '%s' (%s) differ.",
+			step.Name, strings.Join(step.ExpectedCommand, " "), linkName,
+			strings.Join(link.Command, " "))
+		v.log().Warn(warning, "step", step.Name, "keyid", signerKeyID)
+		if itemReport != nil {
+			itemReport.Warnings = append(itemReport.Warnings, warning)
 		}
 	}
+	return nil
 }
 
 /*
@@ -535,21 +1024,35 @@ return value is an empty map of Metablock maps and the second return value is
 the error.
 */
 func VerifyLinkSignatureThesholds(layout Layout,
+	stepsMetadata map[string]map[string]Metadata, rootCertPool, intermediateCertPool *x509.CertPool) (
+	map[string]map[string]Metadata, error) {
+	return (&verification{}).verifyLinkSignatureThresholds(context.Background(),
+		layout, stepsMetadata, rootCertPool, intermediateCertPool)
+}
+
+func (v *verification) verifyLinkSignatureThresholds(ctx context.Context, layout Layout,
 	stepsMetadata map[string]map[string]Metadata, rootCertPool, intermediateCertPool *x509.CertPool) (
 	map[string]map[string]Metadata, error) {
 	// This will stores links with valid signature from an authorized functionary
 	// for all steps
 	stepsMetadataVerified := make(map[string]map[string]Metadata)
 
+	// Verify the signatures of all links of all steps up front, so that they
+	// can be verified concurrently
+	results, err := v.verifyStepsLinkSignatures(ctx, layout, stepsMetadata,
+		rootCertPool, intermediateCertPool)
+	if err != nil {
+		return nil, err
+	}
+
 	// Try to find enough (>= threshold) links each with a valid signature from
 	// distinct authorized functionaries for each step
 	for _, step := range layout.Steps {
+		if v.hasFailed(step.Name) {
+			continue
+		}
 		var stepErr error
 
-		// This will store links with valid signature from an authorized
-		// functionary for the given step
-		linksPerStepVerified := make(map[string]Metadata)
-
 		// Check if there are any links at all for the given step
 		linksPerStep, ok := stepsMetadata[step.Name]
 		if !ok || len(linksPerStep) < 1 {
@@ -560,145 +1063,389 @@ func VerifyLinkSignatureThesholds(layout Layout,
 		// authorized, the layout contains a verification key and the signature
 		// verification passes.  Only good links are stored, to verify thresholds
 		// below.
-		isAuthorizedSignature := false
-		for signerKeyID, linkEnv := range linksPerStep {
-			for _, authorizedKeyID := range step.PubKeys {
-				if signerKeyID == authorizedKeyID {
-					if verifierKey, ok := layout.Keys[authorizedKeyID]; ok {
-						if err := linkEnv.VerifySignature(verifierKey); err == nil {
-							linksPerStepVerified[signerKeyID] = linkEnv
-							isAuthorizedSignature = true
-							break
-						}
-					}
-				}
+		linksPerStepVerified := make(map[string]Metadata)
+		linksPerStepRejected := make(map[string]error)
+		for keyID, err := range results[step.Name] {
+			if err != nil {
+				linksPerStepRejected[keyID] = err
+				continue
 			}
-
-			// If the signer's key wasn't in our step's pubkeys array, check the cert pool to
-			// see if the key is known to us.
-			if !isAuthorizedSignature {
-				sig, err := linkEnv.GetSignatureForKeyID(signerKeyID)
-				if err != nil {
-					stepErr = err
-					continue
-				}
-
-				cert, err := sig.GetCertificate()
-				if err != nil {
-					stepErr = err
-					continue
-				}
-
-				// test certificate against the step's constraints to make sure it's a valid functionary
-				err = step.CheckCertConstraints(cert, layout.RootCAIDs(), rootCertPool, intermediateCertPool)
-				if err != nil {
-					stepErr = err
-					continue
-				}
-
-				err = linkEnv.VerifySignature(cert)
-				if err != nil {
-					stepErr = err
-					continue
-				}
-
-				linksPerStepVerified[signerKeyID] = linkEnv
+			linksPerStepVerified[keyID] = linksPerStep[keyID]
+		}
+		for _, keyID := range sortedKeyIDs(linksPerStep) {
+			if err, rejected := linksPerStepRejected[keyID]; rejected {
+				v.log().Debug("rejected link", "step", step.Name,
+					"keyid", keyID, "error", err)
+				stepErr = err
 			}
 		}
 
+		// Count distinct functionaries, which might sign with several keys
+		identities, err := v.functionaryIdentities(layout, step,
+			linksPerStepVerified, linksPerStepRejected)
+		if err != nil {
+			stepErr = err
+		}
+
 		// Store all good links for a step
 		stepsMetadataVerified[step.Name] = linksPerStepVerified
+		if v.identities == nil {
+			v.identities = make(map[string]map[string]string)
+		}
+		v.identities[step.Name] = identities
+
+		itemReport := v.report.item(step)
+		itemReport.recordLinks(step.Name, linksPerStepVerified, linksPerStepRejected)
+		itemReport.recordIdentities(identities)
 
-		if len(linksPerStepVerified) < step.Threshold {
-			linksPerStep := stepsMetadata[step.Name]
-			return nil, fmt.Errorf("step '%s' requires '%d' link metadata file(s)."+
-				" '%d' out of '%d' available link(s) have a valid signature from an"+
-				" authorized signer: %v", step.Name, step.Threshold,
-				len(linksPerStepVerified), len(linksPerStep), stepErr)
+		found := NewSet()
+		for _, identity := range identities {
+			found.Add(identity)
+		}
+		if stepErr == nil && len(found) < len(linksPerStepVerified) {
+			stepErr = fmt.Errorf("%d link(s) are signed by the same"+
+				" functionary %s as other links",
+				len(linksPerStepVerified)-len(found), step.ThresholdIdentity)
+		}
+		if len(found) < step.Threshold {
+			err := &ThresholdError{
+				Step:      step.Name,
+				Threshold: step.Threshold,
+				Found:     len(found),
+				Available: len(linksPerStep),
+				Err:       stepErr,
+			}
+			itemReport.recordResult(err)
+			if err := v.itemFailed(PhaseThresholds, step.Name, err); err != nil {
+				return nil, err
+			}
+			delete(stepsMetadataVerified, step.Name)
+			continue
 		}
+		itemReport.recordResult(nil)
 	}
 	return stepsMetadataVerified, nil
 }
 
 /*
-LoadLinksForLayout loads for every Step of the passed Layout a Metablock
-containing the corresponding Link.  A base path to a directory that contains
-the links may be passed using linkDir.  Link file names are constructed,
-using LinkNameFormat together with the corresponding step name and authorized
-functionary key ids.  A map of link metadata is returned and has the following
-format:
+verifyStepsLinkSignatures checks for each link of each step of the passed
+layout, which has not failed yet, that it carries a valid signature from an
+authorized functionary.  A functionary is authorized, if its key is listed in
+the step's PubKeys, or if it signed the link with a certificate that satisfies
+the step's certificate constraints at the current time.  The signatures are
+verified concurrently, see WithParallelism.  The returned map contains for
+every step and signer key id the reason for rejecting the link as
+*SignatureError, or nil if the link passed.  If the passed context is done,
+the context's error is returned.
+*/
+func (v *verification) verifyStepsLinkSignatures(ctx context.Context, layout Layout,
+	stepsMetadata map[string]map[string]Metadata, rootCertPool, intermediateCertPool *x509.CertPool) (map[string]map[string]error, error) {
+	type job struct {
+		step        Step
+		signerKeyID string
+		linkEnv     Metadata
+	}
+	var jobs []job
+	for _, step := range layout.Steps {
+		if v.hasFailed(step.Name) {
+			continue
+		}
+		linksPerStep := stepsMetadata[step.Name]
+		for _, signerKeyID := range sortedKeyIDs(linksPerStep) {
+			jobs = append(jobs, job{step, signerKeyID, linksPerStep[signerKeyID]})
+		}
+	}
 
-	{
-		<step name> : {
-			<key id>: Metablock,
-			<key id>: Metablock,
-			...
-		},
-		<step name> : {
-		<key id>: Metablock,
-		<key id>: Metablock,
-		...
+	at := v.currentTime()
+	errs := make([]error, len(jobs))
+	if err := parallelFor(ctx, v.parallelism, len(jobs), func(i int) {
+		j := jobs[i]
+		if err := verifyLinkSignature(layout, j.step, j.signerKeyID, j.linkEnv,
+			rootCertPool, intermediateCertPool, at); err != nil {
+			errs[i] = &SignatureError{
+				Step:  j.step.Name,
+				KeyID: j.signerKeyID,
+				Err:   err,
+			}
 		}
-		...
+	}); err != nil {
+		return nil, err
 	}
 
-If a link cannot be loaded at a constructed link name or is invalid, it is
-ignored. Only a preliminary threshold check is performed, that is, if there
-aren't at least Threshold links for any given step, the first return value
-is an empty map of Metablock maps and the second return value is the error.
-*/
-func LoadLinksForLayout(layout Layout, linkDir string) (map[string]map[string]Metadata, error) {
-	stepsMetadata := make(map[string]map[string]Metadata)
+	results := make(map[string]map[string]error)
+	for i, j := range jobs {
+		if results[j.step.Name] == nil {
+			results[j.step.Name] = make(map[string]error)
+		}
+		results[j.step.Name][j.signerKeyID] = errs[i]
+	}
+	return results, nil
+}
 
-	for _, step := range layout.Steps {
-		linksPerStep := make(map[string]Metadata)
-		// Since we can verify against certificates belonging to a CA, we need to
-		// load any possible links
-		linkFiles, err := filepath.Glob(path.Join(linkDir, fmt.Sprintf(LinkGlobFormat, step.Name)))
+/*
+verifyLinkSignature verifies the signature of the passed step link created by
+the functionary with the passed key id at the passed point in time.  See
+verifyStepsLinkSignatures for details.
+*/
+func verifyLinkSignature(layout Layout, step Step, signerKeyID string,
+	linkEnv Metadata, rootCertPool, intermediateCertPool *x509.CertPool,
+	at time.Time) error {
+	for _, authorizedKeyID := range step.PubKeys {
+		if signerKeyID == authorizedKeyID {
+			if verifierKey, ok := layout.Keys[authorizedKeyID]; ok {
+				if err := linkEnv.VerifySignature(verifierKey); err == nil {
+					return nil
+				}
+			}
+		}
+	}
+
+	// If the signer's key wasn't in our step's pubkeys array, check the cert pool to
+	// see if the key is known to us.
+	sig, err := linkEnv.GetSignatureForKeyID(signerKeyID)
+	if err != nil {
+		return err
+	}
+
+	cert, err := sig.GetCertificate()
+	if err != nil {
+		return err
+	}
+
+	// test certificate against the step's constraints to make sure it's a valid functionary
+	err = step.CheckCertConstraintsAt(cert, layout.RootCAIDs(), rootCertPool, intermediateCertPool, at)
+	if err != nil {
+		return err
+	}
+
+	return linkEnv.VerifySignature(cert)
+}
+
+/*
+functionaryIdentities returns the identity of the functionary of each passed
+verified link of the passed step, see FunctionaryIdentity.  Links, whose
+functionary has no such identity, are moved from the verified to the rejected
+links, and the error of the last such link is returned.
+*/
+func (v *verification) functionaryIdentities(layout Layout, step Step,
+	linksVerified map[string]Metadata,
+	linksRejected map[string]error) (map[string]string, error) {
+	identities := make(map[string]string, len(linksVerified))
+	var identityErr error
+	for _, keyID := range sortedKeyIDs(linksVerified) {
+		identity, err := functionaryIdentity(layout, step, keyID,
+			linksVerified[keyID])
 		if err != nil {
-			return nil, err
+			identityErr = &SignatureError{Step: step.Name, KeyID: keyID, Err: err}
+			v.log().Debug("rejected link", "step", step.Name,
+				"keyid", keyID, "error", identityErr)
+			linksRejected[keyID] = identityErr
+			delete(linksVerified, keyID)
+			continue
 		}
+		identities[keyID] = identity
+	}
+	return identities, identityErr
+}
 
-		for _, linkPath := range linkFiles {
-			linkEnv, err := LoadMetadata(linkPath)
-			if err != nil {
-				continue
-			}
+/*
+functionaryIdentity returns the identity of the functionary, who signed the
+passed link with the key with the passed key id, as configured by the
+ThresholdIdentity of the passed step.  Keys listed in the step's PubKeys, and
+all keys without a configured identity, are identified by their key id.
+*/
+func functionaryIdentity(layout Layout, step Step, signerKeyID string,
+	linkEnv Metadata) (string, error) {
+	if step.ThresholdIdentity == "" || step.ThresholdIdentity == IdentityKeyID {
+		return signerKeyID, nil
+	}
+	cert, err := signerCertificate(layout, step, signerKeyID, linkEnv)
+	if err != nil {
+		return "", err
+	}
+	if cert == nil {
+		return signerKeyID, nil
+	}
+	return certificateIdentity(cert, step.ThresholdIdentity)
+}
 
-			// To get the full key from the metadata's signatures, we have to check
-			// for one with the same short id...
-			signerShortKeyID := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(linkPath), step.Name+"."), ".link")
-			for _, sig := range linkEnv.Sigs() {
-				if strings.HasPrefix(sig.KeyID, signerShortKeyID) {
-					linksPerStep[sig.KeyID] = linkEnv
-					break
-				}
-			}
+/*
+signerCertificate returns the certificate, with which the passed link of the
+passed step was signed by the key with the passed key id.  It returns nil, if
+the key is listed in the step's PubKeys, i.e. the link was not signed with a
+certificate.
+*/
+func signerCertificate(layout Layout, step Step, signerKeyID string,
+	linkEnv Metadata) (*x509.Certificate, error) {
+	for _, authorizedKeyID := range step.PubKeys {
+		if _, ok := layout.Keys[authorizedKeyID]; ok && signerKeyID == authorizedKeyID {
+			return nil, nil
 		}
+	}
+
+	sig, err := linkEnv.GetSignatureForKeyID(signerKeyID)
+	if err != nil {
+		return nil, err
+	}
+	certKey, err := sig.GetCertificate()
+	if err != nil {
+		return nil, err
+	}
+	_, possibleCert, err := decodeAndParse([]byte(certKey.KeyVal.Certificate))
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := possibleCert.(*x509.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("not a valid certificate")
+	}
+	return cert, nil
+}
+
+/*
+LoadLinksForLayout loads for every Step of the passed Layout a Metablock
+containing the corresponding Link.  A base path to a directory that contains
+the links may be passed using linkDir.  Link file names are constructed,
+using LinkNameFormat together with the corresponding step name and authorized
+functionary key ids.  A map of link metadata is returned and has the following
+format:
 
-		if len(linksPerStep) < step.Threshold {
-			return nil, fmt.Errorf("step '%s' requires '%d' link metadata file(s),"+
-				" found '%d'", step.Name, step.Threshold, len(linksPerStep))
+	{
+		<step name> : {
+			<key id>: Metablock,
+			<key id>: Metablock,
+			...
+		},
+		<step name> : {
+		<key id>: Metablock,
+		<key id>: Metablock,
+		...
+		}
+		...
+	}
+
+If a link cannot be loaded at a constructed link name or is invalid, it is
+ignored. Only a preliminary threshold check is performed, that is, if there
+aren't at least Threshold links for any given step, the first return value
+is an empty map of Metablock maps and the second return value is the error.
+*/
+func LoadLinksForLayout(layout Layout, linkDir string) (map[string]map[string]Metadata, error) {
+	return (&verification{}).loadLinksForLayout(context.Background(), layout,
+		NewDirectoryLinkSource(linkDir))
+}
+
+/*
+LoadLinksFromSource provides the same functionality as LoadLinksForLayout, but
+loads the links from the passed LinkSource.
+*/
+func LoadLinksFromSource(layout Layout, source LinkSource) (map[string]map[string]Metadata, error) {
+	return (&verification{}).loadLinksForLayout(context.Background(), layout, source)
+}
+
+func (v *verification) loadLinksForLayout(ctx context.Context, layout Layout, source LinkSource) (map[string]map[string]Metadata, error) {
+	stepsMetadata := make(map[string]map[string]Metadata)
+
+	// Load the links of all steps concurrently, see WithParallelism, and
+	// process the results in the order of the steps
+	linksPerSteps := make([]map[string]Metadata, len(layout.Steps))
+	originsPerSteps := make([]map[string]LinkOrigin, len(layout.Steps))
+	errs := make([]error, len(layout.Steps))
+	if err := parallelFor(ctx, v.parallelism, len(layout.Steps), func(i int) {
+		linksPerSteps[i], originsPerSteps[i], errs[i] = loadLinksForStep(layout.Steps[i], source)
+	}); err != nil {
+		return nil, err
+	}
+
+	v.linkOrigins = make(map[string]map[string]LinkOrigin)
+
+	for i, step := range layout.Steps {
+		linksPerStep, err := linksPerSteps[i], errs[i]
+		if err != nil {
+			v.report.item(step).recordResult(err)
+			if err := v.itemFailed(PhaseLinkLoading, step.Name, err); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
 		stepsMetadata[step.Name] = linksPerStep
+		v.linkOrigins[step.Name] = originsPerSteps[i]
 	}
 
 	return stepsMetadata, nil
 }
 
+/*
+loadLinksForStep loads the links for a single step from the passed source.
+See LoadLinksForLayout for details.  If the source is a LinkOriginSource, the
+origins of the links are returned keyed by the same full key ids as the links.
+*/
+func loadLinksForStep(step Step, source LinkSource) (map[string]Metadata, map[string]LinkOrigin, error) {
+	linksPerStep := make(map[string]Metadata)
+	originsPerStep := make(map[string]LinkOrigin)
+	// Since we can verify against certificates belonging to a CA, we need to
+	// load any possible links
+	var links map[string]Metadata
+	var origins map[string]LinkOrigin
+	var err error
+	if originSource, ok := source.(LinkOriginSource); ok {
+		links, origins, err = originSource.LinksWithOrigins(step.Name)
+	} else {
+		links, err = source.Links(step.Name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, signerShortKeyID := range sortedKeyIDs(links) {
+		linkEnv := links[signerShortKeyID]
+
+		// To get the full key from the metadata's signatures, we have to check
+		// for one with the same short id...
+		for _, sig := range linkEnv.Sigs() {
+			if strings.HasPrefix(sig.KeyID, signerShortKeyID) {
+				linksPerStep[sig.KeyID] = linkEnv
+				if origin, ok := origins[signerShortKeyID]; ok {
+					originsPerStep[sig.KeyID] = origin
+				}
+				break
+			}
+		}
+	}
+
+	if len(linksPerStep) < step.Threshold {
+		return nil, nil, &ThresholdError{
+			Step:      step.Name,
+			Threshold: step.Threshold,
+			Found:     len(linksPerStep),
+			Available: len(links),
+		}
+	}
+
+	return linksPerStep, originsPerStep, nil
+}
+
 /*
 VerifyLayoutExpiration verifies that the passed Layout has not expired.  It
 returns an error if the (zulu) date in the Expires field is in the past.
 */
 func VerifyLayoutExpiration(layout Layout) error {
+	return VerifyLayoutExpirationAt(layout, time.Now())
+}
+
+/*
+VerifyLayoutExpirationAt provides the same functionality as
+VerifyLayoutExpiration, but verifies that the passed Layout has not expired at
+the passed point in time, e.g. the release date of an artifact.
+*/
+func VerifyLayoutExpirationAt(layout Layout, now time.Time) error {
 	expires, err := time.Parse(ISO8601DateSchema, layout.Expires)
 	if err != nil {
 		return err
 	}
 	// Uses timezone of expires, i.e. UTC
-	if time.Until(expires) < 0 {
-		return fmt.Errorf("layout has expired on '%s'", expires)
+	if expires.Sub(now) < 0 {
+		return &LayoutExpiredError{Expires: expires}
 	}
 	return nil
 }
@@ -716,48 +1463,124 @@ func VerifyLayoutSignatures(layoutEnv Metadata,
 		return fmt.Errorf("layout verification requires at least one key")
 	}
 
-	for _, key := range layoutKeys {
+	for keyID, key := range layoutKeys {
 		if err := layoutEnv.VerifySignature(key); err != nil {
-			return err
+			return &SignatureError{KeyID: keyID, Err: err}
 		}
 	}
 	return nil
 }
 
 /*
-GetSummaryLink merges the materials of the first step (as mentioned in the
-layout) and the products of the last step and returns a new link. This link
-reports the materials and products and summarizes the overall software supply
-chain.
-NOTE: The assumption is that the steps mentioned in the layout are to be
-performed sequentially. So, the first step mentioned in the layout denotes what
-comes into the supply chain and the last step denotes what goes out.
+SummaryStepsByProduct is the key of the by-product of a summary link, which
+lists a SummaryStep for each step of the layout, see GetSummaryLink.  The key
+is namespaced, so that it does not collide with the by-products of the exit
+step, which are copied to the summary link.
+*/
+const SummaryStepsByProduct = "in-toto/steps"
+
+/*
+SummaryStep records the command and the link digest of a step in the
+by-products of a summary link, so that the summary remains auditable.  The
+digest is computed over the canonical JSON representation of the link
+payload.
+*/
+type SummaryStep struct {
+	Name       string   `json:"name"`
+	Command    []string `json:"command"`
+	LinkDigest HashObj  `json:"link_digest"`
+}
+
+/*
+GetSummaryLink merges the materials of the entry steps and the products of the
+exit steps of the layout and returns a new link.  This link reports the
+materials and products and summarizes the overall software supply chain.  The
+entry and exit steps are configured in the Summary of the layout, see
+SummaryPolicy.  By default, the first step mentioned in the layout denotes what
+comes into the supply chain and the last step denotes what goes out.  It is an
+error, if the entry or exit steps report different hashes for the same
+artifact.
+
+The by-products of the summary link hold the by-products of the exit step, if
+there is only one, and list the command and link digest of every step with a
+link under SummaryStepsByProduct.  The command of the summary link is the
+command of the exit step, if there is only one.  Only the entry and exit steps
+must have a link.
+
+NOTE: Unlike earlier versions, the by-products of the summary link are a copy
+of those of the exit step, which always includes SummaryStepsByProduct.
+Consumers that compare the by-products of the summary link to those of the
+exit step must ignore that key.
 */
 func GetSummaryLink(layout Layout, stepsMetadataReduced map[string]Metadata,
 	stepName string, useDSSE bool) (Metadata, error) {
 	var summaryLink Link
 	if len(layout.Steps) > 0 {
-		firstStepLink := stepsMetadataReduced[layout.Steps[0].Name]
-		lastStepLink := stepsMetadataReduced[layout.Steps[len(layout.Steps)-1].Name]
+		entrySteps := []string{layout.Steps[0].Name}
+		exitSteps := []string{layout.Steps[len(layout.Steps)-1].Name}
+		if layout.Summary != nil && len(layout.Summary.EntrySteps) > 0 {
+			entrySteps = layout.Summary.EntrySteps
+		}
+		if layout.Summary != nil && len(layout.Summary.ExitSteps) > 0 {
+			exitSteps = layout.Summary.ExitSteps
+		}
 
-		firstStepPayloadLink, ok := firstStepLink.GetPayload().(Link)
-		if !ok {
-			return nil, fmt.Errorf("invalid metadata")
+		// Only the entry and exit steps need a link, the other steps are
+		// listed in the by-products, if they have one
+		for _, name := range append(append([]string{}, entrySteps...), exitSteps...) {
+			if _, ok := stepsMetadataReduced[name]; !ok {
+				return nil, fmt.Errorf("no link metadata found for step '%s'",
+					name)
+			}
+		}
+
+		links := make(map[string]Link, len(layout.Steps))
+		summarySteps := make([]SummaryStep, 0, len(layout.Steps))
+		for _, step := range layout.Steps {
+			linkEnv, ok := stepsMetadataReduced[step.Name]
+			if !ok {
+				continue
+			}
+			link, ok := linkEnv.GetPayload().(Link)
+			if !ok {
+				return nil, fmt.Errorf("invalid metadata")
+			}
+			links[step.Name] = link
+
+			digest, err := linkDigest(linkEnv)
+			if err != nil {
+				return nil, err
+			}
+			summarySteps = append(summarySteps, SummaryStep{
+				Name:       step.Name,
+				Command:    link.Command,
+				LinkDigest: digest,
+			})
+		}
+
+		var err error
+		summaryLink.Materials, err = mergeStepArtifacts(links, entrySteps,
+			"materials", func(link Link) map[string]HashObj { return link.Materials })
+		if err != nil {
+			return nil, err
+		}
+		summaryLink.Products, err = mergeStepArtifacts(links, exitSteps,
+			"products", func(link Link) map[string]HashObj { return link.Products })
+		if err != nil {
+			return nil, err
 		}
-		summaryLink.Materials = firstStepPayloadLink.Materials
 		summaryLink.Name = stepName
-		summaryLink.Type = firstStepPayloadLink.Type
+		summaryLink.Type = links[entrySteps[0]].Type
 
-		lastStepPayloadLink, ok := lastStepLink.GetPayload().(Link)
-		if !ok {
-			return nil, fmt.Errorf("invalid metadata")
+		summaryLink.ByProducts = map[string]interface{}{}
+		if len(exitSteps) == 1 {
+			exitLink := links[exitSteps[0]]
+			for k, v := range exitLink.ByProducts {
+				summaryLink.ByProducts[k] = v
+			}
+			summaryLink.Command = exitLink.Command
 		}
-		summaryLink.Products = lastStepPayloadLink.Products
-		summaryLink.ByProducts = lastStepPayloadLink.ByProducts
-		// Using the last command of the sublayout as the command
-		// of the summary link can be misleading. Is it necessary to
-		// include all the commands executed as part of sublayout?
-		summaryLink.Command = lastStepPayloadLink.Command
+		summaryLink.ByProducts[SummaryStepsByProduct] = summarySteps
 	}
 
 	if useDSSE {
@@ -772,6 +1595,33 @@ func GetSummaryLink(layout Layout, stepsMetadataReduced map[string]Metadata,
 	return &Metablock{Signed: summaryLink}, nil
 }
 
+/*
+mergeStepArtifacts returns the union of the artifacts of the passed steps,
+which are selected from their links by the passed function.  It returns an
+error, if two steps report different hashes for the same artifact.
+*/
+func mergeStepArtifacts(links map[string]Link, stepNames []string,
+	artifactType string, artifacts func(Link) map[string]HashObj) (map[string]HashObj, error) {
+	merged := make(map[string]HashObj)
+	mergedFrom := make(map[string]string)
+	for _, stepName := range stepNames {
+		link, ok := links[stepName]
+		if !ok {
+			return nil, fmt.Errorf("summary refers to unknown step '%s'", stepName)
+		}
+		for path, hashObj := range artifacts(link) {
+			if existing, ok := merged[path]; ok && !reflect.DeepEqual(existing, hashObj) {
+				return nil, fmt.Errorf("steps '%s' and '%s' report different"+
+					" hashes for %s '%s'", mergedFrom[path], stepName,
+					artifactType, path)
+			}
+			merged[path] = hashObj
+			mergedFrom[path] = stepName
+		}
+	}
+	return merged, nil
+}
+
 /*
 VerifySublayouts checks if any step in the supply chain is a sublayout, and if
 so, recursively resolves it and replaces it with a summary link summarizing the
@@ -780,20 +1630,73 @@ steps carried out in the sublayout.
 func VerifySublayouts(layout Layout,
 	stepsMetadataVerified map[string]map[string]Metadata,
 	superLayoutLinkPath string, intermediatePems [][]byte, lineNormalization bool) (map[string]map[string]Metadata, error) {
-	for stepName, linkData := range stepsMetadataVerified {
-		for keyID, metadata := range linkData {
+	v := &verification{Verifier: Verifier{
+		linkSource:        NewDirectoryLinkSource(superLayoutLinkPath),
+		intermediatePems:  intermediatePems,
+		lineNormalization: lineNormalization,
+	}}
+	return v.verifySublayouts(context.Background(), layout,
+		stepsMetadataVerified)
+}
+
+func (v *verification) verifySublayouts(ctx context.Context, layout Layout,
+	stepsMetadataVerified map[string]map[string]Metadata) (map[string]map[string]Metadata, error) {
+	for _, step := range layout.Steps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if v.hasFailed(step.Name) {
+			continue
+		}
+		linkData := stepsMetadataVerified[step.Name]
+		for _, keyID := range sortedKeyIDs(linkData) {
+			metadata := linkData[keyID]
 			if _, ok := metadata.GetPayload().(Layout); ok {
-				layoutKeys := make(map[string]Key)
-				layoutKeys[keyID] = layout.Keys[keyID]
-
-				sublayoutLinkDir := fmt.Sprintf(SublayoutLinkDirFormat,
-					stepName, keyID)
-				sublayoutLinkPath := filepath.Join(superLayoutLinkPath,
-					sublayoutLinkDir)
-				summaryLink, err := InTotoVerify(metadata, layoutKeys,
-					sublayoutLinkPath, stepName, make(map[string]string), intermediatePems, lineNormalization)
+				// Record the sublayout verification in a nested report
+				// The sublayout is verified with the configuration of the
+				// superlayout, but with the parameters configured for the
+				// sublayout, and inspections are run in the current working
+				// directory
+				sub := &verification{Verifier: v.Verifier}
+				sub.runDir = ""
+				sub.sublayoutPath = path.Join(v.sublayoutPath, step.Name)
+				sub.parameters = v.sublayoutParameters[sub.sublayoutPath]
+				sub.summaryLinkName = step.Name
+				if itemReport := v.report.item(step); itemReport != nil {
+					sub.report = newVerificationReport()
+					if itemReport.Sublayouts == nil {
+						itemReport.Sublayouts = make(map[string]*VerificationReport)
+					}
+					itemReport.Sublayouts[keyID] = sub.report
+				}
+
+				var summaryLink Metadata
+				var layoutKey Key
+				err := v.checkSublayoutDepth(sub.sublayoutPath)
+				if err == nil {
+					layoutKey, err = sublayoutKey(layout, keyID, metadata)
+				}
+				if err == nil {
+					sub.linkSource, err = v.sublayoutLinkSource(sub.sublayoutPath,
+						step.Name, keyID)
+				}
+				if err == nil {
+					summaryLink, err = sub.verify(ctx, metadata,
+						map[string]Key{keyID: layoutKey})
+				}
+				sub.report.finish(summaryLink, err)
+				if sub.report != nil {
+					if link := v.report.Evidence.link(step.Name, keyID); link != nil {
+						link.Sublayout = sub.report.Evidence
+					}
+				}
 				if err != nil {
-					return nil, err
+					v.report.item(step).recordResult(err)
+					if err := v.itemFailed(PhaseSublayouts, step.Name, err); err != nil {
+						return nil, err
+					}
+					delete(stepsMetadataVerified, step.Name)
+					break
 				}
 				linkData[keyID] = summaryLink
 			}
@@ -803,79 +1706,124 @@ func VerifySublayouts(layout Layout,
 	return stepsMetadataVerified, nil
 }
 
-// TODO: find a better way than two helper functions for the replacer op
+/*
+checkSublayoutDepth returns an error, if the sublayout with the passed path
+exceeds the maximum sublayout depth, see WithMaxSublayoutDepth.
+*/
+func (v *verification) checkSublayoutDepth(sublayoutPath string) error {
+	maxDepth := v.maxSublayoutDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxSublayoutDepth
+	}
+	if depth := strings.Count(sublayoutPath, "/") + 1; depth > maxDepth {
+		return fmt.Errorf("%w: sublayout '%s' is nested %d levels deep, the"+
+			" maximum is %d", ErrSublayoutDepthExceeded, sublayoutPath, depth,
+			maxDepth)
+	}
+	return nil
+}
 
-func substituteParamatersInSlice(replacer *strings.Replacer, slice []string) []string {
-	newSlice := make([]string, 0)
-	for _, item := range slice {
-		newSlice = append(newSlice, replacer.Replace(item))
+/*
+sublayoutLinkSource returns the source for the links of the sublayout with the
+passed path, i.e. the source configured with WithSublayoutLinkSource, or the
+source provided by the link source of the superlayout for the passed step and
+signer key id.
+*/
+func (v *verification) sublayoutLinkSource(sublayoutPath string,
+	stepName string, keyID string) (LinkSource, error) {
+	if source, ok := v.sublayoutLinkSources[sublayoutPath]; ok {
+		return source, nil
 	}
-	return newSlice
+	return v.linkSource.Sublayout(stepName, keyID)
 }
 
-func substituteParametersInSliceOfSlices(replacer *strings.Replacer,
-	slice [][]string) [][]string {
-	newSlice := make([][]string, 0)
-	for _, item := range slice {
-		newSlice = append(newSlice, substituteParamatersInSlice(replacer,
-			item))
+/*
+sublayoutKey returns the key, which is used to verify the signature of the
+passed sublayout signed by the passed key id.  This is either a key of the
+passed superlayout or, for functionaries authorized by the certificate
+constraints of the step, the certificate the sublayout was signed with.  The
+certificate was already verified against the root CAs of the superlayout,
+when the signature thresholds of the step were verified.
+*/
+func sublayoutKey(layout Layout, keyID string, sublayoutEnv Metadata) (Key, error) {
+	if key, ok := layout.Keys[keyID]; ok {
+		return key, nil
 	}
-	return newSlice
+	sig, err := sublayoutEnv.GetSignatureForKeyID(keyID)
+	if err != nil {
+		return Key{}, err
+	}
+	return sig.GetCertificate()
 }
 
+// TODO: find a better way than two helper functions for the replacer op
+
 /*
-SubstituteParameters performs parameter substitution in steps and inspections
-in the following fields:
+SubstituteParameters performs parameter substitution in the following fields
+of steps and inspections:
 - Expected Materials and Expected Products of both
 - Run of inspections
-- Expected Command of steps
+- Expected Command, PubKeys and Certificate Constraints of steps
 The substitution marker is '{}' and the keyword within the braces is replaced
-by a value found in the substitution map passed, parameterDictionary. The
-layout with parameters substituted is returned to the calling function.
+by a value found in the substitution map passed, parameterDictionary, or by
+the default of the parameter, if the layout declares it in its Parameters.
+The threshold of a step with a ThresholdParameter is set to the value of that
+parameter, which must be declared as integer parameter in the layout's
+Parameters.  An error is returned if a required parameter is missing, a value
+does not have the declared type, a placeholder remains after substitution, or
+the layout with parameters substituted is invalid, e.g. because a parameter
+value yields a malformed artifact rule.  Placeholders preceded by '$', e.g.
+shell variables in the Run field of inspections, are neither substituted nor
+considered.  The layout with parameters substituted is returned to the calling
+function, the passed layout is not modified.
 */
 func SubstituteParameters(layout Layout,
 	parameterDictionary map[string]string) (Layout, error) {
 
-	if len(parameterDictionary) == 0 {
-		return layout, nil
+	if err := validateParameterDeclarations(layout); err != nil {
+		return layout, err
+	}
+	parameters, err := resolveParameters(layout, parameterDictionary)
+	if err != nil {
+		return layout, err
 	}
 
-	parameters := make([]string, 0)
-
-	re := regexp.MustCompile("^[a-zA-Z0-9_-]+$")
-
-	for parameter, value := range parameterDictionary {
-		parameterFormatCheck := re.MatchString(parameter)
-		if !parameterFormatCheck {
-			return layout, fmt.Errorf("invalid format for parameter")
+	steps := append([]Step{}, layout.Steps...)
+	for i := range steps {
+		if err := substituteParametersInStep(parameters, &steps[i]); err != nil {
+			return layout, err
 		}
-
-		parameters = append(parameters, "{"+parameter+"}")
-		parameters = append(parameters, value)
 	}
 
-	replacer := strings.NewReplacer(parameters...)
-
-	for i := range layout.Steps {
-		layout.Steps[i].ExpectedMaterials = substituteParametersInSliceOfSlices(
-			replacer, layout.Steps[i].ExpectedMaterials)
-		layout.Steps[i].ExpectedProducts = substituteParametersInSliceOfSlices(
-			replacer, layout.Steps[i].ExpectedProducts)
-		layout.Steps[i].ExpectedCommand = substituteParamatersInSlice(replacer,
-			layout.Steps[i].ExpectedCommand)
+	inspections := append([]Inspection{}, layout.Inspect...)
+	for i := range inspections {
+		location := fmt.Sprintf("inspection '%s'", inspections[i].Name)
+		if inspections[i].ExpectedMaterials, err = substituteParametersInRules(
+			parameters, inspections[i].ExpectedMaterials, location); err != nil {
+			return layout, err
+		}
+		if inspections[i].ExpectedProducts, err = substituteParametersInRules(
+			parameters, inspections[i].ExpectedProducts, location); err != nil {
+			return layout, err
+		}
+		if inspections[i].Run, err = substituteParametersInSlice(parameters,
+			inspections[i].Run, location); err != nil {
+			return layout, err
+		}
 	}
 
-	for i := range layout.Inspect {
-		layout.Inspect[i].ExpectedMaterials =
-			substituteParametersInSliceOfSlices(replacer,
-				layout.Inspect[i].ExpectedMaterials)
-		layout.Inspect[i].ExpectedProducts =
-			substituteParametersInSliceOfSlices(replacer,
-				layout.Inspect[i].ExpectedProducts)
-		layout.Inspect[i].Run = substituteParamatersInSlice(replacer,
-			layout.Inspect[i].Run)
+	original := layout
+	if layout.Steps != nil {
+		layout.Steps = steps
+	}
+	if layout.Inspect != nil {
+		layout.Inspect = inspections
+	}
+	// Parameter values may yield invalid rules, patterns or key ids
+	if err := validateLayout(layout); err != nil {
+		return original, fmt.Errorf("invalid layout after parameter"+
+			" substitution: %w", err)
 	}
-
 	return layout, nil
 }
 
@@ -887,7 +1835,8 @@ directory from where it can load link metadata files, which are treated as
 signed evidence for the steps defined in the layout, a step name, and a
 paramater dictionary used for parameter substitution. The step name only
 matters for sublayouts, where it's important to associate the summary of that
-step with a unique name. The verification routine is as follows:
+step with a unique name. Links can also be loaded from other sources, e.g.
+archives, see WithLinkSource. The verification routine is as follows:
 
 1. Verify layout signature(s) using passed key(s)
 2. Verify layout expiration date
@@ -903,243 +1852,291 @@ step with a unique name. The verification routine is as follows:
 InTotoVerify returns a summary link wrapped in a Metablock object and an error
 value. If any of the verification routines fail, verification is aborted and
 error is returned. In such an instance, the first value remains an empty
-Metablock object.
+Metablock object. Verification can be configured to continue after a step or
+inspection failed, see WithCollectAllFailures.
+
+InTotoVerify is a wrapper around Verifier, which can be configured further
+using the passed options, see NewVerifier.
 
 NOTE: Artifact rules of type "create", "modify"
 and "delete" are currently not supported.
 */
 func InTotoVerify(layoutEnv Metadata, layoutKeys map[string]Key,
-	linkDir string, stepName string, parameterDictionary map[string]string, intermediatePems [][]byte, lineNormalization bool) (
-	Metadata, error) {
-
-	// Verify root signatures
-	if err := VerifyLayoutSignatures(layoutEnv, layoutKeys); err != nil {
-		return nil, err
-	}
-
-	useDSSE := false
-	if _, ok := layoutEnv.(*Envelope); ok {
-		useDSSE = true
-	}
-
-	// Extract the layout from its Metadata container (for further processing)
-	layout, ok := layoutEnv.GetPayload().(Layout)
-	if !ok {
-		return nil, ErrNotLayout
-	}
-
-	// Verify layout expiration
-	if err := VerifyLayoutExpiration(layout); err != nil {
-		return nil, err
-	}
-
-	// Substitute parameters in layout
-	layout, err := SubstituteParameters(layout, parameterDictionary)
-	if err != nil {
-		return nil, err
-	}
-
-	rootCertPool, intermediateCertPool, err := LoadLayoutCertificates(layout, intermediatePems)
-	if err != nil {
-		return nil, err
-	}
-
-	// Load links for layout
-	stepsMetadata, err := LoadLinksForLayout(layout, linkDir)
+	linkDir string, stepName string, parameterDictionary map[string]string, intermediatePems [][]byte, lineNormalization bool,
+	opts ...VerifyOption) (Metadata, error) {
+	report, err := InTotoVerifyWithReport(layoutEnv, layoutKeys, linkDir,
+		stepName, parameterDictionary, intermediatePems, lineNormalization,
+		opts...)
 	if err != nil {
 		return nil, err
 	}
+	return report.SummaryLink, nil
+}
 
-	// Verify link signatures
-	stepsMetadataVerified, err := VerifyLinkSignatureThesholds(layout,
-		stepsMetadata, rootCertPool, intermediateCertPool)
-	if err != nil {
-		return nil, err
-	}
+/*
+InTotoVerifyWithReport provides the same functionality as InTotoVerify, but
+returns a VerificationReport, which records the outcome of each verification
+phase, the links that were accepted or rejected for each step, and the
+artifact rule that failed, if any.  The summary link is available in the
+SummaryLink field of the report.  The report is returned regardless of whether
+verification passes or fails.
+*/
+func InTotoVerifyWithReport(layoutEnv Metadata, layoutKeys map[string]Key,
+	linkDir string, stepName string, parameterDictionary map[string]string, intermediatePems [][]byte, lineNormalization bool,
+	opts ...VerifyOption) (*VerificationReport, error) {
+	return NewVerifier(legacyVerifyOptions(linkDir, "", stepName,
+		parameterDictionary, intermediatePems, lineNormalization, opts)...).Verify(
+		context.Background(), layoutEnv, layoutKeys)
+}
 
-	// Verify and resolve sublayouts
-	stepsSublayoutVerified, err := VerifySublayouts(layout,
-		stepsMetadataVerified, linkDir, intermediatePems, lineNormalization)
+/*
+InTotoVerifyWithDirectory provides the same functionality as InTotoVerify, but
+adds the possibility to select a local directory from where the inspections are run.
+Pass WithScratchRunDir to run the inspections in a copy of that directory.
+*/
+func InTotoVerifyWithDirectory(layoutEnv Metadata, layoutKeys map[string]Key,
+	linkDir string, runDir string, stepName string, parameterDictionary map[string]string, intermediatePems [][]byte, lineNormalization bool,
+	opts ...VerifyOption) (Metadata, error) {
+	// Verifier treats an empty runDir as the current working directory, here
+	// the run directory is mandatory
+	if runDir == "" {
+		return nil, checkRunDir(runDir)
+	}
+	report, err := NewVerifier(legacyVerifyOptions(linkDir, runDir, stepName,
+		parameterDictionary, intermediatePems, lineNormalization, opts)...).Verify(
+		context.Background(), layoutEnv, layoutKeys)
 	if err != nil {
 		return nil, err
 	}
+	return report.SummaryLink, nil
+}
 
-	// Verify command alignment (WARNING only)
-	VerifyStepCommandAlignment(layout, stepsSublayoutVerified)
+/*
+verification holds the state of a single run of the verification workflow
+performed by the embedded Verifier.  If report is nil, the workflow is
+performed without recording a report.
+*/
+type verification struct {
+	Verifier
+	report   *VerificationReport
+	failures []error
+	// steps and inspections that failed, if all failures are collected
+	failedItems Set
+	// origin per step name and key id of the loaded links, see LinkEvidence
+	linkOrigins map[string]map[string]LinkOrigin
+	// path of the verified (sub)layout, i.e. the names of the steps that
+	// resolved to sublayouts joined by "/", see WithSublayoutParameters
+	sublayoutPath string
+	// dialect of the artifact rule patterns of the verified (sub)layout
+	patternDialect PatternDialect
+	// hash policy for MATCH rules of the verified (sub)layout
+	hashPolicy *HashPolicy
+	// functionary identity per step name and key id of the links that passed
+	// the signature thresholds, see functionaryIdentities
+	identities map[string]map[string]string
+	// number of failures already recorded for a phase, see finishPhase
+	reportedFailures int
+}
 
-	// Given that signature thresholds have been checked above and the rest of
-	// the relevant link properties, i.e. materials and products, have to be
-	// exactly equal, we can reduce the map of steps metadata. However, we error
-	// if the relevant properties are not equal among links of a step.
-	stepsMetadataReduced, err := ReduceStepsMetadata(layout,
-		stepsSublayoutVerified)
-	if err != nil {
-		return nil, err
+/*
+currentTime returns the current time according to the clock of the Verifier.
+*/
+func (v *verification) currentTime() time.Time {
+	if v.now == nil {
+		return time.Now()
 	}
+	return v.now()
+}
 
-	// Verify artifact rules
-	if err = VerifyArtifacts(layout.stepsAsInterfaceSlice(),
-		stepsMetadataReduced); err != nil {
-		return nil, err
+/*
+log returns the logger of the Verifier, or slog.Default, if no logger is
+configured.
+*/
+func (v *verification) log() *slog.Logger {
+	if v.logger == nil {
+		return slog.Default()
 	}
+	return v.logger
+}
 
-	inspectionMetadata, err := RunInspections(layout, "", lineNormalization, useDSSE)
-	if err != nil {
-		return nil, err
+/*
+itemFailed handles an error that caused the passed step or inspection to fail
+during the passed phase.  If all failures are collected, the failure is
+recorded and nil is returned, so that the caller can continue with the next
+item.  Otherwise err is returned unchanged.
+*/
+func (v *verification) itemFailed(phase VerificationPhase, itemName string,
+	err error) error {
+	if !v.collectAllFailures {
+		return err
 	}
-
-	// Add steps metadata to inspection metadata, because inspection artifact
-	// rules may also refer to artifacts reported by step links
-	for k, v := range stepsMetadataReduced {
-		inspectionMetadata[k] = v
+	v.failures = append(v.failures, &VerificationFailure{
+		Phase: phase,
+		Item:  itemName,
+		Err:   err,
+	})
+	if v.failedItems == nil {
+		v.failedItems = NewSet()
 	}
+	v.failedItems.Add(itemName)
+	return nil
+}
 
-	if err = VerifyArtifacts(layout.inspectAsInterfaceSlice(),
-		inspectionMetadata); err != nil {
-		return nil, err
-	}
+// hasFailed returns true if the passed step or inspection failed earlier.
+func (v *verification) hasFailed(itemName string) bool {
+	return v.failedItems.Has(itemName)
+}
 
-	summaryLink, err := GetSummaryLink(layout, stepsMetadataReduced, stepName, useDSSE)
-	if err != nil {
-		return nil, err
+/*
+finishPhase records the outcome of the passed phase in the report, taking into
+account the failures collected since the last call, and returns err.
+*/
+func (v *verification) finishPhase(phase VerificationPhase, err error) error {
+	phaseErr := err
+	if phaseErr == nil && len(v.failures) > v.reportedFailures {
+		phaseErr = &VerificationErrors{
+			Errors: append([]error{}, v.failures[v.reportedFailures:]...),
+		}
 	}
-
-	return summaryLink, nil
+	v.reportedFailures = len(v.failures)
+	v.report.recordPhase(phase, phaseErr)
+	return err
 }
 
 /*
-InTotoVerifyWithDirectory provides the same functionality as InTotoVerify, but
-adds the possibility to select a local directory from where the inspections are run.
+verify performs the verification workflow described in InTotoVerify as
+configured by the Verifier, and records the outcome of each phase in the
+report of the verification.
 */
-func InTotoVerifyWithDirectory(layoutEnv Metadata, layoutKeys map[string]Key,
-	linkDir string, runDir string, stepName string, parameterDictionary map[string]string, intermediatePems [][]byte, lineNormalization bool) (
-	Metadata, error) {
-
-	// runDir sanity checks
-	// check if path exists
-	info, err := os.Stat(runDir)
-	if err != nil {
+func (v *verification) verify(ctx context.Context, layoutEnv Metadata,
+	layoutKeys map[string]Key) (Metadata, error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-
-	// check if runDir is a symlink
-	if info.Mode()&os.ModeSymlink == os.ModeSymlink {
-		return nil, ErrInspectionRunDirIsSymlink
+	if v.linkSource == nil {
+		v.linkSource = NewDirectoryLinkSource("")
 	}
 
-	// check if runDir is writable and a directory
-	err = isWritable(runDir)
-	if err != nil {
-		return nil, err
-	}
-
-	// check if runDir is empty (we do not want to overwrite files)
-	// We abuse File.Readdirnames for this action.
-	f, err := os.Open(runDir)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	// We use Readdirnames(1) for performance reasons, one child node
-	// is enough to proof that the directory is not empty
-	_, err = f.Readdirnames(1)
-	// if io.EOF gets returned as error the directory is empty
-	if err == io.EOF {
-		return nil, err
+	// Verify root signatures and extract the layout from its Metadata
+	// container (for further processing)
+	err := VerifyLayoutSignatures(layoutEnv, layoutKeys)
+	layout, ok := layoutEnv.GetPayload().(Layout)
+	if err == nil && !ok {
+		err = ErrNotLayout
 	}
-	err = f.Close()
+	v.report.recordPhase(PhaseLayoutSignatures, err)
 	if err != nil {
 		return nil, err
 	}
 
-	// Verify root signatures
-	if err := VerifyLayoutSignatures(layoutEnv, layoutKeys); err != nil {
-		return nil, err
-	}
-
 	useDSSE := false
 	if _, ok := layoutEnv.(*Envelope); ok {
 		useDSSE = true
 	}
 
-	// Extract the layout from its Metadata container (for further processing)
-	layout, ok := layoutEnv.GetPayload().(Layout)
-	if !ok {
-		return nil, ErrNotLayout
-	}
-
 	// Verify layout expiration
-	if err := VerifyLayoutExpiration(layout); err != nil {
+	err = VerifyLayoutExpirationAt(layout, v.currentTime())
+	v.report.recordPhase(PhaseLayoutExpiration, err)
+	if err != nil {
 		return nil, err
 	}
 
 	// Substitute parameters in layout
-	layout, err = SubstituteParameters(layout, parameterDictionary)
+	layout, err = SubstituteParameters(layout, v.parameters)
+	v.report.recordPhase(PhaseParameterSubstitution, err)
 	if err != nil {
 		return nil, err
 	}
+	v.patternDialect = layout.PatternDialect
+	v.hashPolicy = layout.HashPolicy
 
-	rootCertPool, intermediateCertPool, err := LoadLayoutCertificates(layout, intermediatePems)
-	if err != nil {
+	// Load links for layout
+	stepsMetadata, err := v.loadLinksForLayout(ctx, layout, v.linkSource)
+	if err := v.finishPhase(PhaseLinkLoading, err); err != nil {
 		return nil, err
 	}
 
-	// Load links for layout
-	stepsMetadata, err := LoadLinksForLayout(layout, linkDir)
+	rootCertPool, intermediateCertPool, err := LoadLayoutCertificates(layout, v.intermediatePems)
 	if err != nil {
-		return nil, err
+		return nil, v.finishPhase(PhaseThresholds, err)
 	}
 
 	// Verify link signatures
-	stepsMetadataVerified, err := VerifyLinkSignatureThesholds(layout,
+	stepsMetadataVerified, err := v.verifyLinkSignatureThresholds(ctx, layout,
 		stepsMetadata, rootCertPool, intermediateCertPool)
-	if err != nil {
+	if err := v.finishPhase(PhaseThresholds, err); err != nil {
 		return nil, err
 	}
+	v.recordLinkEvidence(layout, stepsMetadataVerified, rootCertPool,
+		intermediateCertPool, v.currentTime())
 
 	// Verify and resolve sublayouts
-	stepsSublayoutVerified, err := VerifySublayouts(layout,
-		stepsMetadataVerified, linkDir, intermediatePems, lineNormalization)
-	if err != nil {
+	stepsSublayoutVerified, err := v.verifySublayouts(ctx, layout,
+		stepsMetadataVerified)
+	if err := v.finishPhase(PhaseSublayouts, err); err != nil {
 		return nil, err
 	}
 
-	// Verify command alignment (WARNING only)
-	VerifyStepCommandAlignment(layout, stepsSublayoutVerified)
+	// Verify command alignment (WARNING only, unless enforced)
+	err = v.verifyStepCommandAlignment(layout, stepsSublayoutVerified)
+	if err := v.finishPhase(PhaseCommandAlignment, err); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	// Given that signature thresholds have been checked above and the rest of
 	// the relevant link properties, i.e. materials and products, have to be
 	// exactly equal, we can reduce the map of steps metadata. However, we error
 	// if the relevant properties are not equal among links of a step.
-	stepsMetadataReduced, err := ReduceStepsMetadata(layout,
+	stepsMetadataReduced, err := v.reduceStepsMetadata(layout,
 		stepsSublayoutVerified)
 	if err != nil {
-		return nil, err
+		return nil, v.finishPhase(PhaseArtifactRules, err)
 	}
 
 	// Verify artifact rules
-	if err = VerifyArtifacts(layout.stepsAsInterfaceSlice(),
-		stepsMetadataReduced); err != nil {
+	err = v.verifyArtifacts(layout.stepsAsInterfaceSlice(), stepsMetadataReduced)
+	if err := v.finishPhase(PhaseArtifactRules, err); err != nil {
 		return nil, err
 	}
 
-	inspectionMetadata, err := RunInspections(layout, runDir, lineNormalization, useDSSE)
-	if err != nil {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	// Add steps metadata to inspection metadata, because inspection artifact
-	// rules may also refer to artifacts reported by step links
-	for k, v := range stepsMetadataReduced {
-		inspectionMetadata[k] = v
+	if v.dryRun {
+		// Report the inspections that would have been run, instead of running
+		// them, and leave the inspections phase as skipped
+		v.report.recordPlannedInspections(layout.Inspect)
+	} else {
+		inspectionMetadata, err := v.runInspections(ctx, layout, useDSSE)
+		if err != nil {
+			return nil, v.finishPhase(PhaseInspections, err)
+		}
+
+		// Add steps metadata to inspection metadata, because inspection artifact
+		// rules may also refer to artifacts reported by step links
+		for k, linkEnv := range stepsMetadataReduced {
+			inspectionMetadata[k] = linkEnv
+		}
+
+		err = v.verifyArtifacts(layout.inspectAsInterfaceSlice(), inspectionMetadata)
+		if err := v.finishPhase(PhaseInspections, err); err != nil {
+			return nil, err
+		}
 	}
 
-	if err = VerifyArtifacts(layout.inspectAsInterfaceSlice(),
-		inspectionMetadata); err != nil {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	if len(v.failures) > 0 {
+		return nil, &VerificationErrors{Errors: v.failures}
+	}
 
-	summaryLink, err := GetSummaryLink(layout, stepsMetadataReduced, stepName, useDSSE)
+	summaryLink, err := GetSummaryLink(layout, stepsMetadataReduced, v.summaryLinkName, useDSSE)
 	if err != nil {
 		return nil, err
 	}
@@ -2,9 +2,15 @@ package in_toto
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -156,12 +162,75 @@ func TestGetSummaryLink(t *testing.T) {
 			"returned '%s", packagePayloadLink.Command,
 			summaryPayloadLink.Command)
 	}
+	summarySteps := summaryPayloadLink.ByProducts[SummaryStepsByProduct]
+	delete(summaryPayloadLink.ByProducts, SummaryStepsByProduct)
 	if !reflect.DeepEqual(summaryPayloadLink.ByProducts,
 		packagePayloadLink.ByProducts) {
 		t.Errorf("summary Link by-products don't match. Expected '%s', "+
 			"returned '%s", packagePayloadLink.ByProducts,
 			summaryPayloadLink.ByProducts)
 	}
+	if assert.IsType(t, []SummaryStep{}, summarySteps) {
+		steps := summarySteps.([]SummaryStep)
+		assert.Len(t, steps, 2)
+		assert.Equal(t, "package", steps[1].Name)
+		assert.Equal(t, packagePayloadLink.Command, steps[1].Command)
+		assert.Len(t, steps[1].LinkDigest["sha256"], 64)
+	}
+
+	// A by-product of the exit step named "steps" is kept
+	exitLink := packagePayloadLink
+	exitLink.ByProducts = map[string]interface{}{"steps": "exit step"}
+	summaryLink, err = GetSummaryLink(demoPayloadLayout, map[string]Metadata{
+		"write-code": codeLink,
+		"package":    &Metablock{Signed: exitLink},
+	}, "demo", false)
+	if assert.Nil(t, err) {
+		byProducts := summaryLink.GetPayload().(Link).ByProducts
+		assert.Equal(t, "exit step", byProducts["steps"])
+		assert.IsType(t, []SummaryStep{}, byProducts[SummaryStepsByProduct])
+	}
+
+	// Only the first and last step need a link by default
+	threeStepLayout := demoPayloadLayout
+	threeStepLayout.Steps = []Step{demoPayloadLayout.Steps[0],
+		{SupplyChainItem: SupplyChainItem{Name: "test"}},
+		demoPayloadLayout.Steps[1]}
+	summaryLink, err = GetSummaryLink(threeStepLayout, demoLink, "demo", false)
+	if assert.Nil(t, err) {
+		summaryPayloadLink = summaryLink.GetPayload().(Link)
+		assert.Equal(t, codePayloadLink.Materials, summaryPayloadLink.Materials)
+		assert.Equal(t, packagePayloadLink.Products, summaryPayloadLink.Products)
+		assert.Equal(t, packagePayloadLink.Command, summaryPayloadLink.Command)
+		assert.Len(t, summaryPayloadLink.ByProducts[SummaryStepsByProduct], 2)
+	}
+	_, err = GetSummaryLink(threeStepLayout, map[string]Metadata{
+		"write-code": codeLink}, "demo", false)
+	assert.EqualError(t, err, "no link metadata found for step 'package'")
+
+	// Entry and exit steps configured in the layout
+	demoPayloadLayout.Summary = &SummaryPolicy{
+		EntrySteps: []string{"write-code", "package"},
+		ExitSteps:  []string{"write-code", "package"},
+	}
+	summaryLink, err = GetSummaryLink(demoPayloadLayout, demoLink, "demo", false)
+	if assert.Nil(t, err) {
+		summaryPayloadLink = summaryLink.GetPayload().(Link)
+		assert.Equal(t, packagePayloadLink.Materials, summaryPayloadLink.Materials)
+		assert.Contains(t, summaryPayloadLink.Products, "foo.tar.gz")
+		assert.Contains(t, summaryPayloadLink.Products, "foo.py")
+		assert.Nil(t, summaryPayloadLink.Command)
+		assert.Len(t, summaryPayloadLink.ByProducts, 1)
+	}
+
+	// Exit steps, which report different hashes for the same artifact
+	packagePayloadLink.Products = map[string]HashObj{
+		"foo.py": {"sha256": "deadbeef"},
+	}
+	demoLink["package"] = &Metablock{Signed: packagePayloadLink}
+	_, err = GetSummaryLink(demoPayloadLayout, demoLink, "demo", false)
+	assert.EqualError(t, err, "steps 'write-code' and 'package' report"+
+		" different hashes for products 'foo.py'")
 }
 
 func TestVerifySublayouts(t *testing.T) {
@@ -228,6 +297,67 @@ func TestVerifySublayouts(t *testing.T) {
 			}
 		}
 	}
+
+	// The evidence of the sublayout is attached to its link
+	stepsMetadataVerified, err = VerifyLinkSignatureThesholds(
+		superMbPayloadLayout, stepsMetadata, rootCertPool, intermediateCertPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &verification{
+		Verifier: *NewVerifier(WithLinkSource(NewDirectoryLinkSource(".")),
+			WithLineNormalization(testOSisWindows())),
+		report: newVerificationReport(),
+	}
+	// Load the links through the verification to record their origins
+	if _, err := v.loadLinksForLayout(context.Background(), superMbPayloadLayout,
+		v.linkSource); err != nil {
+		t.Fatal(err)
+	}
+	v.recordLinkEvidence(superMbPayloadLayout, stepsMetadataVerified,
+		rootCertPool, intermediateCertPool, time.Now())
+	_, err = v.verifySublayouts(context.Background(), superMbPayloadLayout,
+		stepsMetadataVerified)
+	assert.Nil(t, err)
+	link := v.report.Evidence.link(sublayoutName, aliceKey.KeyID)
+	if assert.NotNil(t, link) && assert.NotNil(t, link.Sublayout) {
+		assert.Equal(t, sublayoutDirectory+".link", link.Path)
+		if assert.Len(t, link.Sublayout.Items, 3) &&
+			assert.Len(t, link.Sublayout.Items[1].Links, 1) {
+			assert.Equal(t, packagePath, link.Sublayout.Items[1].Links[0].Path)
+		}
+	}
+}
+
+func TestSublayoutKey(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("example.com.write-code.key.pem"); err != nil {
+		t.Fatal(err)
+	}
+	certPem, err := os.ReadFile("example.com.write-code.cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.KeyVal.Certificate = string(certPem)
+	sublayoutMb := &Metablock{Signed: Layout{Type: "layout"}}
+	if err := sublayoutMb.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+
+	// A functionary authorized by certificate signs with its certificate
+	certKey, err := sublayoutKey(Layout{}, key.KeyID, sublayoutMb)
+	assert.Nil(t, err)
+	assert.Equal(t, string(certPem), certKey.KeyVal.Certificate)
+	assert.Nil(t, VerifyLayoutSignatures(sublayoutMb, map[string]Key{key.KeyID: certKey}))
+
+	// Keys of the superlayout take precedence
+	layout := Layout{Keys: map[string]Key{key.KeyID: {KeyID: key.KeyID}}}
+	layoutKey, err := sublayoutKey(layout, key.KeyID, sublayoutMb)
+	assert.Nil(t, err)
+	assert.Equal(t, Key{KeyID: key.KeyID}, layoutKey)
+
+	_, err = sublayoutKey(Layout{}, "deadbeef", sublayoutMb)
+	assert.NotNil(t, err)
 }
 
 func TestRunInspections(t *testing.T) {
@@ -603,66 +733,112 @@ func TestVerifyArtifact(t *testing.T) {
 	}
 }
 
+func TestVerifyArtifactsRuleTracer(t *testing.T) {
+	step := Step{SupplyChainItem: SupplyChainItem{Name: "foo",
+		ExpectedMaterials: [][]string{
+			{"ALLOW", "*.py"},
+			{"DISALLOW", "*"},
+		}}}
+	metadata := map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo",
+		Materials: map[string]HashObj{
+			"foo.py":  {"sha256": "abc"},
+			"bar.py":  {"sha256": "abc"},
+			"foo.txt": {"sha256": "abc"},
+		}}}}
+
+	var traces []RuleTrace
+	v := &verification{Verifier: *NewVerifier(WithRuleTracer(func(trace RuleTrace) {
+		traces = append(traces, trace)
+	}))}
+	err := v.verifyArtifacts([]interface{}{step}, metadata)
+	var ruleErr *ArtifactRuleError
+	assert.True(t, errors.As(err, &ruleErr))
+
+	if assert.Len(t, traces, 2) {
+		assert.Equal(t, RuleTrace{
+			ItemType:     "Step",
+			Item:         "foo",
+			ArtifactType: "materials",
+			Rule:         []string{"ALLOW", "*.py"},
+			Queue:        []string{"bar.py", "foo.py", "foo.txt"},
+			Filtered:     []string{"bar.py", "foo.py"},
+			Consumed:     []string{"bar.py", "foo.py"},
+			Remaining:    []string{"foo.txt"},
+		}, traces[0])
+		assert.Equal(t, []string{"foo.txt"}, traces[1].Filtered)
+		assert.Empty(t, traces[1].Consumed)
+		assert.Equal(t, ruleErr, traces[1].Err)
+	}
+
+	// Traces of sublayout items carry the path of the sublayout
+	traces = nil
+	v.sublayoutPath = "sub/layout"
+	_ = v.verifyArtifacts([]interface{}{step}, metadata)
+	if assert.Len(t, traces, 2) {
+		assert.Equal(t, "sub/layout", traces[0].Sublayout)
+	}
+}
+
 func TestVerifyMatchRule(t *testing.T) {
 	var testCases = []struct {
 		name        string
-		rule        map[string]string
+		rule        MatchRule
 		srcArtifact map[string]HashObj
 		item        map[string]Metadata
 		expectSet   Set
 	}{
 		{
 			name:        "Can't find destination link (invalid rule)",
-			rule:        map[string]string{},
+			rule:        MatchRule{},
 			srcArtifact: map[string]HashObj{},
 			item:        map[string]Metadata{},
 			expectSet:   NewSet(),
 		},
 		{
 			name:        "Can't find destination link (empty metadata map)",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials"},
+			rule:        MatchRule{Pattern: "*", DestinationType: "materials", DestinationName: "foo"},
 			srcArtifact: map[string]HashObj{"foo.py": {"sha265": "abc"}},
 			item:        map[string]Metadata{},
 			expectSet:   NewSet(),
 		},
 		{
 			name:        "Match material foo.py",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials"},
+			rule:        MatchRule{Pattern: "*", DestinationType: "materials", DestinationName: "foo"},
 			srcArtifact: map[string]HashObj{"foo.py": {"sha265": "abc"}},
 			item:        map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo", Materials: map[string]HashObj{"foo.py": {"sha265": "abc"}}}}},
 			expectSet:   NewSet("foo.py"),
 		},
 		{
 			name:        "Match material foo.py with foo.d/foo.py",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials", "dstPrefix": "foo.d"},
+			rule:        MatchRule{Pattern: "*", DestinationType: "materials", DestinationPrefix: "foo.d", DestinationName: "foo"},
 			srcArtifact: map[string]HashObj{"foo.py": {"sha265": "abc"}},
 			item:        map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo", Materials: map[string]HashObj{"foo.d/foo.py": HashObj{"sha265": "abc"}}}}},
 			expectSet:   NewSet("foo.py"),
 		},
 		{
 			name:        "Match material foo.d/foo.py with foo.py",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials", "srcPrefix": "foo.d"},
+			rule:        MatchRule{Pattern: "*", SourcePrefix: "foo.d", DestinationType: "materials", DestinationName: "foo"},
 			srcArtifact: map[string]HashObj{"foo.d/foo.py": {"sha265": "abc"}},
 			item:        map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo", Materials: map[string]HashObj{"foo.py": HashObj{"sha265": "abc"}}}}},
 			expectSet:   NewSet("foo.d/foo.py"),
 		},
 		{
 			name:        "Don't match material (different name)",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials"},
+			rule:        MatchRule{Pattern: "*", DestinationType: "materials", DestinationName: "foo"},
 			srcArtifact: map[string]HashObj{"bar.py": {"sha265": "abc"}},
 			item:        map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo", Materials: map[string]HashObj{"foo.py": {"sha265": "abc"}}}}},
 			expectSet:   NewSet(),
 		},
 		{
 			name:        "Don't match material (different hash)",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials"},
+			rule:        MatchRule{Pattern: "*", DestinationType: "materials", DestinationName: "foo"},
 			srcArtifact: map[string]HashObj{"foo.py": {"sha265": "dead"}},
 			item:        map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo", Materials: map[string]HashObj{"foo.py": {"sha265": "abc"}}}}},
 			expectSet:   NewSet(),
 		},
 		{
 			name:        "Match material in sub-directories dir/foo.py",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials"},
+			rule:        MatchRule{Pattern: "*", DestinationType: "materials", DestinationName: "foo"},
 			srcArtifact: map[string]HashObj{"bar/foo.py": {"sha265": "abc"}},
 			item:        map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo", Materials: map[string]HashObj{"bar/foo.py": {"sha265": "abc"}}}}},
 			expectSet:   NewSet("bar/foo.py"),
@@ -672,7 +848,8 @@ func TestVerifyMatchRule(t *testing.T) {
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
 			queue := NewSet(artifactsDictKeyStrings(tt.srcArtifact)...)
-			result := verifyMatchRule(tt.rule, tt.srcArtifact, queue, tt.item)
+			result := verifyMatchRule(tt.rule, tt.srcArtifact, queue, tt.item, match, nil,
+				slog.Default())
 			if !reflect.DeepEqual(result, tt.expectSet) {
 				t.Errorf("verifyMatchRule returned '%s', expected '%s'", result, tt.expectSet)
 			}
@@ -748,6 +925,47 @@ func TestReduceStepsMetadata(t *testing.T) {
 		}
 	}
 
+	// Test 3: Tolerate dissenting links, if a threshold of links agree
+	agreeing := &Metablock{Signed: Link{Products: map[string]HashObj{"foo.py": {"sha265": "abc"}}}}
+	dissenting := &Metablock{Signed: Link{Products: map[string]HashObj{"foo.py": {"sha265": "def"}}}}
+	layout.Steps[0].Threshold = 2
+	v := &verification{
+		Verifier: *NewVerifier(WithLinkAgreementPolicy(ThresholdLinksAgree)),
+		report:   newVerificationReport(),
+	}
+	stepsMetadata = map[string]map[string]Metadata{
+		"foo": {"a": dissenting, "b": agreeing, "c": agreeing},
+	}
+	v.recordLinkEvidence(layout, stepsMetadata, nil, nil, time.Now())
+	result, err = v.reduceStepsMetadata(layout, stepsMetadata)
+	assert.Nil(t, err)
+	assert.Equal(t, agreeing, result["foo"])
+	if assert.Len(t, v.report.Step("foo").DissentingLinks, 1) {
+		assert.Equal(t, "a", v.report.Step("foo").DissentingLinks[0].KeyID)
+	}
+
+	// The dissenting link does not count towards the threshold
+	links := v.report.Evidence.Items[0].Links
+	if assert.Len(t, links, 2) {
+		assert.Equal(t, "b", links[0].KeyID)
+		assert.Equal(t, "c", links[1].KeyID)
+	}
+
+	// Fewer than threshold links agree, or multiple sets of links reach the
+	// threshold
+	for _, linksPerStep := range []map[string]Metadata{
+		{"a": dissenting, "b": agreeing},
+		{"a": dissenting, "b": dissenting, "c": agreeing, "d": agreeing},
+	} {
+		_, err = v.reduceStepsMetadata(layout,
+			map[string]map[string]Metadata{"foo": linksPerStep})
+		if err == nil || !strings.Contains(err.Error(), "different artifacts") {
+			t.Errorf("reduceStepsMetadata returned '%s', expected a 'different"+
+				" artifacts' error", err)
+		}
+	}
+	layout.Steps[0].Threshold = 0
+
 	// Panic due to missing link metadata for step (final product verification
 	// should gracefully error earlier)
 	defer func() {
@@ -786,6 +1004,39 @@ func TestVerifyStepCommandAlignment(t *testing.T) {
 	fmt.Printf("[begin test warning output]\n")
 	VerifyStepCommandAlignment(layout, stepsMetadata)
 	fmt.Printf("[end test warning output]\n")
+	assert.Nil(t, CheckStepCommandAlignment(layout, stepsMetadata))
+
+	// Test error due to enforced command alignment
+	layout.Steps[0].CommandAlignment = &CommandAlignmentPolicy{
+		Mode: CommandAlignmentEnforce,
+	}
+	err = CheckStepCommandAlignment(layout, stepsMetadata)
+	var alignmentErr *CommandAlignmentError
+	if assert.True(t, errors.As(err, &alignmentErr)) {
+		assert.Equal(t, "foo", alignmentErr.Step)
+		assert.Equal(t, CommandMatchExact, alignmentErr.Match)
+	}
+
+	// Test layout policy, which is overridden by the step's policy
+	layout.CommandAlignment = &CommandAlignmentPolicy{Match: CommandMatchGlob}
+	layout.Steps[0].ExpectedCommand = []string{"rm", "-rf", "*"}
+	assert.Nil(t, CheckStepCommandAlignment(layout, stepsMetadata))
+	layout.Steps[0].CommandAlignment.Match = CommandMatchPrefix
+	assert.NotNil(t, CheckStepCommandAlignment(layout, stepsMetadata))
+	layout.Steps[0].CommandAlignment.Mode = CommandAlignmentIgnore
+	assert.Nil(t, CheckStepCommandAlignment(layout, stepsMetadata))
+
+	// Metadata other than links fails an enforced command alignment
+	invalidMetadata := map[string]map[string]Metadata{
+		"foo": {"a": &Metablock{Signed: Layout{}}},
+	}
+	assert.Nil(t, CheckStepCommandAlignment(layout, invalidMetadata))
+	layout.Steps[0].CommandAlignment.Mode = CommandAlignmentEnforce
+	err = CheckStepCommandAlignment(layout, invalidMetadata)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "is not a link")
+	}
+	layout.Steps[0].CommandAlignment = nil
 
 	// Panic due to missing link metadata for step (final product verification
 	// should gracefully error earlier)
@@ -799,6 +1050,36 @@ func TestVerifyStepCommandAlignment(t *testing.T) {
 	//NOTE: This test won't get any further because of panic
 }
 
+func TestCommandAligns(t *testing.T) {
+	tables := []struct {
+		mode     CommandMatchMode
+		expected []string
+		executed []string
+		aligned  bool
+	}{
+		{CommandMatchExact, []string{"go", "build"}, []string{"go", "build"}, true},
+		{CommandMatchExact, []string{"go", "build"}, []string{"go", "build", "."}, false},
+		{CommandMatchExact, []string{"sh", "-c", "a b"}, []string{"sh", "-c", "a", "b"}, false},
+		{CommandMatchPrefix, []string{"go", "build"}, []string{"go", "build", "."}, true},
+		{CommandMatchPrefix, []string{"go", "build"}, []string{"go", "test"}, false},
+		{CommandMatchPrefix, []string{"go", "build"}, []string{"go"}, false},
+		{CommandMatchGlob, []string{"go", "build", "-o", "*"}, []string{"go", "build", "-o", "bin/foo"}, true},
+		{CommandMatchGlob, []string{"go", "build", "-o", "*"}, []string{"go", "build", "-o"}, false},
+		{CommandMatchGlob, []string{"go", "b?ild"}, []string{"go", "test"}, false},
+	}
+	for _, table := range tables {
+		aligned, err := commandAligns(table.mode, table.expected, table.executed)
+		assert.Nil(t, err)
+		assert.Equal(t, table.aligned, aligned, "%s %v %v", table.mode,
+			table.expected, table.executed)
+	}
+
+	_, err := commandAligns(CommandMatchGlob, []string{"[a-"}, []string{"a"})
+	assert.ErrorIs(t, err, errBadPattern)
+	_, err = commandAligns("regex", nil, nil)
+	assert.NotNil(t, err)
+}
+
 func TestVerifyLinkSignatureThesholds(t *testing.T) {
 	keyID1 := "b7d643dec0a051096ee5d87221b5d91a33daa658699d30903e1cefb90c418401"
 	keyID2 := "d3ffd1086938b3698618adf088bf14b13db4c8ae19e4e78d73da49ee88492710"
@@ -937,6 +1218,18 @@ func TestVerifyLayoutExpiration(t *testing.T) {
 	if err != nil {
 		t.Errorf("VerifyLayoutExpiration returned '%s', expected nil", err)
 	}
+
+	// Test expiration at a point in time other than now
+	err = VerifyLayoutExpirationAt(layout, time.Date(3000, 1, 2, 0, 0, 0, 0, time.UTC))
+	var expiredErr *LayoutExpiredError
+	if !errors.As(err, &expiredErr) {
+		t.Errorf("VerifyLayoutExpirationAt returned '%s', expected LayoutExpiredError", err)
+	}
+	layout.Expires = "1970-01-01T00:00:00Z"
+	err = VerifyLayoutExpirationAt(layout, time.Date(1969, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Errorf("VerifyLayoutExpirationAt returned '%s', expected nil", err)
+	}
 }
 
 func TestVerifyLayoutSignatures(t *testing.T) {
@@ -981,7 +1274,8 @@ func TestSubstituteParamaters(t *testing.T) {
 	}
 
 	layout := Layout{
-		Type: "_layout",
+		Type:    "layout",
+		Expires: "2030-01-01T00:00:00Z",
 		Inspect: []Inspection{
 			{
 				SupplyChainItem: SupplyChainItem{
@@ -995,6 +1289,7 @@ func TestSubstituteParamaters(t *testing.T) {
 		},
 		Steps: []Step{
 			{
+				Type: "step",
 				SupplyChainItem: SupplyChainItem{
 					Name: "run-command",
 					ExpectedMaterials: [][]string{{"MATCH", "{SOURCE_THING}",
@@ -1061,6 +1356,158 @@ func TestSubstituteParamaters(t *testing.T) {
 	}
 }
 
+func TestSubstituteDeclaredParameters(t *testing.T) {
+	keyID := "70ca5750c2eda80b18f41f4ec5f92146789b5d68dd09577be422a0159bd13680"
+	defaultThreshold := "1"
+	defaultEditor := "vim"
+	layout := Layout{
+		Type:    "layout",
+		Expires: "2030-01-01T00:00:00Z",
+		Parameters: map[string]ParameterDeclaration{
+			"FUNCTIONARY": {Type: ParameterHex, Required: true},
+			"THRESHOLD":   {Type: ParameterInteger, Default: &defaultThreshold},
+			"EDITOR":      {Default: &defaultEditor},
+			"EMAIL":       {},
+		},
+		Steps: []Step{
+			{
+				Type:               "step",
+				SupplyChainItem:    SupplyChainItem{Name: "write-code"},
+				PubKeys:            []string{"{FUNCTIONARY}"},
+				ExpectedCommand:    []string{"{EDITOR}"},
+				ThresholdParameter: "THRESHOLD",
+				Threshold:          5,
+				CertificateConstraints: []CertificateConstraint{{
+					Emails: []string{"{EMAIL}"},
+				}},
+			},
+		},
+		Inspect: []Inspection{
+			{
+				Type:            "inspection",
+				SupplyChainItem: SupplyChainItem{Name: "untar"},
+				Run:             []string{"sh", "-c", "echo ${HOME}"},
+			},
+		},
+	}
+
+	newLayout, err := SubstituteParameters(layout, map[string]string{
+		"FUNCTIONARY": keyID,
+		"THRESHOLD":   "2",
+		"EMAIL":       "alice@example.com",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{keyID}, newLayout.Steps[0].PubKeys)
+	assert.Equal(t, []string{"vim"}, newLayout.Steps[0].ExpectedCommand)
+	assert.Equal(t, 2, newLayout.Steps[0].Threshold)
+	assert.Equal(t, []string{"alice@example.com"},
+		newLayout.Steps[0].CertificateConstraints[0].Emails)
+	assert.Equal(t, []string{"sh", "-c", "echo ${HOME}"}, newLayout.Inspect[0].Run)
+
+	// The passed layout is left untouched
+	assert.Equal(t, []string{"{FUNCTIONARY}"}, layout.Steps[0].PubKeys)
+	assert.Equal(t, 5, layout.Steps[0].Threshold)
+
+	tables := []struct {
+		name       string
+		parameters map[string]string
+		err        string
+	}{
+		{"missing required parameter", map[string]string{"EMAIL": "a@b"},
+			"missing required parameter 'FUNCTIONARY'"},
+		{"unknown parameter", map[string]string{"FUNCTIONARY": keyID,
+			"EMAIL": "a@b", "UNKNOWN": "x"}, "unknown parameter 'UNKNOWN'"},
+		{"invalid type", map[string]string{"FUNCTIONARY": keyID,
+			"EMAIL": "a@b", "THRESHOLD": "two"},
+			"invalid value for parameter 'THRESHOLD': 'two' is not an integer"},
+		{"invalid key id", map[string]string{"FUNCTIONARY": "xyz",
+			"EMAIL": "a@b"}, "invalid value for parameter 'FUNCTIONARY'"},
+		{"unresolved parameter", map[string]string{"FUNCTIONARY": keyID},
+			"unresolved parameter 'EMAIL' in step 'write-code'"},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			_, err := SubstituteParameters(layout, table.parameters)
+			assert.ErrorContains(t, err, table.err)
+		})
+	}
+
+	_, err = SubstituteParameters(layout, map[string]string{})
+	assert.ErrorIs(t, err, ErrMissingParameter)
+	_, err = SubstituteParameters(layout, map[string]string{"FUNCTIONARY": keyID})
+	assert.ErrorIs(t, err, ErrUnresolvedParameter)
+
+	// The threshold cannot be passed, if the layout declares no parameters
+	layout.Parameters = nil
+	layout.Steps[0].PubKeys = []string{keyID}
+	layout.Steps[0].ExpectedCommand = nil
+	layout.Steps[0].CertificateConstraints = nil
+	_, err = SubstituteParameters(layout, map[string]string{"THRESHOLD": "1"})
+	assert.EqualError(t, err, "step 'write-code' refers to undeclared threshold"+
+		" parameter 'THRESHOLD'")
+}
+
+func TestSubstituteParametersPlaceholders(t *testing.T) {
+	layout := Layout{
+		Type:    "layout",
+		Expires: "2030-01-01T00:00:00Z",
+		Inspect: []Inspection{{
+			Type:            "inspection",
+			SupplyChainItem: SupplyChainItem{Name: "untar"},
+			Run:             []string{"sh", "-c", "echo ${HOME} {HOME}{DIR}"},
+		}},
+	}
+
+	// Shell variables are left alone, adjacent placeholders are substituted
+	newLayout, err := SubstituteParameters(layout, map[string]string{
+		"HOME": "home", "DIR": "/dir"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"sh", "-c", "echo ${HOME} home/dir"},
+		newLayout.Inspect[0].Run)
+	_, err = SubstituteParameters(layout, map[string]string{"HOME": "home"})
+	assert.EqualError(t, err, "unresolved parameter 'DIR' in inspection 'untar'")
+
+	// The substituted layout is validated
+	layout.PatternDialect = PatternDialectGlobstar
+	layout.Inspect[0].ExpectedProducts = [][]string{{"ALLOW", "{PATTERN}"}}
+	_, err = SubstituteParameters(layout, map[string]string{"HOME": "home",
+		"DIR": "/dir", "PATTERN": "src/{a"})
+	assert.ErrorIs(t, err, errBadPattern)
+	assert.ErrorContains(t, err, "invalid layout after parameter substitution")
+
+	// Pinned digests are validated after substitution
+	layout.Inspect[0].ExpectedProducts = [][]string{
+		{"REQUIRE", "foo", "WITH", "sha256", "{DIGEST}"}}
+	assert.Nil(t, validateLayout(layout))
+	parameters := map[string]string{"HOME": "home", "DIR": "/dir",
+		"DIGEST": strings.Repeat("A", 64)}
+	newLayout, err = SubstituteParameters(layout, parameters)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"REQUIRE", "foo", "WITH", "sha256",
+		strings.Repeat("A", 64)}, newLayout.Inspect[0].ExpectedProducts[0])
+	for _, digest := range []string{"xyz", strings.Repeat("a", 63)} {
+		parameters["DIGEST"] = digest
+		_, err = SubstituteParameters(layout, parameters)
+		assert.ErrorContains(t, err, "invalid layout after parameter substitution")
+	}
+
+	// Counts are validated after substitution
+	parameters["DIGEST"] = strings.Repeat("a", 64)
+	layout.Inspect[0].ExpectedProducts = [][]string{
+		{"EXPECT-COUNT", "*.tar.gz", "==", "{COUNT}"}}
+	assert.Nil(t, validateLayout(layout))
+	parameters["COUNT"] = "2"
+	newLayout, err = SubstituteParameters(layout, parameters)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"EXPECT-COUNT", "*.tar.gz", "==", "2"},
+		newLayout.Inspect[0].ExpectedProducts[0])
+	for _, count := range []string{"-1", "two"} {
+		parameters["COUNT"] = count
+		_, err = SubstituteParameters(layout, parameters)
+		assert.ErrorContains(t, err, "expected non-negative count at token 4")
+	}
+}
+
 func TestInTotoVerifyWithDirectory(t *testing.T) {
 	layoutPath := "demo.layout"
 	pubKeyPath := "alice.pub"
@@ -1087,6 +1534,149 @@ func TestInTotoVerifyWithDirectory(t *testing.T) {
 	}
 }
 
+func TestVerifyLinkSignatureThresholdsIdentity(t *testing.T) {
+	rootCert, _, rootPrivateKey, err := createSelfSignedCA(&x509.Certificate{
+		Subject:    pkix.Name{CommonName: "Root CA"},
+		MaxPathLen: 1,
+	}, x509.Ed25519, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rootKey Key
+	if err := rootKey.LoadKeyReaderDefaults(bytes.NewReader(generatePEMBlock(rootCert.Raw, "CERTIFICATE"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Returns a link for the build step, which reports the passed products,
+	// signed with a new certificate for the passed SPIFFE ID
+	signedLinkWithProducts := func(spiffeID string,
+		products map[string]HashObj) (string, Metadata) {
+		uri, err := url.Parse(spiffeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, certPEM, privateKey, err := createEndEntityCert(&x509.Certificate{
+			Subject: pkix.Name{CommonName: "build"},
+			URIs:    []*url.URL{uri},
+		}, rootCert, rootPrivateKey, x509.Ed25519, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var key Key
+		if err := key.LoadKeyReaderDefaults(bytes.NewReader(generatePEMBlock(privateKeyBytes, "PRIVATE KEY"))); err != nil {
+			t.Fatal(err)
+		}
+		key.KeyVal.Certificate = string(certPEM)
+		link := &Metablock{Signed: Link{Type: "link", Name: "build",
+			Products: products}}
+		if err := link.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+		return key.KeyID, link
+	}
+	signedLink := func(spiffeID string) (string, Metadata) {
+		return signedLinkWithProducts(spiffeID, nil)
+	}
+
+	layout := Layout{
+		RootCas: map[string]Key{rootKey.KeyID: rootKey},
+		Steps: []Step{{
+			SupplyChainItem: SupplyChainItem{Name: "build"},
+			CertificateConstraints: []CertificateConstraint{{
+				CommonName: "build",
+				URIs:       []string{"*"},
+				Roots:      []string{"*"},
+			}},
+			Threshold:         2,
+			ThresholdIdentity: IdentityURI,
+		}},
+	}
+	rootCertPool, intermediateCertPool, err := LoadLayoutCertificates(layout, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two certificates of the same identity count as one functionary
+	keyID1, link1 := signedLink("spiffe://example.com/alice")
+	keyID2, link2 := signedLink("spiffe://example.com/alice")
+	stepsMetadata := map[string]map[string]Metadata{
+		"build": {keyID1: link1, keyID2: link2},
+	}
+	v := &verification{report: newVerificationReport()}
+	_, err = v.verifyLinkSignatureThresholds(context.Background(), layout, stepsMetadata,
+		rootCertPool, intermediateCertPool)
+	var thresholdErr *ThresholdError
+	if assert.True(t, errors.As(err, &thresholdErr)) {
+		assert.Equal(t, 1, thresholdErr.Found)
+		assert.Contains(t, thresholdErr.Error(), "same functionary uri")
+	}
+
+	// Counting key ids, both links pass
+	layout.Steps[0].ThresholdIdentity = IdentityKeyID
+	_, err = v.verifyLinkSignatureThresholds(context.Background(), layout, stepsMetadata,
+		rootCertPool, intermediateCertPool)
+	assert.Nil(t, err)
+
+	// A link of another identity meets the threshold
+	layout.Steps[0].ThresholdIdentity = IdentityURI
+	keyID3, link3 := signedLink("spiffe://example.com/bob")
+	stepsMetadata["build"][keyID3] = link3
+	v = &verification{report: newVerificationReport()}
+	stepsMetadataVerified, err := v.verifyLinkSignatureThresholds(context.Background(), layout,
+		stepsMetadata, rootCertPool, intermediateCertPool)
+	assert.Nil(t, err)
+	assert.Len(t, stepsMetadataVerified["build"], 3)
+
+	// Only one of alice's links counts towards the threshold
+	v.recordLinkEvidence(layout, stepsMetadataVerified, rootCertPool,
+		intermediateCertPool, time.Now())
+	_, err = v.reduceStepsMetadata(layout, stepsMetadataVerified)
+	assert.Nil(t, err)
+	assert.Len(t, v.report.Evidence.Items[0].Links, 2)
+	for _, link := range v.report.Step("build").AcceptedLinks {
+		assert.Contains(t, []string{"uri:spiffe://example.com/alice",
+			"uri:spiffe://example.com/bob"}, link.Identity)
+	}
+
+	// Links without the identity are rejected
+	layout.Steps[0].ThresholdIdentity = IdentityEmail
+	_, err = v.verifyLinkSignatureThresholds(context.Background(), layout, stepsMetadata,
+		rootCertPool, intermediateCertPool)
+	if assert.True(t, errors.As(err, &thresholdErr)) {
+		assert.Equal(t, 0, thresholdErr.Found)
+		assert.Contains(t, thresholdErr.Error(), "certificate has no email identity")
+	}
+
+	// Two certificates of the same identity don't reach the threshold of
+	// agreeing links against another functionary
+	layout.Steps[0].ThresholdIdentity = IdentityURI
+	forged := map[string]HashObj{"foo.py": {"sha256": "abc"}}
+	honest := map[string]HashObj{"foo.py": {"sha256": "def"}}
+	keyID1, link1 = signedLinkWithProducts("spiffe://example.com/alice", forged)
+	keyID2, link2 = signedLinkWithProducts("spiffe://example.com/alice", forged)
+	keyID3, link3 = signedLinkWithProducts("spiffe://example.com/bob", honest)
+	stepsMetadata = map[string]map[string]Metadata{
+		"build": {keyID1: link1, keyID2: link2, keyID3: link3},
+	}
+	v = &verification{
+		Verifier: *NewVerifier(WithLinkAgreementPolicy(ThresholdLinksAgree)),
+		report:   newVerificationReport(),
+	}
+	stepsMetadataVerified, err = v.verifyLinkSignatureThresholds(context.Background(),
+		layout, stepsMetadata, rootCertPool, intermediateCertPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.reduceStepsMetadata(layout, stepsMetadataVerified)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "fewer than a threshold of 2 functionaries agree")
+	}
+}
+
 func TestLoadLayoutCertificates(t *testing.T) {
 	certTemplate := &x509.Certificate{
 		Subject: pkix.Name{
@@ -1136,3 +1726,324 @@ func TestLoadLayoutCertificates(t *testing.T) {
 	_, _, err = LoadLayoutCertificates(testLayout, [][]byte{[]byte("123123123")})
 	assert.NotNil(t, err, "expected error with invalid extra intermediates")
 }
+
+func TestVerifyCollectAllFailures(t *testing.T) {
+	steps := []interface{}{
+		Step{SupplyChainItem: SupplyChainItem{Name: "foo",
+			ExpectedMaterials: [][]string{{"DISALLOW", "*"}}}},
+		Step{SupplyChainItem: SupplyChainItem{Name: "bar",
+			ExpectedProducts: [][]string{{"ALLOW", "*"}}}},
+		Step{SupplyChainItem: SupplyChainItem{Name: "baz",
+			ExpectedProducts: [][]string{{"DISALLOW", "*"}}}},
+	}
+	metadata := map[string]Metadata{
+		"foo": &Metablock{Signed: Link{Name: "foo",
+			Materials: map[string]HashObj{"foo.py": {"sha256": "abc"}}}},
+		"bar": &Metablock{Signed: Link{Name: "bar",
+			Products: map[string]HashObj{"bar.py": {"sha256": "abc"}}}},
+		"baz": &Metablock{Signed: Link{Name: "baz",
+			Products: map[string]HashObj{"baz.py": {"sha256": "abc"}}}},
+	}
+
+	// Without the option, verification aborts on the first failure
+	v := &verification{}
+	err := v.verifyArtifacts(steps, metadata)
+	assert.NotNil(t, err)
+	assert.Empty(t, v.failures)
+
+	v = &verification{Verifier: *NewVerifier(WithCollectAllFailures())}
+	err = v.verifyArtifacts(steps, metadata)
+	assert.Nil(t, err)
+	assert.Len(t, v.failures, 2)
+	assert.True(t, v.hasFailed("foo"))
+	assert.False(t, v.hasFailed("bar"))
+	assert.True(t, v.hasFailed("baz"))
+
+	var verificationErrors error = &VerificationErrors{Errors: v.failures}
+	var failure *VerificationFailure
+	if assert.True(t, errors.As(verificationErrors, &failure)) {
+		assert.Equal(t, PhaseArtifactRules, failure.Phase)
+		assert.Equal(t, "foo", failure.Item)
+	}
+	if assert.True(t, errors.As(v.failures[1], &failure)) {
+		assert.Equal(t, "baz", failure.Item)
+	}
+	assert.Contains(t, verificationErrors.Error(), "2 error(s)")
+}
+
+func TestVerifyArtifactsPatternDialect(t *testing.T) {
+	step := Step{SupplyChainItem: SupplyChainItem{Name: "build",
+		ExpectedProducts: [][]string{
+			{"DISALLOW", "!**/*.{go,mod}"},
+			{"ALLOW", "cmd/**"},
+			{"DISALLOW", "*"},
+		}}}
+	metadata := map[string]Metadata{
+		"build": &Metablock{Signed: Link{Name: "build",
+			Products: map[string]HashObj{
+				"go.mod":              {"sha256": "abc"},
+				"cmd/in-toto/main.go": {"sha256": "abc"},
+			}}},
+	}
+
+	// The legacy dialect treats the patterns literally, so "*" fails
+	v := &verification{}
+	err := v.verifyArtifacts([]interface{}{step}, metadata)
+	var ruleErr *ArtifactRuleError
+	if assert.ErrorAs(t, err, &ruleErr) {
+		assert.Equal(t, []string{"DISALLOW", "*"}, ruleErr.Rule)
+	}
+
+	// With globstar, "cmd/**" consumes main.go, but "*" must not match go.mod
+	v.patternDialect = PatternDialectGlobstar
+	err = v.verifyArtifacts([]interface{}{step}, metadata)
+	if assert.ErrorAs(t, err, &ruleErr) {
+		assert.Equal(t, []string{"go.mod"}, ruleErr.Paths)
+	}
+
+	step.ExpectedProducts[2] = []string{"DISALLOW", "*.sum"}
+	err = v.verifyArtifacts([]interface{}{step}, metadata)
+	assert.Nil(t, err)
+
+	// Negated patterns match everything but Go sources
+	metadata["build"].(*Metablock).Signed = Link{Name: "build",
+		Products: map[string]HashObj{"cmd/in-toto/main.sh": {"sha256": "abc"}}}
+	err = v.verifyArtifacts([]interface{}{step}, metadata)
+	if assert.ErrorAs(t, err, &ruleErr) {
+		assert.Equal(t, []string{"cmd/in-toto/main.sh"}, ruleErr.Paths)
+	}
+}
+
+func TestVerifyMatchRuleHashPolicy(t *testing.T) {
+	sha256Digest := strings.Repeat("a", 64)
+	sha512Digest := strings.Repeat("b", 128)
+	tables := []struct {
+		name    string
+		policy  *HashPolicy
+		src     HashObj
+		dst     HashObj
+		matched bool
+	}{
+		{"no policy requires equal hash objects", nil,
+			HashObj{"sha256": sha256Digest, "sha512": sha512Digest},
+			HashObj{"sha256": sha256Digest}, false},
+		{"no policy accepts any equal hash objects", nil,
+			HashObj{"sha265": "abc"}, HashObj{"sha265": "abc"}, true},
+		{"common algorithm agrees", &HashPolicy{},
+			HashObj{"sha256": sha256Digest, "sha512": sha512Digest},
+			HashObj{"sha256": sha256Digest}, true},
+		{"common algorithm disagrees", &HashPolicy{},
+			HashObj{"sha256": sha256Digest, "sha512": sha512Digest},
+			HashObj{"sha256": sha256Digest, "sha512": strings.Repeat("c", 128)},
+			false},
+		{"no common algorithm", &HashPolicy{}, HashObj{"sha256": sha256Digest},
+			HashObj{"sha512": sha512Digest}, false},
+		{"only weak algorithm in common", &HashPolicy{},
+			HashObj{"sha1": "abc", "sha256": sha256Digest},
+			HashObj{"sha1": "abc", "sha512": sha512Digest}, false},
+		{"unknown algorithm in common", &HashPolicy{}, HashObj{"sha265": "abc"},
+			HashObj{"sha265": "abc"}, false},
+		{"hex digests are case insensitive", &HashPolicy{},
+			HashObj{"sha256": strings.ToUpper(sha256Digest)},
+			HashObj{"sha256": sha256Digest}, true},
+		{"algorithm not listed", &HashPolicy{Algorithms: []string{"sha512"}},
+			HashObj{"sha256": sha256Digest, "sha512": sha512Digest},
+			HashObj{"sha256": sha256Digest}, false},
+		{"algorithm not strong enough", &HashPolicy{MinimumStrength: 192},
+			HashObj{"sha256": sha256Digest}, HashObj{"sha256": sha256Digest},
+			false},
+		{"weak algorithm accepted", &HashPolicy{Algorithms: []string{"sha224"},
+			MinimumStrength: 112}, HashObj{"sha224": "abc"},
+			HashObj{"sha224": "abc"}, true},
+	}
+	rule := MatchRule{Pattern: "foo.py", DestinationType: "products",
+		DestinationName: "foo"}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			src := map[string]HashObj{"foo.py": table.src}
+			items := map[string]Metadata{"foo": &Metablock{Signed: Link{
+				Name: "foo", Products: map[string]HashObj{"foo.py": table.dst}}}}
+			consumed := verifyMatchRule(rule, src, NewSet("foo.py"), items, match,
+				table.policy, slog.Default())
+			assert.Equal(t, table.matched, consumed.Has("foo.py"))
+		})
+	}
+}
+
+func TestVerifyArtifactsDigestRules(t *testing.T) {
+	fooDigest := strings.Repeat("a", 64)
+	barDigest := strings.Repeat("b", 64)
+	manifestDir := t.TempDir()
+	// writeManifest writes the manifest and returns its pinned sha256 digest
+	writeManifest := func(name string, contents string) string {
+		err := os.WriteFile(filepath.Join(manifestDir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := sha256.Sum256([]byte(contents))
+		return hex.EncodeToString(digest[:])
+	}
+	sumsDigest := writeManifest("SHA256SUMS", "# vendored\n"+fooDigest+
+		"  vendor/foo.tar.gz\n"+strings.Repeat("c", 64)+" *vendor/bar.tar.gz\n")
+	jsonDigest := writeManifest("manifest.json",
+		`{"vendor/bar.tar.gz": {"sha256": "`+barDigest+`"}}`)
+
+	metadata := map[string]Metadata{
+		"build": &Metablock{Signed: Link{Name: "build",
+			Materials: map[string]HashObj{
+				"vendor/foo.tar.gz":   {"sha256": fooDigest},
+				"./vendor/bar.tar.gz": {"sha256": barDigest},
+			}}},
+	}
+	v := &verification{Verifier: *NewVerifier(WithManifestDir(manifestDir))}
+	tables := []struct {
+		name  string
+		rules [][]string
+		err   string
+	}{
+		{"required digest", [][]string{
+			{"REQUIRE", "vendor/foo.tar.gz", "WITH", "sha256", strings.ToUpper(fooDigest)},
+			{"ALLOW", "*"},
+		}, ""},
+		{"required digest mismatch", [][]string{
+			{"REQUIRE", "vendor/bar.tar.gz", "WITH", "sha256", fooDigest},
+		}, "because its sha256 digest is not " + fooDigest},
+		{"required digest of unacceptable algorithm", [][]string{
+			{"REQUIRE", "vendor/foo.tar.gz", "WITH", "sha1", fooDigest},
+		}, "because its sha1 digest is not"},
+		{"digests match checksum file", [][]string{
+			{"MATCH-DIGEST", "vendor/*", "FROM-FILE", "SHA256SUMS", "WITH", "sha256", sumsDigest},
+			{"DISALLOW", "*"},
+		}, "materials [vendor/bar.tar.gz] disallowed by rule"},
+		{"digests match manifest", [][]string{
+			{"MATCH-DIGEST", "vendor/*", "FROM-FILE", "SHA256SUMS", "WITH", "sha256", sumsDigest},
+			{"MATCH-DIGEST", "vendor/*", "FROM-FILE", "manifest.json", "WITH", "sha256", jsonDigest},
+			{"DISALLOW", "*"},
+		}, ""},
+		{"manifest without pinned digest", [][]string{
+			{"MATCH-DIGEST", "vendor/*", "FROM-FILE", "SHA256SUMS", "WITH", "sha256", jsonDigest},
+		}, "manifest does not have the pinned digest"},
+		{"missing manifest", [][]string{
+			{"MATCH-DIGEST", "vendor/*", "FROM-FILE", "SHA512SUMS", "WITH", "sha256", sumsDigest},
+		}, "failed to load manifest of rule"},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			step := Step{SupplyChainItem: SupplyChainItem{Name: "build",
+				ExpectedMaterials: table.rules}}
+			err := v.verifyArtifacts([]interface{}{step}, metadata)
+			if table.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorContains(t, err, table.err)
+			}
+		})
+	}
+
+	// The evidence records the manifests and their pinned digests
+	v.report = newVerificationReport()
+	rule := []string{"MATCH-DIGEST", "vendor/*", "FROM-FILE", "manifest.json",
+		"WITH", "sha256", jsonDigest}
+	step := Step{SupplyChainItem: SupplyChainItem{Name: "build",
+		ExpectedMaterials: [][]string{rule}}}
+	assert.Nil(t, v.verifyArtifacts([]interface{}{step}, metadata))
+	if assert.Len(t, v.report.Evidence.Items, 1) {
+		assert.Equal(t, []MatchEvidence{{
+			ArtifactType:   "materials",
+			Rule:           rule,
+			Manifest:       "manifest.json",
+			ManifestDigest: HashObj{"sha256": jsonDigest},
+			Artifacts:      []string{"vendor/bar.tar.gz"},
+		}}, v.report.Evidence.Items[0].Matches)
+	}
+	var dot bytes.Buffer
+	assert.Nil(t, v.report.Evidence.WriteDOT(&dot))
+	assert.Contains(t, dot.String(), `"item:build" -> "manifest:manifest.json"`)
+}
+
+func TestVerifyArtifactsCardinalityRules(t *testing.T) {
+	metadata := map[string]Metadata{
+		"package": &Metablock{Signed: Link{Name: "package",
+			Products: map[string]HashObj{
+				"foo.tar.gz":     {"sha256": "abc"},
+				"foo.tar.gz.sig": {"sha256": "abc"},
+				"bar.tar.gz":     {"sha256": "abc"},
+			}}},
+	}
+	tables := []struct {
+		name  string
+		rules [][]string
+		err   string
+	}{
+		{"require any", [][]string{{"REQUIRE-ANY", "*.sig"}}, ""},
+		{"require any missing", [][]string{{"REQUIRE-ANY", "*.asc"}},
+			"no products match rule [REQUIRE-ANY *.asc]"},
+		{"require any after consumption", [][]string{{"ALLOW", "*.sig"},
+			{"REQUIRE-ANY", "*.sig"}}, "no products match rule"},
+		{"require all of", [][]string{{"REQUIRE-ALL-OF", "foo.*", "*.sig"}}, ""},
+		{"require all of missing", [][]string{
+			{"REQUIRE-ALL-OF", "*.sig", "*.asc", "*.zip"}},
+			"no products match [*.asc *.zip] required by rule"},
+		{"expect count", [][]string{{"EXPECT-COUNT", "*.tar.gz", "==", "2"},
+			{"EXPECT-COUNT", "*.sig", "<=", "1"},
+			{"EXPECT-COUNT", "*.asc", "==", "0"}}, ""},
+		{"expect count mismatch", [][]string{
+			{"EXPECT-COUNT", "*.tar.gz", "==", "1"}},
+			"2 products [bar.tar.gz foo.tar.gz] match rule [EXPECT-COUNT *.tar.gz == 1]"},
+		{"expect count does not consume", [][]string{
+			{"EXPECT-COUNT", "*", ">", "2"}, {"DISALLOW", "*"}},
+			"disallowed by rule [DISALLOW *]"},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			step := Step{SupplyChainItem: SupplyChainItem{Name: "package",
+				ExpectedProducts: table.rules}}
+			err := VerifyArtifacts([]interface{}{step}, metadata)
+			if table.err == "" {
+				assert.Nil(t, err)
+			} else {
+				var ruleErr *ArtifactRuleError
+				assert.ErrorAs(t, err, &ruleErr)
+				assert.ErrorContains(t, err, table.err)
+			}
+		})
+	}
+}
+
+func TestInTotoVerifyCollectAllFailures(t *testing.T) {
+	layoutMb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubKey Key
+	if err := pubKey.LoadKey("alice.pub", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{pubKey.KeyID: pubKey}
+
+	// No links can be loaded for any of the steps of the layout, the
+	// inspection is still run and fails its artifact rules
+	_, err = InTotoVerify(layoutMb, layoutKeys, "does-not-exist", "",
+		map[string]string{}, [][]byte{}, testOSisWindows(), WithCollectAllFailures())
+	defer os.Remove("untar.link")
+
+	var verificationErrors *VerificationErrors
+	if !errors.As(err, &verificationErrors) {
+		t.Fatalf("expected VerificationErrors, got '%v'", err)
+	}
+	expected := []VerificationFailure{
+		{Phase: PhaseLinkLoading, Item: "write-code"},
+		{Phase: PhaseLinkLoading, Item: "package"},
+		{Phase: PhaseInspections, Item: "untar"},
+	}
+	if !assert.Len(t, verificationErrors.Errors, len(expected)) {
+		return
+	}
+	for i, err := range verificationErrors.Errors {
+		var failure *VerificationFailure
+		if assert.True(t, errors.As(err, &failure)) {
+			assert.Equal(t, expected[i].Phase, failure.Phase)
+			assert.Equal(t, expected[i].Item, failure.Item)
+		}
+	}
+}
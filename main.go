@@ -2,8 +2,12 @@ package main
 
 import (
 	"github.com/in-toto/in-toto-golang/cmd"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
 )
 
 func main() {
+	// Set up the sandbox of sandboxed inspections, see verify
+	// --sandbox-inspections, before anything else
+	intoto.SandboxMain()
 	cmd.Execute()
 }